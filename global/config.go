@@ -0,0 +1,212 @@
+package global
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Config is a job configuration file. Every value can be overridden by the commandline.
+type Config struct {
+	PcapFile   string         `json:"pcapFile" yaml:"pcapFile" toml:"pcapFile"`
+	PcapFiles  []string       `json:"pcapFiles" yaml:"pcapFiles" toml:"pcapFiles"`
+	OutputPath string         `json:"outputPath" yaml:"outputPath" toml:"outputPath"`
+	Mkdirp     *bool          `json:"mkdirp" yaml:"mkdirp" toml:"mkdirp"`
+	Sensors    []SensorConfig `json:"sensors" yaml:"sensors" toml:"sensors"`
+	Outputs    OutputConfig   `json:"outputs" yaml:"outputs" toml:"outputs"`
+	Filters    FilterConfig   `json:"filters" yaml:"filters" toml:"filters"`
+	Registry   []string       `json:"registry" yaml:"registry" toml:"registry"`
+	Vehicle    string         `json:"vehicle" yaml:"vehicle" toml:"vehicle"`
+	Render     RenderConfig   `json:"render" yaml:"render" toml:"render"`
+}
+
+// SensorConfig describes one lidar of the vehicle
+type SensorConfig struct {
+	Name            string     `json:"name" yaml:"name" toml:"name"`
+	IP              string     `json:"ip" yaml:"ip" toml:"ip"`
+	Model           string     `json:"model" yaml:"model" toml:"model"`
+	CalibrationFile string     `json:"calibrationFile" yaml:"calibrationFile" toml:"calibrationFile"`
+	Extrinsics      Extrinsics `json:"extrinsics" yaml:"extrinsics" toml:"extrinsics"`
+}
+
+// Extrinsics is the mounting pose of a sensor. Translation in mm, rotation in degrees.
+type Extrinsics struct {
+	X     float64 `json:"x" yaml:"x" toml:"x"`
+	Y     float64 `json:"y" yaml:"y" toml:"y"`
+	Z     float64 `json:"z" yaml:"z" toml:"z"`
+	Roll  float64 `json:"roll" yaml:"roll" toml:"roll"`
+	Pitch float64 `json:"pitch" yaml:"pitch" toml:"pitch"`
+	Yaw   float64 `json:"yaw" yaml:"yaw" toml:"yaw"`
+}
+
+// OutputConfig selects the output formats
+type OutputConfig struct {
+	JSON       *bool  `json:"json" yaml:"json" toml:"json"`
+	PNG        *bool  `json:"png" yaml:"png" toml:"png"`
+	Images     *bool  `json:"images" yaml:"images" toml:"images"`
+	PLY        *bool  `json:"ply" yaml:"ply" toml:"ply"`
+	PCD        *bool  `json:"pcd" yaml:"pcd" toml:"pcd"`
+	Colorize   *bool  `json:"colorize" yaml:"colorize" toml:"colorize"`
+	DumpFormat string `json:"dumpFormat" yaml:"dumpFormat" toml:"dumpFormat"`
+}
+
+// FilterConfig selects the frames, packets and sources to process
+type FilterConfig struct {
+	StartFrame  *int     `json:"startFrame" yaml:"startFrame" toml:"startFrame"`
+	EndFrame    *int     `json:"endFrame" yaml:"endFrame" toml:"endFrame"`
+	Stride      *int     `json:"stride" yaml:"stride" toml:"stride"`
+	StartPacket *int     `json:"startPacket" yaml:"startPacket" toml:"startPacket"`
+	EndPacket   *int     `json:"endPacket" yaml:"endPacket" toml:"endPacket"`
+	Channels    []string `json:"channels" yaml:"channels" toml:"channels"`
+}
+
+// DecodeFile reads a YAML, TOML or JSON file, detected by its extension
+func DecodeFile(fileName string, v interface{}) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, v)
+	case ".toml":
+		_, err = toml.Decode(string(data), v)
+	case ".json":
+		err = json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("%s: unknown file format, use .yaml, .toml or .json", fileName)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	return nil
+}
+
+// LoadConfig reads a YAML, TOML or JSON configuration file, detected by its extension
+func LoadConfig(fileName string) (*Config, error) {
+	var config Config
+	if err := DecodeFile(fileName, &config); err != nil {
+		return nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	// Relative paths are relative to the config file
+	dir := filepath.Dir(fileName)
+	for i := range config.Sensors {
+		config.Sensors[i].CalibrationFile = resolvePath(dir, config.Sensors[i].CalibrationFile)
+	}
+	for i := range config.Registry {
+		config.Registry[i] = resolvePath(dir, config.Registry[i])
+	}
+	config.Render.CameraImages = resolvePath(dir, config.Render.CameraImages)
+
+	return &config, nil
+}
+
+func (config *Config) validate() error {
+	addresses := make(map[string]bool)
+	for i, sensor := range config.Sensors {
+		if len(sensor.IP) == 0 {
+			return fmt.Errorf("sensor %d has no ip", i)
+		}
+		if addresses[sensor.IP] {
+			return fmt.Errorf("sensor ip %s is defined more than once", sensor.IP)
+		}
+		addresses[sensor.IP] = true
+	}
+	return nil
+}
+
+func resolvePath(dir string, fileName string) string {
+	if len(fileName) == 0 || filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return filepath.Join(dir, fileName)
+}
+
+// ApplyConfig fills the input that was not given in the commandline with the values of the config file
+func (ui *CLInput) ApplyConfig(config *Config, isSet func(name string) bool) {
+	if !isSet("pcapFile") {
+		files := config.PcapFiles
+		if len(config.PcapFile) > 0 {
+			files = append([]string{config.PcapFile}, files...)
+		}
+		if len(files) > 0 {
+			ui.PcapFiles = *cli.NewStringSlice(files...)
+		}
+	}
+	if !isSet("outputPath") && len(config.OutputPath) > 0 {
+		ui.OutputPath = config.OutputPath
+	}
+	if !isSet("mkdirp") && config.Mkdirp != nil {
+		ui.Mkdirp = *config.Mkdirp
+	}
+
+	if !isSet("JSON") && config.Outputs.JSON != nil {
+		ui.IsSaveAsJSON = *config.Outputs.JSON
+	}
+	if !isSet("PNG") && config.Outputs.PNG != nil {
+		ui.IsSaveAsPNG = *config.Outputs.PNG
+	}
+	if !isSet("images") && config.Outputs.Images != nil {
+		ui.IsSaveImages = *config.Outputs.Images
+	}
+	if !isSet("PLY") && config.Outputs.PLY != nil {
+		ui.IsSaveAsPLY = *config.Outputs.PLY
+	}
+	if !isSet("PCD") && config.Outputs.PCD != nil {
+		ui.IsSaveAsPCD = *config.Outputs.PCD
+	}
+	if !isSet("colorize") && config.Outputs.Colorize != nil {
+		ui.IsColorize = *config.Outputs.Colorize
+	}
+	if !isSet("format") && len(config.Outputs.DumpFormat) > 0 {
+		ui.DumpFormat = config.Outputs.DumpFormat
+	}
+
+	applyInt(&ui.StartFrame, config.Filters.StartFrame, isSet("startFrame"))
+	applyInt(&ui.EndFrame, config.Filters.EndFrame, isSet("endFrame"))
+	applyInt(&ui.Stride, config.Filters.Stride, isSet("stride"))
+	applyInt(&ui.StartPacket, config.Filters.StartPacket, isSet("startPacket"))
+	applyInt(&ui.EndPacket, config.Filters.EndPacket, isSet("endPacket"))
+
+	if !isSet("channels") && len(config.Filters.Channels) > 0 {
+		ui.Channels = *cli.NewStringSlice(config.Filters.Channels...)
+	}
+
+	if !isSet("registry") && len(config.Registry) > 0 {
+		ui.Registry = *cli.NewStringSlice(config.Registry...)
+	}
+	if !isSet("vehicle") && len(config.Vehicle) > 0 {
+		ui.Vehicle = config.Vehicle
+	}
+
+	ui.Render.applyConfig(&config.Render, isSet)
+
+	ui.Sensors = config.Sensors
+}
+
+func applyInt(dest *int, value *int, isSet bool) {
+	if !isSet && value != nil {
+		*dest = *value
+	}
+}
+
+// GetSensor returns the configured sensor of the IP address
+func (ui *CLInput) GetSensor(address string) (SensorConfig, bool) {
+	for _, sensor := range ui.Sensors {
+		if sensor.IP == address {
+			return sensor, true
+		}
+	}
+	return SensorConfig{}, false
+}
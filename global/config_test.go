@@ -0,0 +1,121 @@
+package global
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlConfig = `pcapFile: /data/drive.pcap
+outputPath: out
+registry: [vehicles.yaml]
+sensors:
+  - name: front
+    ip: 10.0.0.1
+    calibrationFile: calib/front.yaml
+    extrinsics: {x: 1000, yaw: 90}
+outputs:
+  ply: true
+filters:
+  startFrame: 10
+  endFrame: 20
+render:
+  mode: range
+  xMin: -20
+  eye: [1, 2, 3]
+`
+
+const tomlConfig = `pcapFile = "/data/drive.pcap"
+outputPath = "out"
+registry = ["vehicles.yaml"]
+
+[[sensors]]
+name = "front"
+ip = "10.0.0.1"
+calibrationFile = "calib/front.yaml"
+extrinsics = {x = 1000.0, yaw = 90.0}
+
+[outputs]
+ply = true
+
+[filters]
+startFrame = 10
+endFrame = 20
+
+[render]
+mode = "range"
+xMin = -20.0
+eye = [1.0, 2.0, 3.0]
+`
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLoadConfigAppliesYAMLAndTOML(t *testing.T) {
+	for _, test := range []struct{ name, content string }{{"job.yaml", yamlConfig}, {"job.toml", tomlConfig}} {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := writeConfig(t, test.name, test.content)
+			config, err := LoadConfig(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the paths of the calibrations are relative to the config file
+			dir := filepath.Dir(fileName)
+			sensor := config.Sensors[0]
+			if sensor.Name != "front" || sensor.CalibrationFile != filepath.Join(dir, "calib/front.yaml") ||
+				sensor.Extrinsics != (Extrinsics{X: 1000, Yaw: 90}) {
+				t.Errorf("sensor is %+v", sensor)
+			}
+
+			// the flags given in the commandline are kept
+			ui := UserInput
+			ui.EndFrame = 30
+			ui.ApplyConfig(config, func(name string) bool { return name == "endFrame" })
+
+			if !reflect.DeepEqual(ui.PcapFiles.Value(), []string{"/data/drive.pcap"}) || ui.OutputPath != "out" ||
+				!reflect.DeepEqual(ui.Registry.Value(), []string{filepath.Join(dir, "vehicles.yaml")}) {
+				t.Errorf("files are %v, %q and %v", ui.PcapFiles.Value(), ui.OutputPath, ui.Registry.Value())
+			}
+			if !ui.IsSaveAsPLY || ui.IsSaveAsPCD || ui.StartFrame != 10 || ui.EndFrame != 30 {
+				t.Errorf("outputs and filters are PLY %t, PCD %t, frames %d to %d", ui.IsSaveAsPLY, ui.IsSaveAsPCD, ui.StartFrame, ui.EndFrame)
+			}
+			if ui.Render.Mode != "range" || ui.Render.XMin != -20 || ui.Render.XMax != 50 ||
+				!reflect.DeepEqual(ui.Render.Eye.Value(), []float64{1, 2, 3}) {
+				t.Errorf("render input is %+v", ui.Render)
+			}
+
+			// the sensors of the config whitelist their addresses
+			if !ui.IsWhitelisted("10.0.0.1") || ui.IsWhitelisted("10.0.0.2") {
+				t.Error("the sensors do not whitelist their addresses")
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown.yaml", "pcapFiel: drive.pcap\n", "pcapFiel"},
+		{"duplicate.yaml", "sensors: [{ip: 10.0.0.1}, {ip: 10.0.0.1}]\n", "more than once"},
+		{"missing.yaml", "sensors: [{name: front}]\n", "has no ip"},
+		{"job.ini", "", "unknown file format"},
+	}
+	for _, test := range tests {
+		_, err := LoadConfig(writeConfig(t, test.name, test.content))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
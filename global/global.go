@@ -1,12 +1,55 @@
 package global
 
+import (
+	"github.com/urfave/cli"
+	"runtime"
+)
+
 // UserInput contains the users commandline input
 var UserInput = CLInput{
-	PcapFile:     "",
 	OutputPath:   "",
 	StartFrame:   0,
-	EndFrame:     0,
+	EndFrame:     -1,
+	Stride:       1,
+	StartPacket:  0,
+	EndPacket:    -1,
 	Mkdirp:       false,
 	IsSaveAsJSON: false,
 	IsSaveAsPNG:  false,
+	DumpFormat:   "ndjson",
+	IsInfoAsJSON: false,
+	Listen:       "localhost:8080",
+	DataPort:     2368,
+	PositionPort: 8308,
+	Destination:  "localhost",
+	Speed:        1,
+	PcapFormat:   "pcap",
+	Jobs:         runtime.NumCPU(),
+	Render: RenderInput{
+		Mode:          "bev",
+		XMin:          -50,
+		XMax:          50,
+		YMin:          -50,
+		YMax:          50,
+		ZMin:          -3,
+		ZMax:          5,
+		Resolution:    0.1,
+		ColorMode:     "height",
+		Colormap:      "viridis",
+		Grid:          10,
+		RangeRings:    0,
+		AzimuthBins:   1800,
+		RangeUnit:     0.002,
+		IsSaveRaw:     false,
+		DepthMin:      0,
+		DepthMax:      10,
+		ImageWidth:    960,
+		ImageHeight:   540,
+		MaxTimeOffset: 0.05,
+		FPS:           10,
+		Eye:           *cli.NewFloat64Slice(0, -15, 8),
+		LookAt:        *cli.NewFloat64Slice(0, 10, 0),
+		FOV:           60,
+		PointSize:     2,
+	},
 }
@@ -0,0 +1,238 @@
+package global
+
+import (
+	"github.com/urfave/cli"
+)
+
+// RenderInput contains the options of the renderers. Distances are in meters.
+type RenderInput struct {
+	Mode          string
+	XMin          float64
+	XMax          float64
+	YMin          float64
+	YMax          float64
+	ZMin          float64
+	ZMax          float64
+	Resolution    float64
+	ColorMode     string
+	Colormap      string
+	Grid          float64
+	RangeRings    float64
+	AzimuthBins   int
+	RangeUnit     float64
+	IsSaveRaw     bool
+	Cameras       cli.StringSlice
+	DepthMin      float64
+	DepthMax      float64
+	ImageWidth    int
+	ImageHeight   int
+	CameraImages  string
+	MaxTimeOffset float64
+	Animation     string
+	FPS           float64
+	Eye           cli.Float64Slice
+	LookAt        cli.Float64Slice
+	FOV           float64
+	PointSize     int
+}
+
+// RenderConfig contains the options of the renderers in the job configuration
+type RenderConfig struct {
+	Mode          string    `json:"mode" yaml:"mode" toml:"mode"`
+	XMin          *float64  `json:"xMin" yaml:"xMin" toml:"xMin"`
+	XMax          *float64  `json:"xMax" yaml:"xMax" toml:"xMax"`
+	YMin          *float64  `json:"yMin" yaml:"yMin" toml:"yMin"`
+	YMax          *float64  `json:"yMax" yaml:"yMax" toml:"yMax"`
+	ZMin          *float64  `json:"zMin" yaml:"zMin" toml:"zMin"`
+	ZMax          *float64  `json:"zMax" yaml:"zMax" toml:"zMax"`
+	Resolution    *float64  `json:"resolution" yaml:"resolution" toml:"resolution"`
+	ColorMode     string    `json:"colorMode" yaml:"colorMode" toml:"colorMode"`
+	Colormap      string    `json:"colormap" yaml:"colormap" toml:"colormap"`
+	Grid          *float64  `json:"grid" yaml:"grid" toml:"grid"`
+	RangeRings    *float64  `json:"rangeRings" yaml:"rangeRings" toml:"rangeRings"`
+	AzimuthBins   *int      `json:"azimuthBins" yaml:"azimuthBins" toml:"azimuthBins"`
+	RangeUnit     *float64  `json:"rangeUnit" yaml:"rangeUnit" toml:"rangeUnit"`
+	IsSaveRaw     *bool     `json:"raw" yaml:"raw" toml:"raw"`
+	Cameras       []string  `json:"cameras" yaml:"cameras" toml:"cameras"`
+	DepthMin      *float64  `json:"depthMin" yaml:"depthMin" toml:"depthMin"`
+	DepthMax      *float64  `json:"depthMax" yaml:"depthMax" toml:"depthMax"`
+	ImageWidth    *int      `json:"imageWidth" yaml:"imageWidth" toml:"imageWidth"`
+	ImageHeight   *int      `json:"imageHeight" yaml:"imageHeight" toml:"imageHeight"`
+	CameraImages  string    `json:"cameraImages" yaml:"cameraImages" toml:"cameraImages"`
+	MaxTimeOffset *float64  `json:"maxTimeOffset" yaml:"maxTimeOffset" toml:"maxTimeOffset"`
+	Animation     string    `json:"animation" yaml:"animation" toml:"animation"`
+	FPS           *float64  `json:"fps" yaml:"fps" toml:"fps"`
+	Eye           []float64 `json:"eye" yaml:"eye" toml:"eye"`
+	LookAt        []float64 `json:"lookAt" yaml:"lookAt" toml:"lookAt"`
+	FOV           *float64  `json:"fov" yaml:"fov" toml:"fov"`
+	PointSize     *int      `json:"pointSize" yaml:"pointSize" toml:"pointSize"`
+}
+
+func (ri *RenderInput) flags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        "mode",
+			Value:       ri.Mode,
+			Usage:       "renderer, \"bev\" for the bird's eye view, \"range\" for the range image and intensity panorama, \"elevation\" for the camera elevation views, \"camera\" for the camera projections or \"perspective\" for a virtual camera",
+			Destination: &(ri.Mode),
+		},
+		ri.float64Flag("xMin", &(ri.XMin), "lower limit of the X axis in meters"),
+		ri.float64Flag("xMax", &(ri.XMax), "upper limit of the X axis in meters"),
+		ri.float64Flag("yMin", &(ri.YMin), "lower limit of the Y axis in meters"),
+		ri.float64Flag("yMax", &(ri.YMax), "upper limit of the Y axis in meters"),
+		ri.float64Flag("zMin", &(ri.ZMin), "lower limit of the Z axis in meters"),
+		ri.float64Flag("zMax", &(ri.ZMax), "upper limit of the Z axis in meters"),
+		ri.float64Flag("resolution", &(ri.Resolution), "meters per pixel"),
+		&cli.StringFlag{
+			Name:        "colorMode",
+			Value:       ri.ColorMode,
+			Usage:       "point color, \"height\", \"intensity\", \"density\", \"ring\" or \"depth\" for the perspective view",
+			Destination: &(ri.ColorMode),
+		},
+		&cli.StringFlag{
+			Name:        "colormap",
+			Value:       ri.Colormap,
+			Usage:       "\"viridis\", \"jet\", \"turbo\", \"hot\", \"gray\" or \"green\"",
+			Destination: &(ri.Colormap),
+		},
+		ri.float64Flag("grid", &(ri.Grid), "grid spacing in meters, 0 hides the grid"),
+		ri.float64Flag("rangeRings", &(ri.RangeRings), "range ring spacing in meters, 0 hides the rings"),
+		&cli.IntFlag{
+			Name:        "azimuthBins",
+			Value:       ri.AzimuthBins,
+			Usage:       "number of columns of the range image",
+			Destination: &(ri.AzimuthBins),
+		},
+		ri.float64Flag("rangeUnit", &(ri.RangeUnit), "meters per value of the 16-bit range image"),
+		&cli.BoolFlag{
+			Name:        "raw",
+			Value:       ri.IsSaveRaw,
+			Usage:       "also save the ranges of the range image as a float32 array",
+			Destination: &(ri.IsSaveRaw),
+		},
+		ri.float64Flag("depthMin", &(ri.DepthMin), "lower limit of the horizontal distance in meters"),
+		ri.float64Flag("depthMax", &(ri.DepthMax), "upper limit of the horizontal distance in meters"),
+		&cli.IntFlag{
+			Name:        "imageWidth",
+			Value:       ri.ImageWidth,
+			Usage:       "width of the camera images in pixels",
+			Destination: &(ri.ImageWidth),
+		},
+		&cli.IntFlag{
+			Name:        "imageHeight",
+			Value:       ri.ImageHeight,
+			Usage:       "height of the camera images in pixels",
+			Destination: &(ri.ImageHeight),
+		},
+		&cli.StringFlag{
+			Name:        "animation",
+			Value:       ri.Animation,
+			Usage:       "\"gif\" or \"avi\" collects the bev or range frames of each lidar into an animation instead of images",
+			Destination: &(ri.Animation),
+		},
+		ri.float64Flag("fps", &(ri.FPS), "frame rate of the animation"),
+		&cli.Float64SliceFlag{
+			Name:        "eye",
+			Value:       cli.NewFloat64Slice(ri.Eye.Value()...),
+			Usage:       "x,y,z position of the perspective camera in meters",
+			Destination: &(ri.Eye),
+		},
+		&cli.Float64SliceFlag{
+			Name:        "lookAt",
+			Value:       cli.NewFloat64Slice(ri.LookAt.Value()...),
+			Usage:       "x,y,z point in meters at the center of the perspective view",
+			Destination: &(ri.LookAt),
+		},
+		ri.float64Flag("fov", &(ri.FOV), "vertical field of view of the perspective camera in degrees"),
+		&cli.IntFlag{
+			Name:        "pointSize",
+			Value:       ri.PointSize,
+			Usage:       "size of the points of the perspective view in pixels",
+			Destination: &(ri.PointSize),
+		},
+	}, ri.cameraFlags()...)
+}
+
+// cameraFlags returns the flags of the camera selection and camera images
+func (ri *RenderInput) cameraFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.GenericFlag{
+			Name:  "cameras",
+			Usage: "registry cameras of the elevation views, projections and colors, all cameras of the vehicle when empty",
+			Value: &pathList{destination: &(ri.Cameras)},
+		},
+		&cli.StringFlag{
+			Name:        "cameraImages",
+			Usage:       "directory of the camera images, as <camera>/<unix time>.jpg or .png",
+			Destination: &(ri.CameraImages),
+		},
+		ri.float64Flag("maxTimeOffset", &(ri.MaxTimeOffset), "maximum time between a frame and its camera image in seconds"),
+	}
+}
+
+func (ri *RenderInput) float64Flag(name string, destination *float64, usage string) cli.Flag {
+	return &cli.Float64Flag{
+		Name:        name,
+		Value:       *destination,
+		Usage:       usage,
+		Destination: destination,
+	}
+}
+
+// applyConfig fills the render options that were not given in the commandline
+func (ri *RenderInput) applyConfig(config *RenderConfig, isSet func(name string) bool) {
+	if !isSet("mode") && len(config.Mode) > 0 {
+		ri.Mode = config.Mode
+	}
+	if !isSet("colorMode") && len(config.ColorMode) > 0 {
+		ri.ColorMode = config.ColorMode
+	}
+	if !isSet("colormap") && len(config.Colormap) > 0 {
+		ri.Colormap = config.Colormap
+	}
+
+	applyFloat64(&ri.XMin, config.XMin, isSet("xMin"))
+	applyFloat64(&ri.XMax, config.XMax, isSet("xMax"))
+	applyFloat64(&ri.YMin, config.YMin, isSet("yMin"))
+	applyFloat64(&ri.YMax, config.YMax, isSet("yMax"))
+	applyFloat64(&ri.ZMin, config.ZMin, isSet("zMin"))
+	applyFloat64(&ri.ZMax, config.ZMax, isSet("zMax"))
+	applyFloat64(&ri.Resolution, config.Resolution, isSet("resolution"))
+	applyFloat64(&ri.Grid, config.Grid, isSet("grid"))
+	applyFloat64(&ri.RangeRings, config.RangeRings, isSet("rangeRings"))
+	applyInt(&ri.AzimuthBins, config.AzimuthBins, isSet("azimuthBins"))
+	applyFloat64(&ri.RangeUnit, config.RangeUnit, isSet("rangeUnit"))
+	if !isSet("raw") && config.IsSaveRaw != nil {
+		ri.IsSaveRaw = *config.IsSaveRaw
+	}
+
+	if !isSet("cameras") && len(config.Cameras) > 0 {
+		ri.Cameras = *cli.NewStringSlice(config.Cameras...)
+	}
+	applyFloat64(&ri.DepthMin, config.DepthMin, isSet("depthMin"))
+	applyFloat64(&ri.DepthMax, config.DepthMax, isSet("depthMax"))
+	applyInt(&ri.ImageWidth, config.ImageWidth, isSet("imageWidth"))
+	applyInt(&ri.ImageHeight, config.ImageHeight, isSet("imageHeight"))
+	if !isSet("cameraImages") && len(config.CameraImages) > 0 {
+		ri.CameraImages = config.CameraImages
+	}
+	applyFloat64(&ri.MaxTimeOffset, config.MaxTimeOffset, isSet("maxTimeOffset"))
+	if !isSet("animation") && len(config.Animation) > 0 {
+		ri.Animation = config.Animation
+	}
+	applyFloat64(&ri.FPS, config.FPS, isSet("fps"))
+	if !isSet("eye") && len(config.Eye) > 0 {
+		ri.Eye = *cli.NewFloat64Slice(config.Eye...)
+	}
+	if !isSet("lookAt") && len(config.LookAt) > 0 {
+		ri.LookAt = *cli.NewFloat64Slice(config.LookAt...)
+	}
+	applyFloat64(&ri.FOV, config.FOV, isSet("fov"))
+	applyInt(&ri.PointSize, config.PointSize, isSet("pointSize"))
+}
+
+func applyFloat64(dest *float64, value *float64, isSet bool) {
+	if !isSet && value != nil {
+		*dest = *value
+	}
+}
@@ -1,90 +1,545 @@
 package global
 
 import (
+	"encoding/json"
 	"github.com/urfave/cli"
+	"strings"
+	"time"
 )
 
+// CLInput contains the commandline input of all subcommands
 type CLInput struct {
-	PcapFile     string
+	PcapFiles    cli.StringSlice
 	OutputPath   string
 	StartFrame   int
 	EndFrame     int
+	Stride       int
+	StartPacket  int
+	EndPacket    int
 	Channels     cli.StringSlice
 	Mkdirp       bool
 	IsSaveAsJSON bool
 	IsSaveAsPNG  bool
+	IsSaveImages bool
+	IsSaveAsPLY  bool
+	IsSaveAsPCD  bool
+	IsColorize   bool
+	DumpFormat   string
+	IsInfoAsJSON bool
+	ConfigFile   string
+	Sensors      []SensorConfig
+	Registry     cli.StringSlice
+	Vehicle      string
+	Render       RenderInput
+	Listen       string
+	AllowOrigins cli.StringSlice
+	IsLive       bool
+	DataPort     int
+	PositionPort int
+	Destination  string
+	Speed        float64
+	IsLoop       bool
+	OutputFile   string
+	StartTime    string
+	EndTime      string
+	SplitMinutes float64
+	PcapFormat   string
+	Jobs         int
+	Checkpoint   time.Duration
+	// BatchArgs is the subcommand with its flags that a batch runs on every capture
+	BatchArgs []string
+}
+
+// Actions contains the action of every subcommand
+type Actions struct {
+	Decode cli.ActionFunc
+	Info   cli.ActionFunc
+	Dump   cli.ActionFunc
+	Render cli.ActionFunc
+	Serve  cli.ActionFunc
+	Replay cli.ActionFunc
+	Trim   cli.ActionFunc
+	Split  cli.ActionFunc
+	Merge  cli.ActionFunc
+	Batch  cli.ActionFunc
+}
+
+// IsWhitelisted checks if the address is one of the whitelisted channels.
+// When no channel is given, the configured sensors are accepted, or all addresses without sensors.
+func (ui *CLInput) IsWhitelisted(address string) bool {
+	channels := ui.Channels.Value()
+	if len(channels) == 0 {
+		if len(ui.Sensors) > 0 {
+			_, ok := ui.GetSensor(address)
+			return ok
+		}
+		return true
+	}
+
+	return isChannel(channels, address)
+}
+
+// IsCameraWhitelisted checks if the camera address is one of the whitelisted channels.
+// The configured sensors are lidars, so all cameras are accepted when no channel is given.
+func (ui *CLInput) IsCameraWhitelisted(address string) bool {
+	channels := ui.Channels.Value()
+	return len(channels) == 0 || isChannel(channels, address)
+}
+
+func isChannel(channels []string, address string) bool {
+	for _, channel := range channels {
+		if channel == address {
+			return true
+		}
+	}
+	return false
 }
 
 // CreateApp returns a CLI app
-func (ui *CLInput) CreateApp(action func(c *cli.Context) error) *cli.App {
+func (ui *CLInput) CreateApp(actions Actions) *cli.App {
 	return &cli.App{
 		Name:                 "PCAP Decoder",
 		Usage:                "Decodes the lidar and camera information of a PCAP file",
 		EnableBashCompletion: true,
-		Action:               action,
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:        "pcapFile",
-				Aliases:     []string{"p"},
-				Value:       ui.PcapFile,
-				Usage:       "Full path of the PCAP file",
-				Destination: &(ui.PcapFile),
+		Commands: []*cli.Command{
+			{
+				Name:   "decode",
+				Usage:  "Decodes the lidar frames of a PCAP file",
+				Action: actions.Decode,
+				Flags: append([]cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputPathFlag(),
+					ui.mkdirpFlag(),
+					ui.channelsFlag(),
+					ui.registryFlag(),
+					ui.vehicleFlag(),
+					ui.startFrameFlag(),
+					ui.endFrameFlag(),
+					ui.checkpointFlag(),
+					&cli.BoolFlag{
+						Name:        "JSON",
+						Aliases:     []string{"j"},
+						Usage:       "Save pointcloud in JSON format",
+						Value:       ui.IsSaveAsJSON,
+						Destination: &(ui.IsSaveAsJSON),
+					},
+					&cli.BoolFlag{
+						Name:        "PNG",
+						Aliases:     []string{"png"},
+						Usage:       "Save pointcloud's bird's eye view in PNG format",
+						Value:       ui.IsSaveAsPNG,
+						Destination: &(ui.IsSaveAsPNG),
+					},
+					&cli.BoolFlag{
+						Name:        "images",
+						Usage:       "Save the JPEG images of the camera packets",
+						Value:       ui.IsSaveImages,
+						Destination: &(ui.IsSaveImages),
+					},
+					&cli.BoolFlag{
+						Name:        "PLY",
+						Usage:       "Save pointcloud in binary PLY format",
+						Value:       ui.IsSaveAsPLY,
+						Destination: &(ui.IsSaveAsPLY),
+					},
+					&cli.BoolFlag{
+						Name:        "PCD",
+						Usage:       "Save pointcloud in binary PCD format",
+						Value:       ui.IsSaveAsPCD,
+						Destination: &(ui.IsSaveAsPCD),
+					},
+					&cli.BoolFlag{
+						Name:        "colorize",
+						Usage:       "Color the PLY and PCD points with the time-nearest camera images",
+						Value:       ui.IsColorize,
+						Destination: &(ui.IsColorize),
+					},
+				}, append(ui.liveFlags(), ui.Render.cameraFlags()...)...),
+			},
+			{
+				Name:   "render",
+				Usage:  "Renders the lidar frames of a PCAP file into images",
+				Action: actions.Render,
+				Flags: append([]cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputPathFlag(),
+					ui.mkdirpFlag(),
+					ui.channelsFlag(),
+					ui.registryFlag(),
+					ui.vehicleFlag(),
+					ui.startFrameFlag(),
+					ui.endFrameFlag(),
+					ui.checkpointFlag(),
+					&cli.IntFlag{
+						Name:        "stride",
+						Value:       ui.Stride,
+						Usage:       "renders every n-th frame from the beginning frame",
+						Destination: &(ui.Stride),
+					},
+				}, append(ui.liveFlags(), ui.Render.flags()...)...),
 			},
-			&cli.StringFlag{
-				Name:        "outputPath",
-				Aliases:     []string{"o"},
-				Value:       ui.OutputPath,
-				Usage:       "location of the output files",
-				Destination: &(ui.OutputPath),
+			{
+				Name:   "info",
+				Usage:  "Summarizes the lidar sources of a PCAP file without decoding the frames",
+				Action: actions.Info,
+				Flags: []cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					&cli.BoolFlag{
+						Name:        "json",
+						Usage:       "Print the summary in JSON format",
+						Value:       ui.IsInfoAsJSON,
+						Destination: &(ui.IsInfoAsJSON),
+					},
+				},
 			},
-			&cli.IntFlag{
-				Name:        "startFrame",
-				Aliases:     []string{"s"},
-				Value:       ui.StartFrame,
-				Usage:       "index of the beginning frame",
-				Destination: &(ui.StartFrame),
+			{
+				Name:   "dump",
+				Usage:  "Writes the raw lidar packets of a PCAP file",
+				Action: actions.Dump,
+				Flags: []cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputPathFlag(),
+					ui.mkdirpFlag(),
+					ui.channelsFlag(),
+					&cli.StringFlag{
+						Name:        "format",
+						Aliases:     []string{"f"},
+						Value:       ui.DumpFormat,
+						Usage:       "output format, \"ndjson\" or \"csv\"",
+						Destination: &(ui.DumpFormat),
+					},
+					&cli.IntFlag{
+						Name:        "startPacket",
+						Aliases:     []string{"s"},
+						Value:       ui.StartPacket,
+						Usage:       "index of the first lidar packet to dump",
+						Destination: &(ui.StartPacket),
+					},
+					&cli.IntFlag{
+						Name:        "endPacket",
+						Aliases:     []string{"e"},
+						Value:       ui.EndPacket,
+						Usage:       "index of the last lidar packet to dump, -1 dumps until the end",
+						Destination: &(ui.EndPacket),
+					},
+				},
 			},
-			&cli.IntFlag{
-				Name:        "endFrame",
-				Aliases:     []string{"e"},
-				Value:       ui.EndFrame,
-				Usage:       "index of the end frame",
-				Destination: &(ui.EndFrame),
+			{
+				Name:   "replay",
+				Usage:  "Sends the lidar and position packets of a PCAP file to UDP ports at the recorded timing",
+				Action: actions.Replay,
+				Flags: append([]cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.channelsFlag(),
+					&cli.StringFlag{
+						Name:        "destination",
+						Aliases:     []string{"d"},
+						Value:       ui.Destination,
+						Usage:       "host name or IP address that receives the packets",
+						Destination: &(ui.Destination),
+					},
+					&cli.Float64Flag{
+						Name:        "speed",
+						Value:       ui.Speed,
+						Usage:       "multiplier of the recorded packet rate",
+						Destination: &(ui.Speed),
+					},
+					&cli.BoolFlag{
+						Name:        "loop",
+						Usage:       "restarts from the beginning of the file until interrupted",
+						Value:       ui.IsLoop,
+						Destination: &(ui.IsLoop),
+					},
+				}, ui.portFlags()...),
 			},
-			&cli.BoolFlag{
-				Name:        "mkdirp",
-				Aliases:     []string{"m"},
-				Usage:       "recursively creates the output folder ",
-				Required:    false,
-				Hidden:      false,
-				Value:       ui.Mkdirp,
-				Destination: &(ui.Mkdirp),
+			{
+				Name:   "trim",
+				Usage:  "Writes the packets of selected frames of a PCAP file into a new pcap or pcapng file",
+				Action: actions.Trim,
+				Flags: []cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputFileFlag(),
+					ui.channelsFlag(),
+					ui.startFrameFlag(),
+					ui.endFrameFlag(),
+					&cli.StringFlag{
+						Name:        "startTime",
+						Value:       ui.StartTime,
+						Usage:       "RFC 3339 time, or duration from the first frame, of the first frame, overrides the frame range",
+						Destination: &(ui.StartTime),
+					},
+					&cli.StringFlag{
+						Name:        "endTime",
+						Value:       ui.EndTime,
+						Usage:       "RFC 3339 time, or duration from the first frame, of the last frame, overrides the frame range",
+						Destination: &(ui.EndTime),
+					},
+				},
 			},
-			&cli.BoolFlag{
-				Name:        "JSON",
-				Aliases:     []string{"j"},
-				Usage:       "Save pointcloud in JSON format",
-				Required:    false,
-				Hidden:      false,
-				Value:       ui.IsSaveAsJSON,
-				Destination: &(ui.IsSaveAsJSON),
+			{
+				Name:   "split",
+				Usage:  "Writes the packets of each lidar source of a PCAP file into its own capture",
+				Action: actions.Split,
+				Flags: []cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputPathFlag(),
+					ui.mkdirpFlag(),
+					ui.channelsFlag(),
+					ui.registryFlag(),
+					ui.vehicleFlag(),
+					&cli.Float64Flag{
+						Name:        "minutes",
+						Value:       ui.SplitMinutes,
+						Usage:       "starts new captures every n minutes, 0 writes one capture per source",
+						Destination: &(ui.SplitMinutes),
+					},
+					ui.captureFormatFlag(),
+				},
 			},
-			&cli.BoolFlag{
-				Name:        "PNG",
-				Aliases:     []string{"png"},
-				Usage:       "Save pointcloud's bird's eye view in PNG format",
-				Hidden:      false,
-				Value:       ui.IsSaveAsJSON,
-				Destination: &(ui.IsSaveAsJSON),
+			{
+				Name:      "batch",
+				Usage:     "Runs a subcommand on every capture of the folders or globs, each in its own output folder",
+				ArgsUsage: "<decode|render|dump|split> [flags]",
+				Action:    actions.Batch,
+				Flags: []cli.Flag{
+					ui.pcapFileFlag(),
+					ui.outputPathFlag(),
+					ui.mkdirpFlag(),
+					&cli.IntFlag{
+						Name:        "jobs",
+						Aliases:     []string{"j"},
+						Value:       ui.Jobs,
+						Usage:       "number of captures processed at the same time",
+						Destination: &(ui.Jobs),
+					},
+				},
 			},
-			&cli.StringSliceFlag{
-				Name:     "channels",
-				Aliases:  []string{"c"},
-				Usage:    "IP addresses to whitelist",
-				Required: true,
-				Hidden:   false,
-				Value:    &(ui.Channels),
+			{
+				Name:   "merge",
+				Usage:  "Writes the packets of several PCAP files into one capture, ordered by their record time",
+				Action: actions.Merge,
+				Flags: []cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.outputFileFlag(),
+				},
 			},
+			{
+				Name:   "serve",
+				Usage:  "Serves a web viewer of the lidar frames of a PCAP file",
+				Action: actions.Serve,
+				Flags: append([]cli.Flag{
+					ui.configFlag(),
+					ui.pcapFileFlag(),
+					ui.channelsFlag(),
+					ui.registryFlag(),
+					ui.vehicleFlag(),
+					&cli.StringFlag{
+						Name:        "listen",
+						Aliases:     []string{"l"},
+						Value:       ui.Listen,
+						Usage:       "host:port of the HTTP server",
+						Destination: &(ui.Listen),
+					},
+					&cli.StringSliceFlag{
+						Name:        "allowOrigin",
+						Usage:       "origins of the web pages of other hosts that may open the WebSocket stream, * allows all",
+						Destination: &(ui.AllowOrigins),
+					},
+				}, ui.liveFlags()...),
+			},
+		},
+	}
+}
+
+func (ui *CLInput) configFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "config",
+		Value:       ui.ConfigFile,
+		Usage:       "YAML, TOML or JSON job configuration file, overridden by the other flags",
+		Destination: &(ui.ConfigFile),
+	}
+}
+
+func (ui *CLInput) pcapFileFlag() cli.Flag {
+	return &cli.GenericFlag{
+		Name:    "pcapFile",
+		Aliases: []string{"p"},
+		Usage:   "Full path or glob of the PCAP files, compressed or not, or - for the standard input. The packets of several files are merged by their record time",
+		Value:   &pathList{destination: &(ui.PcapFiles)},
+	}
+}
+
+func (ui *CLInput) outputPathFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "outputPath",
+		Aliases:     []string{"o"},
+		Value:       ui.OutputPath,
+		Usage:       "location of the output files",
+		Destination: &(ui.OutputPath),
+	}
+}
+
+func (ui *CLInput) outputFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "outputFile",
+		Aliases:     []string{"o"},
+		Value:       ui.OutputFile,
+		Usage:       "output capture file, in the pcapng format for a .pcapng extension",
+		Destination: &(ui.OutputFile),
+	}
+}
+
+func (ui *CLInput) captureFormatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "format",
+		Aliases:     []string{"f"},
+		Value:       ui.PcapFormat,
+		Usage:       "format of the output captures, \"pcap\" or \"pcapng\"",
+		Destination: &(ui.PcapFormat),
+	}
+}
+
+func (ui *CLInput) mkdirpFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:        "mkdirp",
+		Aliases:     []string{"m"},
+		Usage:       "recursively creates the output folder ",
+		Value:       ui.Mkdirp,
+		Destination: &(ui.Mkdirp),
+	}
+}
+
+func (ui *CLInput) channelsFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:        "channels",
+		Aliases:     []string{"c"},
+		Usage:       "IP addresses to whitelist, all sources are accepted when empty",
+		Destination: &(ui.Channels),
+	}
+}
+
+// pathList is the value of a list flag whose values are repeated instead of separated by commas,
+// as a comma may be part of a path or name
+type pathList struct {
+	destination *cli.StringSlice
+	isSet       bool
+}
+
+// pathListPrefix marks the serialized values that the parser copies from a flag name to its aliases
+const pathListPrefix = "pathList:"
+
+// Set adds a value, the first one replaces the default values. A serialized list replaces all values.
+func (pl *pathList) Set(value string) error {
+	if strings.HasPrefix(value, pathListPrefix) {
+		var values []string
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(value, pathListPrefix)), &values); err != nil {
+			return err
+		}
+		*pl.destination = *cli.NewStringSlice(values...)
+		pl.isSet = true
+		return nil
+	}
+
+	values := pl.destination.Value()
+	if !pl.isSet {
+		values = nil
+		pl.isSet = true
+	}
+	*pl.destination = *cli.NewStringSlice(append(values, value)...)
+	return nil
+}
+
+// Serialize returns the values in the form that Set replaces them with
+func (pl *pathList) Serialize() string {
+	data, _ := json.Marshal(pl.destination.Value())
+	return pathListPrefix + string(data)
+}
+
+func (pl *pathList) String() string {
+	if pl == nil || pl.destination == nil {
+		return ""
+	}
+	return strings.Join(pl.destination.Value(), ", ")
+}
+
+func (ui *CLInput) startFrameFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:        "startFrame",
+		Aliases:     []string{"s"},
+		Value:       ui.StartFrame,
+		Usage:       "index of the beginning frame",
+		Destination: &(ui.StartFrame),
+	}
+}
+
+func (ui *CLInput) endFrameFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:        "endFrame",
+		Aliases:     []string{"e"},
+		Value:       ui.EndFrame,
+		Usage:       "index of the end frame, -1 decodes until the end",
+		Destination: &(ui.EndFrame),
+	}
+}
+
+func (ui *CLInput) checkpointFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:        "checkpoint",
+		Value:       ui.Checkpoint,
+		Usage:       "saves the decoding state into the output folder at this interval, a rerun resumes from it, 0 disables",
+		Destination: &(ui.Checkpoint),
+	}
+}
+
+func (ui *CLInput) registryFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:        "registry",
+		Usage:       "YAML or JSON files of the vehicle sensor calibrations",
+		Destination: &(ui.Registry),
+	}
+}
+
+func (ui *CLInput) vehicleFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "vehicle",
+		Value:       ui.Vehicle,
+		Usage:       "ID of the registry vehicle that recorded the PCAP file",
+		Destination: &(ui.Vehicle),
+	}
+}
+
+func (ui *CLInput) liveFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.BoolFlag{
+			Name:        "live",
+			Usage:       "Decode the packets received on the UDP ports instead of a PCAP file, until interrupted",
+			Value:       ui.IsLive,
+			Destination: &(ui.IsLive),
+		},
+	}, ui.portFlags()...)
+}
+
+func (ui *CLInput) portFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:        "dataPort",
+			Value:       ui.DataPort,
+			Usage:       "UDP port of the lidar packets",
+			Destination: &(ui.DataPort),
+		},
+		&cli.IntFlag{
+			Name:        "positionPort",
+			Value:       ui.PositionPort,
+			Usage:       "UDP port of the position packets, 0 ignores them",
+			Destination: &(ui.PositionPort),
 		},
 	}
 }
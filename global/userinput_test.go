@@ -0,0 +1,88 @@
+package global
+
+import (
+	"github.com/urfave/cli"
+	"reflect"
+	"testing"
+)
+
+// runApp runs the app on the arguments with a copy of the default user input, and returns the subcommand that ran
+func runApp(t *testing.T, args ...string) (string, *CLInput) {
+	t.Helper()
+	ui := UserInput
+	var command string
+	action := func(name string) cli.ActionFunc {
+		return func(c *cli.Context) error {
+			command = name
+			return nil
+		}
+	}
+
+	app := ui.CreateApp(Actions{
+		Decode: action("decode"),
+		Info:   action("info"),
+		Dump:   action("dump"),
+		Render: action("render"),
+		Serve:  action("serve"),
+		Replay: action("replay"),
+		Trim:   action("trim"),
+		Split:  action("split"),
+		Merge:  action("merge"),
+		Batch:  action("batch")})
+	if err := app.Run(append([]string{"pcapDecoder"}, args...)); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return command, &ui
+}
+
+func TestCreateAppRunsSubcommands(t *testing.T) {
+	command, ui := runApp(t, "decode", "-p", "a.pcap", "-o", "out", "-c", "10.0.0.1", "-s", "2", "-e", "5", "--PLY")
+	if command != "decode" {
+		t.Fatalf("ran %q, expected decode", command)
+	}
+	if !reflect.DeepEqual(ui.PcapFiles.Value(), []string{"a.pcap"}) || ui.OutputPath != "out" ||
+		!reflect.DeepEqual(ui.Channels.Value(), []string{"10.0.0.1"}) || ui.StartFrame != 2 || ui.EndFrame != 5 || !ui.IsSaveAsPLY {
+		t.Errorf("decode flags are not set: %+v", ui)
+	}
+
+	// the flags of a subcommand keep their defaults when they are not given
+	command, ui = runApp(t, "info", "--json", "-p", "a.pcap")
+	if command != "info" || !ui.IsInfoAsJSON || ui.EndFrame != -1 {
+		t.Errorf("ran %q with json %t and end frame %d", command, ui.IsInfoAsJSON, ui.EndFrame)
+	}
+
+	command, ui = runApp(t, "dump", "-p", "a.pcap", "-o", "out", "--format", "csv", "--startPacket", "10", "--endPacket", "20")
+	if command != "dump" || ui.DumpFormat != "csv" || ui.StartPacket != 10 || ui.EndPacket != 20 {
+		t.Errorf("ran %q with format %q and packets %d to %d", command, ui.DumpFormat, ui.StartPacket, ui.EndPacket)
+	}
+
+	for _, name := range []string{"render", "serve", "replay", "trim", "split", "merge"} {
+		if command, _ := runApp(t, name); command != name {
+			t.Errorf("ran %q, expected %s", command, name)
+		}
+	}
+}
+
+func TestCreateAppParsesListFlags(t *testing.T) {
+	// the vectors keep their comma separated values, the paths and cameras keep their commas
+	_, ui := runApp(t, "render", "--eye=-20,0,5", "--lookAt", "0,-15,8", "-p", "/a,b.pcap", "-p", "c.pcap",
+		"--cameras", "front,left", "-c", "10.0.0.1,10.0.0.2")
+	if !reflect.DeepEqual(ui.PcapFiles.Value(), []string{"/a,b.pcap", "c.pcap"}) {
+		t.Errorf("pcap files are %q", ui.PcapFiles.Value())
+	}
+	if !reflect.DeepEqual(ui.Render.Cameras.Value(), []string{"front,left"}) {
+		t.Errorf("cameras are %q", ui.Render.Cameras.Value())
+	}
+	if !reflect.DeepEqual(ui.Channels.Value(), []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("channels are %q", ui.Channels.Value())
+	}
+	if !reflect.DeepEqual(ui.Render.Eye.Value(), []float64{-20, 0, 5}) || !reflect.DeepEqual(ui.Render.LookAt.Value(), []float64{0, -15, 8}) {
+		t.Errorf("eye is %v and look at is %v", ui.Render.Eye.Value(), ui.Render.LookAt.Value())
+	}
+
+	// the equal sign form of a path and the repeated flags of a subcommand without defaults
+	_, ui = runApp(t, "decode", "--pcapFile=/d,e.pcap", "-o", "out", "--registry", "a.yaml", "--registry", "b.yaml")
+	if !reflect.DeepEqual(ui.PcapFiles.Value(), []string{"/d,e.pcap"}) || !reflect.DeepEqual(ui.Registry.Value(), []string{"a.yaml", "b.yaml"}) {
+		t.Errorf("pcap files are %q and registries are %q", ui.PcapFiles.Value(), ui.Registry.Value())
+	}
+}
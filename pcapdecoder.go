@@ -1,37 +1,543 @@
 package main
 
 import (
-	"clarity/lib"
+	"fmt"
 	"github.com/bldulam1/pcap-decoder/global"
 	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"github.com/bldulam1/pcap-decoder/server"
 	"github.com/urfave/cli"
+	"net"
 	"os"
+	"path/filepath"
 	"pcap-decoder/path"
+	"strings"
+	"time"
 )
 
-func validatePaths() {
-	// Check if PCAP file exists
-	if !path.Exists(global.UserInput.PcapFile) {
-		panic(global.UserInput.PcapFile + " does not exist")
+// Exit codes of the application
+const (
+	exitFailure      = 1
+	exitInvalidInput = 2
+)
+
+// loadConfig applies the job configuration file to the user input
+func loadConfig(c *cli.Context) error {
+	if len(global.UserInput.ConfigFile) == 0 {
+		return nil
+	}
+
+	config, err := global.LoadConfig(global.UserInput.ConfigFile)
+	if err != nil {
+		return cli.Exit(err, exitInvalidInput)
+	}
+
+	global.UserInput.ApplyConfig(config, c.IsSet)
+	return nil
+}
+
+// loadRegistry selects the sensor calibrations of the vehicle
+func loadRegistry() error {
+	ui := &global.UserInput
+	if err := registry.Setup(ui.Registry.Value(), ui.Vehicle, ui.Sensors); err != nil {
+		return cli.Exit(err, exitInvalidInput)
+	}
+	return nil
+}
+
+// validatePcapFile checks that the PCAP files exist and expands the globs
+func validatePcapFile() error {
+	patterns := global.UserInput.PcapFiles.Value()
+	if len(patterns) == 0 {
+		return cli.Exit("pcapFile is required", exitInvalidInput)
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		if pattern == pcapdecoder.StdinFile {
+			if len(patterns) > 1 {
+				return cli.Exit("the standard input must be the only pcapFile", exitInvalidInput)
+			}
+			files = append(files, pattern)
+			continue
+		}
+
+		// Check if PCAP file exists
+		if path.Exists(pattern) {
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			return cli.Exit(pattern+" does not exist", exitInvalidInput)
+		}
+		files = append(files, matches...)
+	}
+
+	global.UserInput.PcapFiles = *cli.NewStringSlice(files...)
+	return nil
+}
+
+// validateSeekableInput rejects the standard input for the subcommands that read the capture more than once
+func validateSeekableInput() error {
+	for _, fileName := range global.UserInput.PcapFiles.Value() {
+		if fileName == pcapdecoder.StdinFile {
+			return cli.Exit("the standard input can only be read once, pcapFile must be a file", exitInvalidInput)
+		}
+	}
+	return nil
+}
+
+// validateCheckpoint rejects the checkpoints of the inputs and outputs that cannot be resumed
+func validateCheckpoint() error {
+	ui := &global.UserInput
+	if ui.Checkpoint <= 0 {
+		return nil
+	}
+	if ui.Checkpoint < pcapdecoder.MinCheckpointInterval {
+		return cli.Exit(fmt.Sprintf("--checkpoint must be at least %s", pcapdecoder.MinCheckpointInterval), exitInvalidInput)
+	}
+	if ui.IsLive {
+		return cli.Exit("--checkpoint needs a PCAP file, a live decoding cannot be resumed", exitInvalidInput)
+	}
+	if len(ui.Render.Animation) > 0 || ui.IsColorize {
+		return cli.Exit("--checkpoint does not keep the state of --animation and --colorize", exitInvalidInput)
+	}
+	return validateSeekableInput()
+}
+
+// validateInput checks the PCAP file, or the UDP ports in live mode
+func validateInput() error {
+	if !global.UserInput.IsLive {
+		return validatePcapFile()
+	}
+	return validatePorts()
+}
+
+func validatePorts() error {
+	ui := &global.UserInput
+	if ui.DataPort <= 0 || ui.DataPort > 65535 || ui.PositionPort < 0 || ui.PositionPort > 65535 {
+		return cli.Exit("dataPort and positionPort must be UDP ports", exitInvalidInput)
+	}
+	return nil
+}
+
+func validateOutputPath() error {
+	if len(global.UserInput.OutputPath) == 0 {
+		return cli.Exit("outputPath is required", exitInvalidInput)
 	}
 
 	// Check if Output path exists
 	if !path.Exists(global.UserInput.OutputPath) {
-		if global.UserInput.Mkdirp {
-			os.MkdirAll(global.UserInput.OutputPath, os.ModePerm)
-		} else {
-			panic(global.UserInput.OutputPath + " does not exist")
+		if !global.UserInput.Mkdirp {
+			return cli.Exit(global.UserInput.OutputPath+" does not exist", exitInvalidInput)
+		}
+		if err := os.MkdirAll(global.UserInput.OutputPath, os.ModePerm); err != nil {
+			return cli.Exit(err, exitInvalidInput)
+		}
+	}
+	return nil
+}
+
+func validateOutputFile() error {
+	if len(global.UserInput.OutputFile) == 0 {
+		return cli.Exit("outputFile is required", exitInvalidInput)
+	}
+	for _, fileName := range global.UserInput.PcapFiles.Value() {
+		if filepath.Clean(global.UserInput.OutputFile) == filepath.Clean(fileName) {
+			return cli.Exit("outputFile must not be a pcapFile", exitInvalidInput)
 		}
 	}
+	return nil
+}
+
+func validatePcapFormat() error {
+	if format := global.UserInput.PcapFormat; format != "pcap" && format != "pcapng" {
+		return cli.Exit(fmt.Sprintf("capture format %q is not supported", format), exitInvalidInput)
+	}
+	return nil
+}
+
+func validateRange(name string, start int, end int) error {
+	if start < 0 {
+		return cli.Exit(fmt.Sprintf("start%s must not be negative", name), exitInvalidInput)
+	}
+	if end >= 0 && end < start {
+		return cli.Exit(fmt.Sprintf("end%s must not be less than start%s", name, name), exitInvalidInput)
+	}
+	return nil
 }
 
 func main() {
-	app := global.UserInput.CreateApp(runApp)
-	lib.DisplayError(app.Run(os.Args))
+	app := global.UserInput.CreateApp(global.Actions{
+		Decode: runDecode,
+		Info:   runInfo,
+		Dump:   runDump,
+		Render: runRender,
+		Serve:  runServe,
+		Replay: runReplay,
+		Trim:   runTrim,
+		Split:  runSplit,
+		Merge:  runMerge,
+		Batch:  runBatch})
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
 }
 
-func runApp(c *cli.Context) error {
-	validatePaths()
-	pcapdecoder.ParsePCAP()
+// parse decodes the PCAP file, or the UDP packets in live mode
+func parse() error {
+	if global.UserInput.IsLive {
+		return pcapdecoder.ParseLive()
+	}
+	return pcapdecoder.ParsePCAP()
+}
+
+func runDecode(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validateInput(); err != nil {
+		return err
+	}
+	if err := validateOutputPath(); err != nil {
+		return err
+	}
+	if err := validateRange("Frame", global.UserInput.StartFrame, global.UserInput.EndFrame); err != nil {
+		return err
+	}
+	if err := validateCheckpoint(); err != nil {
+		return err
+	}
+	if err := loadRegistry(); err != nil {
+		return err
+	}
+
+	if global.UserInput.IsSaveAsPNG {
+		renderer, err := pcapdecoder.NewBEVRenderer(global.UserInput.Render)
+		if err != nil {
+			return cli.Exit(err, exitInvalidInput)
+		}
+		pcapdecoder.AddFrameHandler(renderer.SaveFrame)
+	}
+	if global.UserInput.IsSaveImages {
+		pcapdecoder.AddCameraHandler(pcapdecoder.SaveCameraFrame)
+	}
+	colorizer, err := addPointCloudWriters()
+	if err != nil {
+		return cli.Exit(err, exitInvalidInput)
+	}
+
+	if err := parse(); err != nil {
+		return err
+	}
+	if colorizer != nil {
+		return colorizer.Close()
+	}
 	return nil
 }
+
+// addPointCloudWriters registers the PLY and PCD outputs, with the colorizer fed by the camera packets
+func addPointCloudWriters() (*pcapdecoder.Colorizer, error) {
+	ui := &global.UserInput
+
+	var formats []string
+	if ui.IsSaveAsPLY {
+		formats = append(formats, "ply")
+	}
+	if ui.IsSaveAsPCD {
+		formats = append(formats, "pcd")
+	}
+
+	var colorizer *pcapdecoder.Colorizer
+	if ui.IsColorize {
+		if len(formats) == 0 {
+			return nil, fmt.Errorf("--colorize needs --PLY or --PCD")
+		}
+
+		var err error
+		if colorizer, err = pcapdecoder.NewColorizer(ui.Render); err != nil {
+			return nil, err
+		}
+		pcapdecoder.AddCameraHandler(colorizer.AddCameraFrame)
+	}
+
+	for _, format := range formats {
+		writer, err := pcapdecoder.NewPointCloudWriter(format, colorizer)
+		if err != nil {
+			return nil, err
+		}
+		pcapdecoder.AddFrameHandler(writer.SaveFrame)
+	}
+	return colorizer, nil
+}
+
+func runRender(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validateInput(); err != nil {
+		return err
+	}
+	if err := validateOutputPath(); err != nil {
+		return err
+	}
+	if err := validateRange("Frame", global.UserInput.StartFrame, global.UserInput.EndFrame); err != nil {
+		return err
+	}
+	if err := validateCheckpoint(); err != nil {
+		return err
+	}
+	if err := loadRegistry(); err != nil {
+		return err
+	}
+
+	if global.UserInput.Stride < 1 {
+		return cli.Exit("stride must be positive", exitInvalidInput)
+	}
+
+	if len(global.UserInput.Render.Animation) > 0 {
+		animator, err := pcapdecoder.NewAnimator(global.UserInput.Render)
+		if err != nil {
+			return cli.Exit(err, exitInvalidInput)
+		}
+		pcapdecoder.AddFrameHandler(animator.AddFrame)
+
+		if err := parse(); err != nil {
+			return err
+		}
+		return animator.Close()
+	}
+
+	renderer, err := pcapdecoder.NewFrameRenderer(global.UserInput.Render)
+	if err != nil {
+		return cli.Exit(err, exitInvalidInput)
+	}
+	pcapdecoder.AddFrameHandler(renderer)
+
+	return parse()
+}
+
+func runInfo(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+
+	info, err := pcapdecoder.ScanPCAP()
+	if err != nil {
+		return err
+	}
+
+	if global.UserInput.IsInfoAsJSON {
+		return info.WriteJSON(os.Stdout)
+	}
+	return info.WriteText(os.Stdout)
+}
+
+func runDump(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+	if err := validateOutputPath(); err != nil {
+		return err
+	}
+	if err := validateRange("Packet", global.UserInput.StartPacket, global.UserInput.EndPacket); err != nil {
+		return err
+	}
+	if format := global.UserInput.DumpFormat; format != "ndjson" && format != "csv" {
+		return cli.Exit(fmt.Sprintf("dump format %q is not supported", format), exitInvalidInput)
+	}
+
+	return pcapdecoder.DumpPCAP()
+}
+
+func runServe(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if global.UserInput.IsLive {
+		if err := validatePorts(); err != nil {
+			return err
+		}
+	} else {
+		if err := validatePcapFile(); err != nil {
+			return err
+		}
+		if err := validateSeekableInput(); err != nil {
+			return err
+		}
+	}
+	if err := loadRegistry(); err != nil {
+		return err
+	}
+
+	allowedOrigins := global.UserInput.AllowOrigins.Value()
+	if global.UserInput.IsLive {
+		return serveLive(allowedOrigins)
+	}
+
+	index, err := pcapdecoder.IndexPCAP(global.UserInput.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	for _, source := range index.Sources {
+		fmt.Fprintf(os.Stderr, "%s: %d frames\n", source.Name, source.FrameCount)
+	}
+
+	fmt.Fprintf(os.Stderr, "serving %s on http://%s\n", strings.Join(global.UserInput.PcapFiles.Value(), ", "), global.UserInput.Listen)
+	return server.New(index, allowedOrigins).HTTPServer(global.UserInput.Listen).ListenAndServe()
+}
+
+// serveLive streams the frames of the live decoder to the viewer until the end frame or an interrupt
+func serveLive(allowedOrigins []string) error {
+	listener, err := net.Listen("tcp", global.UserInput.Listen)
+	if err != nil {
+		return err
+	}
+
+	s := server.New(nil, allowedOrigins)
+	httpServer := s.HTTPServer(global.UserInput.Listen)
+	defer httpServer.Close()
+	go httpServer.Serve(listener)
+
+	fmt.Fprintf(os.Stderr, "serving the live frames on http://%s\n", global.UserInput.Listen)
+	pcapdecoder.AddFrameHandler(s.AddFrame)
+	defer s.Close()
+	return pcapdecoder.ParseLive()
+}
+
+func runReplay(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+
+	if global.UserInput.IsLoop {
+		if err := validateSeekableInput(); err != nil {
+			return err
+		}
+	}
+	if global.UserInput.Speed <= 0 {
+		return cli.Exit("speed must be positive", exitInvalidInput)
+	}
+	if err := validatePorts(); err != nil {
+		return err
+	}
+
+	return pcapdecoder.ReplayPCAP()
+}
+
+func runTrim(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+	if err := validateSeekableInput(); err != nil {
+		return err
+	}
+	if err := validateOutputFile(); err != nil {
+		return err
+	}
+	if err := validateRange("Frame", global.UserInput.StartFrame, global.UserInput.EndFrame); err != nil {
+		return err
+	}
+	for _, value := range []string{global.UserInput.StartTime, global.UserInput.EndTime} {
+		if _, err := pcapdecoder.ParseTime(value, time.Time{}); err != nil {
+			return cli.Exit(err, exitInvalidInput)
+		}
+	}
+
+	return pcapdecoder.TrimPCAP()
+}
+
+func runSplit(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+	if err := validateOutputPath(); err != nil {
+		return err
+	}
+	if err := validatePcapFormat(); err != nil {
+		return err
+	}
+	if global.UserInput.SplitMinutes < 0 {
+		return cli.Exit("minutes must not be negative", exitInvalidInput)
+	}
+	if err := loadRegistry(); err != nil {
+		return err
+	}
+
+	return pcapdecoder.SplitPCAP()
+}
+
+func runMerge(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+	if err := validateOutputFile(); err != nil {
+		return err
+	}
+
+	return pcapdecoder.MergePCAP()
+}
+
+// batchCommands are the subcommands that a batch runs, the ones that write into an output path
+var batchCommands = []string{"decode", "render", "dump", "split"}
+
+func runBatch(c *cli.Context) error {
+	ui := &global.UserInput
+	if err := validatePcapFile(); err != nil {
+		return err
+	}
+	if err := validateSeekableInput(); err != nil {
+		return err
+	}
+	if err := validateOutputPath(); err != nil {
+		return err
+	}
+	if ui.Jobs < 1 {
+		return cli.Exit("jobs must be positive", exitInvalidInput)
+	}
+
+	ui.BatchArgs = c.Args().Slice()
+	if len(ui.BatchArgs) == 0 || !isBatchCommand(ui.BatchArgs[0]) {
+		return cli.Exit("batch needs one of the subcommands "+strings.Join(batchCommands, ", "), exitInvalidInput)
+	}
+	for _, arg := range ui.BatchArgs[1:] {
+		// the batch sets the input and output of every capture
+		name := strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-")
+		if strings.HasPrefix(arg, "-") && (name == "pcapFile" || name == "p" || name == "outputPath" || name == "o") {
+			return cli.Exit("pcapFile and outputPath are flags of the batch, not of its subcommand", exitInvalidInput)
+		}
+	}
+
+	return pcapdecoder.BatchPCAP()
+}
+
+func isBatchCommand(name string) bool {
+	for _, command := range batchCommands {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,433 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/lzw"
+	"encoding/binary"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// rangeColorMax is the range in meters of the lower end of the colormap in the range animations
+	rangeColorMax = 100
+	// ringHeight is the pixel height of a ring in the range animations
+	ringHeight = 8
+)
+
+var labelColor = color.RGBA{255, 255, 255, 255}
+
+// Animator streams the rendered frames of each lidar source into an animated GIF or an MJPEG AVI
+type Animator struct {
+	options    global.RenderInput
+	render     func(ls *LidarSource, frame *LidarFrame) *image.RGBA
+	animations map[string]animation
+}
+
+// animation is the output file of a lidar source
+type animation interface {
+	AddFrame(m *image.RGBA) error
+	Close() error
+}
+
+// NewAnimator creates an Animator of the "bev", "range" or "perspective" render mode
+func NewAnimator(options global.RenderInput) (*Animator, error) {
+	if options.Animation != "gif" && options.Animation != "avi" {
+		return nil, fmt.Errorf("animation %q is not supported", options.Animation)
+	}
+	if options.FPS <= 0 {
+		return nil, fmt.Errorf("frame rate must be positive")
+	}
+
+	a := &Animator{options: options, animations: make(map[string]animation)}
+
+	switch options.Mode {
+	case "bev":
+		renderer, err := NewBEVRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		a.render = renderer.Render
+	case "range":
+		if _, err := NewRangeRenderer(options); err != nil {
+			return nil, err
+		}
+		colormap, err := GetColormap(options.Colormap)
+		if err != nil {
+			return nil, err
+		}
+		a.render = func(ls *LidarSource, frame *LidarFrame) *image.RGBA {
+			ri := NewRangeImage(frame, options.AzimuthBins)
+			if ri.Rings == 0 {
+				return nil
+			}
+			return ri.ColorImage(colormap, rangeColorMax, ringHeight)
+		}
+	case "perspective":
+		renderer, err := NewPerspectiveRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		a.render = renderer.Render
+	default:
+		return nil, fmt.Errorf("render mode %q can not be animated", options.Mode)
+	}
+
+	return a, nil
+}
+
+// AddFrame renders the frame with its index and time, and appends it to the animation of the source
+func (a *Animator) AddFrame(ls *LidarSource, frame *LidarFrame) error {
+	m := a.render(ls, frame)
+	if m == nil {
+		return nil
+	}
+
+	drawLabel(m,
+		fmt.Sprintf("%s  frame %d", ls.Name(), frame.Index),
+		frame.Time.UTC().Format("2006-01-02 15:04:05.000"))
+
+	anim, ok := a.animations[ls.ID()]
+	if !ok {
+		var err error
+		fileName := filepath.Join(global.UserInput.OutputPath, fmt.Sprintf("%s-%s.%s", ls.Name(), a.options.Mode, a.options.Animation))
+		if anim, err = a.newAnimation(fileName, m.Bounds()); err != nil {
+			return err
+		}
+		a.animations[ls.ID()] = anim
+	}
+
+	return anim.AddFrame(m)
+}
+
+func (a *Animator) newAnimation(fileName string, bounds image.Rectangle) (animation, error) {
+	if a.options.Animation == "gif" {
+		return newGIFWriter(fileName, bounds, int(math.Round(100/a.options.FPS)))
+	}
+	return newAVIWriter(fileName, bounds.Dx(), bounds.Dy(), a.options.FPS)
+}
+
+// Close writes the animations of all sources
+func (a *Animator) Close() error {
+	for _, anim := range a.animations {
+		if err := anim.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawLabel writes the lines of text on a dark box at the top left corner of the image
+func drawLabel(m *image.RGBA, lines ...string) {
+	face := basicfont.Face7x13
+
+	width := 0
+	for _, line := range lines {
+		if lineWidth := font.MeasureString(face, line).Ceil(); lineWidth > width {
+			width = lineWidth
+		}
+	}
+
+	box := image.Rect(0, 0, width+8, len(lines)*face.Height+6).Intersect(m.Bounds())
+	draw.Draw(m, box, &image.Uniform{color.RGBA{0, 0, 0, 160}}, image.Point{}, draw.Over)
+
+	d := font.Drawer{
+		Dst:  m,
+		Src:  &image.Uniform{labelColor},
+		Face: face}
+	for i, line := range lines {
+		d.Dot = fixed.P(4, 3+face.Ascent+i*face.Height)
+		d.DrawString(line)
+	}
+}
+
+// ColorImage returns the ranges colored by the colormap, near points get the upper end of the colormap.
+// Each ring is repeated into rows of the given height.
+func (ri *RangeImage) ColorImage(colormap Colormap, maxRange float64, rowHeight int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, ri.Bins, ri.Rings*rowHeight))
+	draw.Draw(m, m.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+
+	for index, distance := range ri.Range {
+		if distance == 0 {
+			continue
+		}
+		c := colormap(math.Max(0, maxRange-float64(distance)) / maxRange)
+
+		row := index / ri.Bins
+		for y := row * rowHeight; y < (row+1)*rowHeight; y++ {
+			m.SetRGBA(index%ri.Bins, y, c)
+		}
+	}
+	return m
+}
+
+// gifWriter streams the frames into an animated GIF file with the Plan9 palette as global color table.
+// The frames are drawn into the size of the first one.
+type gifWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	bounds image.Rectangle
+	delay  int
+	frame  *image.Paletted
+}
+
+func newGIFWriter(fileName string, bounds image.Rectangle, delay int) (*gifWriter, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	gw := &gifWriter{
+		f:      f,
+		w:      bufio.NewWriter(f),
+		bounds: bounds,
+		delay:  delay,
+		frame:  image.NewPaletted(bounds, palette.Plan9)}
+
+	// logical screen with a global color table of 256 colors
+	gw.w.WriteString("GIF89a")
+	binary.Write(gw.w, binary.LittleEndian, []uint16{uint16(bounds.Dx()), uint16(bounds.Dy())})
+	gw.w.Write([]byte{0xF7, 0, 0})
+	for _, c := range palette.Plan9 {
+		r, g, b, _ := c.RGBA()
+		gw.w.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+	}
+	// application extension that loops forever
+	gw.w.Write([]byte{0x21, 0xFF, 0x0B})
+	gw.w.WriteString("NETSCAPE2.0")
+	gw.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+
+	if err := gw.w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gw, nil
+}
+
+func (gw *gifWriter) AddFrame(m *image.RGBA) error {
+	draw.Draw(gw.frame, gw.frame.Bounds(), m, m.Bounds().Min, draw.Src)
+
+	// graphic control extension with the delay, and the image descriptor of the whole screen
+	gw.w.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(gw.delay), byte(gw.delay >> 8), 0x00, 0x00, 0x2C})
+	binary.Write(gw.w, binary.LittleEndian, []uint16{0, 0, uint16(gw.bounds.Dx()), uint16(gw.bounds.Dy())})
+	gw.w.Write([]byte{0x00, 0x08})
+
+	blocks := &gifBlockWriter{w: gw.w}
+	lzwWriter := lzw.NewWriter(blocks, lzw.LSB, 8)
+	for y := 0; y < gw.bounds.Dy(); y++ {
+		row := gw.frame.Pix[y*gw.frame.Stride : y*gw.frame.Stride+gw.bounds.Dx()]
+		if _, err := lzwWriter.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := lzwWriter.Close(); err != nil {
+		return err
+	}
+	if err := blocks.Close(); err != nil {
+		return err
+	}
+	return gw.w.Flush()
+}
+
+func (gw *gifWriter) Close() error {
+	defer gw.f.Close()
+
+	gw.w.WriteByte(0x3B)
+	return gw.w.Flush()
+}
+
+// gifBlockWriter splits the LZW data of a GIF frame into sub-blocks of up to 255 bytes
+type gifBlockWriter struct {
+	w      io.Writer
+	buffer [256]byte
+	length int
+}
+
+func (bw *gifBlockWriter) Write(data []byte) (int, error) {
+	for i, b := range data {
+		bw.buffer[bw.length+1] = b
+		bw.length++
+		if bw.length == 255 {
+			if err := bw.flush(); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(data), nil
+}
+
+func (bw *gifBlockWriter) flush() error {
+	if bw.length == 0 {
+		return nil
+	}
+	bw.buffer[0] = byte(bw.length)
+	_, err := bw.w.Write(bw.buffer[:bw.length+1])
+	bw.length = 0
+	return err
+}
+
+// Close writes the last sub-block and the block terminator
+func (bw *gifBlockWriter) Close() error {
+	if err := bw.flush(); err != nil {
+		return err
+	}
+	_, err := bw.w.Write([]byte{0})
+	return err
+}
+
+// aviWriter streams JPEG frames into an MJPEG AVI file. The header and index are written on Close.
+type aviWriter struct {
+	f       *os.File
+	width   int
+	height  int
+	fps     float64
+	sizes   []uint32
+	maxSize uint32
+	buffer  bytes.Buffer
+}
+
+// aviHeaderSize is the length of the RIFF, hdrl and movi headers before the first frame
+const aviHeaderSize = 224
+
+func newAVIWriter(fileName string, width int, height int, fps float64) (*aviWriter, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &aviWriter{f: f, width: width, height: height, fps: fps}
+	if _, err := f.Write(aw.header()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *aviWriter) AddFrame(m *image.RGBA) error {
+	aw.buffer.Reset()
+	if err := jpeg.Encode(&aw.buffer, m, &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+
+	// the chunk size is the size of the data, without the pad byte of an odd size
+	size := uint32(aw.buffer.Len())
+	if err := writeChunkHeader(aw.f, "00dc", size); err != nil {
+		return err
+	}
+	if size%2 == 1 {
+		aw.buffer.WriteByte(0)
+	}
+	if _, err := aw.f.Write(aw.buffer.Bytes()); err != nil {
+		return err
+	}
+
+	aw.sizes = append(aw.sizes, size)
+	if size > aw.maxSize {
+		aw.maxSize = size
+	}
+	return nil
+}
+
+func (aw *aviWriter) Close() error {
+	defer aw.f.Close()
+
+	// idx1 offsets are relative to the "movi" fourcc
+	var index bytes.Buffer
+	offset := uint32(4)
+	for _, size := range aw.sizes {
+		index.WriteString("00dc")
+		binary.Write(&index, binary.LittleEndian, []uint32{0x10, offset, size})
+		offset += 8 + padded(size)
+	}
+	if err := writeChunkHeader(aw.f, "idx1", uint32(index.Len())); err != nil {
+		return err
+	}
+	if _, err := aw.f.Write(index.Bytes()); err != nil {
+		return err
+	}
+
+	if _, err := aw.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := aw.f.Write(aw.header())
+	return err
+}
+
+// header returns the RIFF, hdrl and movi headers with the current frame count
+func (aw *aviWriter) header() []byte {
+	frames := uint32(len(aw.sizes))
+	moviSize := uint32(4)
+	for _, size := range aw.sizes {
+		moviSize += 8 + padded(size)
+	}
+	riffSize := uint32(aviHeaderSize-8) + moviSize - 4 + 8 + 16*frames
+
+	microSecPerFrame := uint32(math.Round(1e6 / aw.fps))
+	width, height := uint32(aw.width), uint32(aw.height)
+
+	var h bytes.Buffer
+	le := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&h, binary.LittleEndian, v)
+		}
+	}
+
+	h.WriteString("RIFF")
+	le(riffSize)
+	h.WriteString("AVI ")
+
+	h.WriteString("LIST")
+	le(uint32(192))
+	h.WriteString("hdrl")
+
+	h.WriteString("avih")
+	le(uint32(56), microSecPerFrame, aw.maxSize*uint32(math.Ceil(aw.fps)), uint32(0), uint32(0x10),
+		frames, uint32(0), uint32(1), aw.maxSize+8, width, height, [4]uint32{})
+
+	h.WriteString("LIST")
+	le(uint32(116))
+	h.WriteString("strl")
+
+	h.WriteString("strh")
+	le(uint32(56))
+	h.WriteString("vidsMJPG")
+	le(uint32(0), uint16(0), uint16(0), uint32(0), uint32(1000), uint32(math.Round(aw.fps*1000)), uint32(0),
+		frames, aw.maxSize+8, int32(-1), uint32(0), [4]uint16{0, 0, uint16(width), uint16(height)})
+
+	h.WriteString("strf")
+	le(uint32(40), uint32(40), width, height, uint16(1), uint16(24))
+	h.WriteString("MJPG")
+	le(width*height*3, uint32(0), uint32(0), uint32(0), uint32(0))
+
+	h.WriteString("LIST")
+	le(moviSize)
+	h.WriteString("movi")
+
+	return h.Bytes()
+}
+
+// padded returns the size of a chunk with its pad byte to an even size
+func padded(size uint32) uint32 {
+	return size + size%2
+}
+
+func writeChunkHeader(w io.Writer, fourCC string, size uint32) error {
+	header := make([]byte, 8)
+	copy(header, fourCC)
+	binary.LittleEndian.PutUint32(header[4:], size)
+	_, err := w.Write(header)
+	return err
+}
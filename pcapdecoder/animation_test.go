@@ -0,0 +1,155 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnimatorWritesGIF(t *testing.T) {
+	keepUserInput(t)
+	global.UserInput.OutputPath = t.TempDir()
+
+	options := bevOptions("height")
+	options.Animation = "gif"
+	options.FPS = 4
+	a, err := NewAnimator(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := &LidarSource{Address: "10.0.0.1"}
+	for i := 0; i < 3; i++ {
+		frame := LidarFrame{Index: uint(i), Time: testStart, Points: []LidarPoint{testPoint(1, 5, float64(90*i), 0)}}
+		if err := a.AddFrame(ls, &frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(global.UserInput.OutputPath, "10.0.0.1-bev.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	animation, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 3 || animation.LoopCount != 0 || animation.Config.Width != 40 || animation.Config.Height != 40 {
+		t.Fatalf("animation has %d frames of %dx%d, loop count %d",
+			len(animation.Image), animation.Config.Width, animation.Config.Height, animation.LoopCount)
+	}
+	for i, delay := range animation.Delay {
+		if delay != 25 {
+			t.Errorf("frame %d has a delay of %d", i, delay)
+		}
+	}
+}
+
+// noiseImage returns an image whose JPEG size depends on the seed
+func noiseImage(seed int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range m.Pix {
+		m.Pix[i] = uint8((i*7919 + seed*104729) % 251)
+	}
+	return m
+}
+
+func TestAVIWriterChunks(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "frames.avi")
+	aw, err := newAVIWriter(fileName, 64, 48, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []uint32
+	for seed := 0; seed < 8; seed++ {
+		var buffer bytes.Buffer
+		jpeg.Encode(&buffer, noiseImage(seed), &jpeg.Options{Quality: 90})
+		sizes = append(sizes, uint32(buffer.Len()))
+		if err := aw.AddFrame(noiseImage(seed)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	isOdd := false
+	for _, size := range sizes {
+		isOdd = isOdd || size%2 == 1
+	}
+	if !isOdd {
+		t.Fatal("all frames have an even size, the pad byte is not tested")
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if string(data[:4]) != "RIFF" || le.Uint32(data[4:]) != uint32(len(data)-8) || string(data[8:12]) != "AVI " {
+		t.Fatalf("RIFF header is %q with size %d of %d bytes", data[:12], le.Uint32(data[4:]), len(data))
+	}
+	if frames := le.Uint32(data[48:]); frames != 8 {
+		t.Errorf("main header has %d frames", frames)
+	}
+
+	// the frames follow the movi fourcc, each one padded to an even size
+	movi := aviHeaderSize - 4
+	if string(data[movi:movi+4]) != "movi" {
+		t.Fatalf("movi list is not at byte %d", movi)
+	}
+	moviEnd := movi + int(le.Uint32(data[movi-4:]))
+	offset := movi + 4
+	var offsets []uint32
+	for i, size := range sizes {
+		if string(data[offset:offset+4]) != "00dc" || le.Uint32(data[offset+4:]) != size {
+			t.Fatalf("frame %d has the chunk %q of %d bytes, expected %d", i, data[offset:offset+4], le.Uint32(data[offset+4:]), size)
+		}
+		frame := data[offset+8 : offset+8+int(size)]
+		if frame[len(frame)-2] != 0xFF || frame[len(frame)-1] != 0xD9 {
+			t.Errorf("frame %d does not end with its end of image marker", i)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(frame)); err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+		offsets = append(offsets, uint32(offset-movi))
+		offset += 8 + int(padded(size))
+	}
+	if offset != moviEnd {
+		t.Fatalf("frames end at byte %d, the movi list at %d", offset, moviEnd)
+	}
+
+	// the index has the offset of each chunk from the movi fourcc and the size of its data
+	if string(data[offset:offset+4]) != "idx1" || le.Uint32(data[offset+4:]) != 16*8 {
+		t.Fatalf("index is %q of %d bytes", data[offset:offset+4], le.Uint32(data[offset+4:]))
+	}
+	for i := range sizes {
+		entry := data[offset+8+16*i:]
+		if string(entry[:4]) != "00dc" || le.Uint32(entry[4:]) != 0x10 || le.Uint32(entry[8:]) != offsets[i] || le.Uint32(entry[12:]) != sizes[i] {
+			t.Errorf("index entry %d is %q, flags 0x%x, offset %d, size %d", i, entry[:4], le.Uint32(entry[4:]), le.Uint32(entry[8:]), le.Uint32(entry[12:]))
+		}
+	}
+}
+
+func TestNewAnimatorRejectsInvalidOptions(t *testing.T) {
+	options := []global.RenderInput{bevOptions("height"), bevOptions("height"), bevOptions("height")}
+	options[0].Animation = "mp4"
+	options[1].Animation, options[1].FPS = "gif", 0
+	options[2].Animation, options[2].Mode = "avi", "camera"
+	for i, option := range options {
+		if _, err := NewAnimator(option); err == nil {
+			t.Errorf("options %d are accepted", i)
+		}
+	}
+}
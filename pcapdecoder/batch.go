@@ -0,0 +1,304 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchManifestFile lists the processed captures of a batch in its output path
+const batchManifestFile = "batch-manifest.json"
+
+// batchLogFile holds the output of the subcommand in the output folder of a capture
+const batchLogFile = "batch.log"
+
+// Status of a capture in the batch manifest
+const (
+	batchDone   = "done"
+	batchFailed = "failed"
+)
+
+// BatchCapture is the result of the subcommand on one capture of a batch
+type BatchCapture struct {
+	Input     string    `json:"input"`
+	Output    string    `json:"output"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Command   []string  `json:"command"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	Seconds   float64   `json:"seconds"`
+}
+
+// BatchManifest records the captures of a batch by their path in the input layout,
+// so that a rerun skips the completed captures
+type BatchManifest struct {
+	Captures map[string]*BatchCapture `json:"captures"`
+}
+
+// batchInput is a capture file found by the batch, with its path relative to the input folder
+type batchInput struct {
+	path     string
+	relative string
+	info     os.FileInfo
+}
+
+// BatchPCAP runs the subcommand of the batch arguments on every capture of the input folders and globs,
+// with the output folders mirroring the input layout under the output path
+func BatchPCAP() error {
+	ui := &global.UserInput
+
+	inputs, err := findBatchInputs(ui.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no capture is found")
+	}
+
+	manifestPath := filepath.Join(ui.OutputPath, batchManifestFile)
+	manifest, err := loadBatchManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var pending []batchInput
+	skipped := 0
+	for _, input := range inputs {
+		if manifest.isDone(input, ui.BatchArgs) {
+			skipped++
+			continue
+		}
+		pending = append(pending, input)
+	}
+	fmt.Fprintf(os.Stderr, "%d captures, %d completed before, %d jobs\n", len(inputs), skipped, ui.Jobs)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var saveErr error
+	queue := make(chan batchInput)
+	for i := 0; i < ui.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range queue {
+				capture := runBatchCapture(executable, input)
+
+				mutex.Lock()
+				manifest.Captures[input.relative] = capture
+				if err := manifest.save(manifestPath); err != nil && saveErr == nil {
+					saveErr = err
+				}
+				fmt.Fprintf(os.Stderr, "%s: %s in %.1fs\n", input.relative, capture.Status, capture.Seconds)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, input := range pending {
+		queue <- input
+	}
+	close(queue)
+	wg.Wait()
+	if saveErr != nil {
+		return saveErr
+	}
+
+	return reportBatch(manifest, inputs, len(pending), skipped)
+}
+
+// runBatchCapture runs the subcommand on the capture, and logs its output in the output folder of the capture
+func runBatchCapture(executable string, input batchInput) *BatchCapture {
+	ui := &global.UserInput
+
+	capture := &BatchCapture{
+		Input:     input.path,
+		Output:    filepath.Join(ui.OutputPath, filepath.Dir(input.relative), getCaptureName(input.relative)),
+		Size:      input.info.Size(),
+		ModTime:   input.info.ModTime(),
+		Command:   ui.BatchArgs,
+		Status:    batchFailed,
+		StartTime: time.Now()}
+	defer func() {
+		capture.Seconds = time.Since(capture.StartTime).Seconds()
+	}()
+
+	if err := os.MkdirAll(capture.Output, os.ModePerm); err != nil {
+		capture.Error = err.Error()
+		return capture
+	}
+	log, err := os.Create(filepath.Join(capture.Output, batchLogFile))
+	if err != nil {
+		capture.Error = err.Error()
+		return capture
+	}
+	defer log.Close()
+
+	args := append([]string{ui.BatchArgs[0], "--pcapFile", input.path, "--outputPath", capture.Output}, ui.BatchArgs[1:]...)
+	var stderr bytes.Buffer
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = log
+	cmd.Stderr = io.MultiWriter(log, &stderr)
+	if err := cmd.Run(); err != nil {
+		// the last line of the output is the error of the subcommand
+		capture.Error = err.Error()
+		if lines := strings.Split(strings.TrimSpace(stderr.String()), "\n"); len(lines[len(lines)-1]) > 0 {
+			capture.Error = fmt.Sprintf("%v: %s", err, lines[len(lines)-1])
+		}
+		return capture
+	}
+
+	capture.Status = batchDone
+	return capture
+}
+
+// reportBatch prints the result of every capture that is not completed, and the number of captures by result
+func reportBatch(manifest *BatchManifest, inputs []batchInput, processed int, skipped int) error {
+	failed := 0
+	for _, input := range inputs {
+		capture := manifest.Captures[input.relative]
+		if capture.Status != batchDone {
+			failed++
+			fmt.Fprintf(os.Stderr, "FAILED %s: %s\n", input.relative, capture.Error)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d captures: %d processed, %d skipped, %d succeeded, %d failed\n",
+		len(inputs), processed, skipped, len(inputs)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d captures failed, see the %s of the captures", failed, len(inputs), batchLogFile)
+	}
+	return nil
+}
+
+// findBatchInputs returns the capture files in the folders, and the files of the globs. The files of a folder
+// are relative to the folder, the other files are relative to their common folder.
+func findBatchInputs(paths []string) ([]batchInput, error) {
+	var inputs []batchInput
+	var files []batchInput
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, batchInput{path: path, info: info})
+			continue
+		}
+
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !isCaptureFile(file) {
+				return err
+			}
+			relative, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, batchInput{path: file, relative: relative, info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(files) > 0 {
+		base, err := filepath.Abs(filepath.Dir(files[0].path))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			absolute, err := filepath.Abs(file.path)
+			if err != nil {
+				return nil, err
+			}
+			for !strings.HasPrefix(absolute, base+string(filepath.Separator)) && filepath.Dir(base) != base {
+				base = filepath.Dir(base)
+			}
+		}
+		for _, file := range files {
+			absolute, _ := filepath.Abs(file.path)
+			if file.relative, err = filepath.Rel(base, absolute); err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, file)
+		}
+	}
+
+	// captures that differ only by their extensions would share an output folder
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].relative < inputs[j].relative })
+	outputs := make(map[string]string)
+	for _, input := range inputs {
+		output := filepath.Join(filepath.Dir(input.relative), getCaptureName(input.relative))
+		if other, ok := outputs[output]; ok {
+			return nil, fmt.Errorf("captures %s and %s have the same output folder %s", other, input.path, output)
+		}
+		outputs[output] = input.path
+	}
+	return inputs, nil
+}
+
+// isCaptureFile checks the extension of a PCAP or pcapng file, compressed or not
+func isCaptureFile(fileName string) bool {
+	name := strings.ToLower(fileName)
+	for _, extension := range []string{".gz", ".zst"} {
+		name = strings.TrimSuffix(name, extension)
+	}
+	return strings.HasSuffix(name, ".pcap") || strings.HasSuffix(name, ".pcapng")
+}
+
+// loadBatchManifest reads the manifest of a previous run, or returns an empty manifest
+func loadBatchManifest(fileName string) (*BatchManifest, error) {
+	manifest := &BatchManifest{Captures: make(map[string]*BatchCapture)}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	if manifest.Captures == nil {
+		manifest.Captures = make(map[string]*BatchCapture)
+	}
+	return manifest, nil
+}
+
+// isDone checks if the capture was completed with the same command, and was not changed since
+func (bm *BatchManifest) isDone(input batchInput, command []string) bool {
+	capture, ok := bm.Captures[input.relative]
+	if !ok || capture.Status != batchDone {
+		return false
+	}
+	return capture.Size == input.info.Size() && capture.ModTime.Equal(input.info.ModTime()) &&
+		strings.Join(capture.Command, "\x00") == strings.Join(command, "\x00")
+}
+
+// save replaces the manifest file, so that an interrupted batch leaves a complete manifest
+func (bm *BatchManifest) save(fileName string) error {
+	data, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := fileName + ".tmp"
+	if err := ioutil.WriteFile(temporary, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, fileName)
+}
@@ -0,0 +1,150 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// batchHelperEnv makes the test binary run as the subcommand of a batch
+const batchHelperEnv = "PCAP_DECODER_BATCH_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(batchHelperEnv) == "1" {
+		os.Exit(runBatchHelper(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// runBatchHelper appends its arguments to runs.txt in the output path, and fails on the captures named bad
+func runBatchHelper(args []string) int {
+	var pcapFile, outputPath string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--pcapFile":
+			pcapFile = args[i+1]
+		case "--outputPath":
+			outputPath = args[i+1]
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(outputPath, "runs.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	fmt.Fprintln(f, strings.Join(args, " "))
+
+	if strings.HasPrefix(filepath.Base(pcapFile), "bad") {
+		fmt.Fprintln(os.Stderr, "bad capture")
+		return 1
+	}
+	return 0
+}
+
+// writeFiles creates empty files of the relative paths in the folder
+func writeFiles(t *testing.T, folder string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		fileName := filepath.Join(folder, name)
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileName, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindBatchInputs(t *testing.T) {
+	folder := t.TempDir()
+	writeFiles(t, folder, "day1/front/city.pcap.gz", "day1/rear.pcapng", "day1/notes.txt", "day2/city.PCAP.zst")
+
+	inputs, err := findBatchInputs([]string{folder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var relatives []string
+	for _, input := range inputs {
+		relatives = append(relatives, input.relative)
+	}
+	expected := []string{"day1/front/city.pcap.gz", "day1/rear.pcapng", "day2/city.PCAP.zst"}
+	if !reflect.DeepEqual(relatives, expected) {
+		t.Errorf("found %q, expected %q", relatives, expected)
+	}
+
+	// the files of the globs are relative to their common folder
+	inputs, err = findBatchInputs([]string{filepath.Join(folder, "day1/front/city.pcap.gz"), filepath.Join(folder, "day2/city.PCAP.zst")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 2 || inputs[0].relative != "day1/front/city.pcap.gz" || inputs[1].relative != "day2/city.PCAP.zst" {
+		t.Errorf("found %+v", inputs)
+	}
+
+	writeFiles(t, folder, "day1/rear.pcap")
+	if _, err := findBatchInputs([]string{folder}); err == nil {
+		t.Error("captures of the same output folder are not an error")
+	}
+}
+
+func TestBatchPCAPSkipsCompletedCaptures(t *testing.T) {
+	keepUserInput(t)
+	os.Setenv(batchHelperEnv, "1")
+	defer os.Unsetenv(batchHelperEnv)
+
+	input := t.TempDir()
+	output := t.TempDir()
+	writeFiles(t, input, "day1/city.pcap", "day1/bad.pcap.gz")
+
+	ui := &global.UserInput
+	ui.PcapFiles = *cli.NewStringSlice(input)
+	ui.OutputPath = output
+	ui.Jobs = 2
+	ui.BatchArgs = []string{"decode", "--PLY"}
+
+	runs := func(name string) []string {
+		data, _ := ioutil.ReadFile(filepath.Join(output, "day1", name, "runs.txt"))
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	err := BatchPCAP()
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 captures failed") {
+		t.Fatalf("batch of a failed capture returns %v", err)
+	}
+	manifest, err := loadBatchManifest(filepath.Join(output, batchManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	city, bad := manifest.Captures["day1/city.pcap"], manifest.Captures["day1/bad.pcap.gz"]
+	if city == nil || city.Status != batchDone || bad == nil || bad.Status != batchFailed || !strings.HasSuffix(bad.Error, "bad capture") {
+		t.Fatalf("manifest has the captures %+v and %+v", city, bad)
+	}
+	expected := fmt.Sprintf("decode --pcapFile %s --outputPath %s --PLY", filepath.Join(input, "day1/city.pcap"), filepath.Join(output, "day1/city"))
+	if got := runs("city"); len(got) != 1 || got[0] != expected {
+		t.Errorf("subcommand ran with %q, expected %q", got, expected)
+	}
+	if log, _ := ioutil.ReadFile(filepath.Join(output, "day1/bad", batchLogFile)); !strings.Contains(string(log), "bad capture") {
+		t.Errorf("log of the failed capture is %q", log)
+	}
+
+	// a rerun skips the completed capture and retries the failed one
+	BatchPCAP()
+	if len(runs("city")) != 1 || len(runs("bad")) != 2 {
+		t.Errorf("rerun ran %d and %d times", len(runs("city")), len(runs("bad")))
+	}
+
+	// another command processes the completed capture again
+	ui.BatchArgs = []string{"decode", "--PCD"}
+	BatchPCAP()
+	if len(runs("city")) != 2 {
+		t.Errorf("capture of another command ran %d times", len(runs("city")))
+	}
+}
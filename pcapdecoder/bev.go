@@ -0,0 +1,182 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"path/filepath"
+)
+
+var (
+	backgroundColor = color.RGBA{0, 0, 0, 255}
+	gridColor       = color.RGBA{60, 60, 60, 255}
+	rangeRingColor  = color.RGBA{100, 100, 100, 255}
+)
+
+// BEVRenderer renders the bird's eye view of the lidar frames
+type BEVRenderer struct {
+	options  global.RenderInput
+	colormap Colormap
+	width    int
+	height   int
+}
+
+// NewBEVRenderer creates a BEVRenderer with validated options
+func NewBEVRenderer(options global.RenderInput) (*BEVRenderer, error) {
+	colormap, err := GetColormap(options.Colormap)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.ColorMode {
+	case "height", "intensity", "density", "ring":
+	default:
+		return nil, fmt.Errorf("color mode %q is not supported", options.ColorMode)
+	}
+
+	if options.XMax <= options.XMin || options.YMax <= options.YMin || options.ZMax <= options.ZMin {
+		return nil, fmt.Errorf("render limits must be increasing")
+	}
+	if options.Resolution <= 0 {
+		return nil, fmt.Errorf("resolution must be positive")
+	}
+
+	width := int(math.Ceil((options.XMax - options.XMin) / options.Resolution))
+	height := int(math.Ceil((options.YMax - options.YMin) / options.Resolution))
+	if width > 20000 || height > 20000 {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large, increase the resolution", width, height)
+	}
+
+	return &BEVRenderer{
+		options:  options,
+		colormap: colormap,
+		width:    width,
+		height:   height}, nil
+}
+
+// SaveFrame writes the bird's eye view of the frame into the output path
+func (r *BEVRenderer) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	fileName := fmt.Sprintf("%s-bev%d.png", ls.Name(), frame.Index)
+	return savePNG(filepath.Join(global.UserInput.OutputPath, fileName), r.Render(ls, frame))
+}
+
+// Render returns the bird's eye view of the frame in the vehicle coordinates
+func (r *BEVRenderer) Render(ls *LidarSource, frame *LidarFrame) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	draw.Draw(m, m.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+
+	r.drawGrid(m)
+	r.drawRangeRings(m, frame.translation)
+
+	// The highest point of each pixel is kept, except for the density which counts all points
+	counts := make([]uint32, r.width*r.height)
+	heights := make([]float64, r.width*r.height)
+	values := make([]float64, r.width*r.height)
+	maxCount := uint32(0)
+
+	points := frame.CartesianPoints(frame.rotation, frame.translation)
+	for i, cp := range points {
+		x, y, z := cp.X/1000, cp.Y/1000, cp.Z/1000
+		if z < r.options.ZMin || z >= r.options.ZMax {
+			continue
+		}
+
+		col, row, ok := r.getPixel(x, y)
+		if !ok {
+			continue
+		}
+
+		index := row*r.width + col
+		counts[index]++
+		if counts[index] > maxCount {
+			maxCount = counts[index]
+		}
+		if counts[index] > 1 && z <= heights[index] {
+			continue
+		}
+		heights[index] = z
+
+		switch r.options.ColorMode {
+		case "height":
+			values[index] = (z - r.options.ZMin) / (r.options.ZMax - r.options.ZMin)
+		case "intensity":
+			values[index] = float64(cp.Intensity) / 255
+		case "ring":
+			ring, rings := getRingIndex(frame.Points[i].productID, frame.Points[i].rowIndex)
+			values[index] = float64(ring) / float64(rings-1)
+		}
+	}
+
+	for index, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		var c color.RGBA
+		switch r.options.ColorMode {
+		case "density":
+			c = r.colormap(math.Log1p(float64(count)) / math.Log1p(float64(maxCount)))
+		default:
+			c = r.colormap(values[index])
+		}
+		m.SetRGBA(index%r.width, index/r.width, c)
+	}
+
+	return m
+}
+
+// getPixel returns the pixel of the XY coordinates in meters
+func (r *BEVRenderer) getPixel(x float64, y float64) (int, int, bool) {
+	col := int(math.Floor((x - r.options.XMin) / r.options.Resolution))
+	row := int(math.Floor((r.options.YMax - y) / r.options.Resolution))
+
+	isWithin := col >= 0 && col < r.width && row >= 0 && row < r.height
+	return col, row, isWithin
+}
+
+func (r *BEVRenderer) drawGrid(m *image.RGBA) {
+	spacing := r.options.Grid
+	if spacing <= 0 {
+		return
+	}
+
+	for x := math.Ceil(r.options.XMin/spacing) * spacing; x < r.options.XMax; x += spacing {
+		col, _, _ := r.getPixel(x, r.options.YMax)
+		for row := 0; row < r.height; row++ {
+			m.SetRGBA(col, row, gridColor)
+		}
+	}
+	for y := math.Ceil(r.options.YMin/spacing) * spacing; y < r.options.YMax; y += spacing {
+		_, row, _ := r.getPixel(r.options.XMin, y)
+		for col := 0; col < r.width; col++ {
+			m.SetRGBA(col, row, gridColor)
+		}
+	}
+}
+
+// drawRangeRings draws circles around the lidar position
+func (r *BEVRenderer) drawRangeRings(m *image.RGBA, position Translation) {
+	spacing := r.options.RangeRings
+	if spacing <= 0 {
+		return
+	}
+
+	cx := float64(position.x) / 1000
+	cy := float64(position.y) / 1000
+	maxRadius := math.Max(
+		math.Max(math.Abs(r.options.XMin-cx), math.Abs(r.options.XMax-cx)),
+		math.Max(math.Abs(r.options.YMin-cy), math.Abs(r.options.YMax-cy))) * math.Sqrt2
+
+	for radius := spacing; radius <= maxRadius; radius += spacing {
+		steps := int(2*math.Pi*radius/r.options.Resolution) + 1
+		for step := 0; step < steps; step++ {
+			angle := 2 * math.Pi * float64(step) / float64(steps)
+			if col, row, ok := r.getPixel(cx+radius*math.Cos(angle), cy+radius*math.Sin(angle)); ok {
+				m.SetRGBA(col, row, rangeRingColor)
+			}
+		}
+	}
+}
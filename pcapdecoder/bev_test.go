@@ -0,0 +1,105 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"image/color"
+	"testing"
+)
+
+// testPoint returns a VLP-16 point of the row at the distance in meters and the azimuth in degrees
+func testPoint(row uint8, distance float64, azimuth float64, intensity byte) LidarPoint {
+	return LidarPoint{
+		distance:    uint16(distance * 500),
+		azimuth:     uint16(azimuth * 100),
+		nextAzimuth: uint16(azimuth * 100),
+		rowIndex:    row,
+		productID:   0x22,
+		Intensity:   intensity}
+}
+
+func bevOptions(colorMode string) global.RenderInput {
+	options := global.UserInput.Render
+	options.XMin, options.XMax = -10, 10
+	options.YMin, options.YMax = -10, 10
+	options.Resolution = 0.5
+	options.Grid = 5
+	options.ColorMode = colorMode
+	return options
+}
+
+func TestBEVRendererKeepsHighestPoint(t *testing.T) {
+	r, err := NewBEVRenderer(bevOptions("height"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows 1 and 3 of the VLP-16 are 1° and 3° up, both fall into the pixel of (3.5, 3.5)
+	frame := LidarFrame{Points: []LidarPoint{testPoint(3, 5, 45, 10), testPoint(1, 5, 45, 200)}}
+	m := r.Render(&LidarSource{Address: "10.0.0.1"}, &frame)
+	if m.Bounds().Dx() != 40 || m.Bounds().Dy() != 40 {
+		t.Fatalf("image is %v", m.Bounds())
+	}
+
+	z := frame.Points[0].GetXYZ().Z / 1000
+	if c, expected := m.RGBAAt(27, 12), r.colormap((z+3)/8); c != expected {
+		t.Errorf("pixel of the points is %v, expected %v of the height %f", c, expected, z)
+	}
+	if c := m.RGBAAt(20, 3); c != gridColor {
+		t.Errorf("grid pixel is %v", c)
+	}
+	if c := m.RGBAAt(3, 3); c != backgroundColor {
+		t.Errorf("background pixel is %v", c)
+	}
+
+	// the frame is drawn at the pose of the lidar
+	frame.translation = Translation{x: 1000}
+	m = r.Render(&LidarSource{Address: "10.0.0.1"}, &frame)
+	if m.RGBAAt(27, 12) != backgroundColor || m.RGBAAt(29, 12) == backgroundColor {
+		t.Errorf("the points are not moved by the translation, pixels are %v and %v", m.RGBAAt(27, 12), m.RGBAAt(29, 12))
+	}
+}
+
+func TestBEVRendererColorModes(t *testing.T) {
+	frame := LidarFrame{Points: []LidarPoint{testPoint(3, 5, 45, 10), testPoint(1, 5, 45, 200), testPoint(1, 5, 225, 100)}}
+	tests := []struct {
+		colorMode string
+		col, row  int
+		value     float64
+	}{
+		// the highest point gives the intensity of the pixel
+		{"intensity", 27, 12, 10.0 / 255},
+		{"density", 27, 12, 1},
+		// one point of the densest pixel with two points
+		{"density", 12, 27, 0.630930},
+		// row 3 is the 10th of 16 lasers by elevation
+		{"ring", 27, 12, 9.0 / 15},
+	}
+	for _, test := range tests {
+		r, err := NewBEVRenderer(bevOptions(test.colorMode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := r.Render(&LidarSource{Address: "10.0.0.1"}, &frame)
+		if c, expected := m.RGBAAt(test.col, test.row), r.colormap(test.value); !closeColor(c, expected) {
+			t.Errorf("%s: pixel (%d, %d) is %v, expected %v", test.colorMode, test.col, test.row, c, expected)
+		}
+	}
+}
+
+func TestNewBEVRendererRejectsInvalidOptions(t *testing.T) {
+	options := []global.RenderInput{bevOptions("source"), bevOptions("depth"), bevOptions("height"), bevOptions("height"), bevOptions("height")}
+	options[2].XMax = -20
+	options[3].Resolution = 0
+	options[4].Resolution = 0.0001
+	for i, option := range options {
+		if _, err := NewBEVRenderer(option); err == nil {
+			t.Errorf("options %d are accepted", i)
+		}
+	}
+}
+
+// closeColor checks if the colors differ by rounding only
+func closeColor(a color.RGBA, b color.RGBA) bool {
+	near := func(x, y uint8) bool { return int(x)-int(y) <= 1 && int(y)-int(x) <= 1 }
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B) && a.A == b.A
+}
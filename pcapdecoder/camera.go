@@ -0,0 +1,403 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minCameraDepth is the nearest depth in meters that is projected into the camera
+const minCameraDepth = 0.1
+
+// CameraPoint is a lidar point projected into the camera image. Depth is in meters along the optical axis.
+type CameraPoint struct {
+	U     float64
+	V     float64
+	Depth float64
+}
+
+// Camera projects vehicle coordinates into the image of a calibrated camera
+type Camera struct {
+	Calibration registry.CameraCalib
+	rotation    [3][3]float64
+	translation Translation
+}
+
+// NewCamera creates the Camera of the calibration
+func NewCamera(calib registry.CameraCalib) (Camera, error) {
+	if !calib.HasIntrinsics() {
+		return Camera{}, fmt.Errorf("camera %s has no intrinsics", calib.Name)
+	}
+
+	rotation, translation := getPose(calib.Extrinsics)
+	return Camera{
+		Calibration: calib,
+		rotation:    getRotationMultipliers(&rotation),
+		translation: translation}, nil
+}
+
+// Project returns the pixel of a point in the vehicle coordinates in mm.
+// False is returned when the point is behind the camera or outside the image.
+func (c *Camera) Project(cp CartesianPoint) (CameraPoint, bool) {
+	// inverse of the camera pose, the rotation is orthonormal so its inverse is the transpose
+	dx := cp.X - float64(c.translation.x)
+	dy := cp.Y - float64(c.translation.y)
+	dz := cp.Z - float64(c.translation.z)
+	A := &c.rotation
+	X := (A[0][0]*dx + A[1][0]*dy + A[2][0]*dz) / 1000
+	Y := (A[0][1]*dx + A[1][1]*dy + A[2][1]*dz) / 1000
+	Z := (A[0][2]*dx + A[1][2]*dy + A[2][2]*dz) / 1000
+
+	// optical frame: x right, y down, z forward
+	depth := Y
+	if depth <= minCameraDepth {
+		return CameraPoint{}, false
+	}
+
+	intrinsics := &c.Calibration.Intrinsics
+	xd, yd := distort(intrinsics, X/depth, -Z/depth)
+	u := intrinsics.Fx*xd + intrinsics.Cx
+	v := intrinsics.Fy*yd + intrinsics.Cy
+
+	if u < 0 || v < 0 || u >= float64(intrinsics.Width) || v >= float64(intrinsics.Height) {
+		return CameraPoint{}, false
+	}
+	return CameraPoint{U: u, V: v, Depth: depth}, true
+}
+
+// distort applies the distortion model to the normalized image coordinates
+func distort(intrinsics *registry.CameraIntrinsics, x float64, y float64) (float64, float64) {
+	var k [5]float64
+	copy(k[:], intrinsics.Distortion)
+
+	switch intrinsics.Model {
+	case "radtan":
+		k1, k2, p1, p2, k3 := k[0], k[1], k[2], k[3], k[4]
+		r2 := x*x + y*y
+		radial := 1 + k1*r2 + k2*r2*r2 + k3*r2*r2*r2
+		xd := x*radial + 2*p1*x*y + p2*(r2+2*x*x)
+		yd := y*radial + p1*(r2+2*y*y) + 2*p2*x*y
+		return xd, yd
+	case "fisheye":
+		r := math.Sqrt(x*x + y*y)
+		if r == 0 {
+			return x, y
+		}
+		theta := math.Atan(r)
+		t2 := theta * theta
+		thetaD := theta * (1 + k[0]*t2 + k[1]*t2*t2 + k[2]*t2*t2*t2 + k[3]*t2*t2*t2*t2)
+		return x * thetaD / r, y * thetaD / r
+	}
+	return x, y
+}
+
+// ProjectFrame returns the points of the frame that are visible in the camera
+func (c *Camera) ProjectFrame(frame *LidarFrame) []CameraPoint {
+	var points []CameraPoint
+	for _, cp := range frame.CartesianPoints(frame.rotation, frame.translation) {
+		if point, ok := c.Project(cp); ok {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// DepthPNG returns the sparse 16-bit depth map, where a pixel value is the depth in units of meters. 0 means no point.
+func (c *Camera) DepthPNG(points []CameraPoint, unit float64) *image.Gray16 {
+	intrinsics := &c.Calibration.Intrinsics
+	m := image.NewGray16(image.Rect(0, 0, intrinsics.Width, intrinsics.Height))
+
+	for _, point := range points {
+		value := math.Round(point.Depth / unit)
+		if value > math.MaxUint16 {
+			value = math.MaxUint16
+		}
+		if value < 1 {
+			value = 1
+		}
+
+		x, y := int(point.U), int(point.V)
+		if old := m.Gray16At(x, y).Y; old == 0 || uint16(value) < old {
+			m.SetGray16(x, y, color.Gray16{uint16(value)})
+		}
+	}
+	return m
+}
+
+// Overlay draws the points colored by depth on top of the camera image
+func (c *Camera) Overlay(background image.Image, points []CameraPoint, depthMin float64, depthMax float64, colormap Colormap) *image.RGBA {
+	bounds := background.Bounds()
+	m := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(m, m.Bounds(), background, bounds.Min, draw.Src)
+
+	// far points first so the near points stay on top
+	sort.Slice(points, func(i, j int) bool { return points[i].Depth > points[j].Depth })
+
+	for _, point := range points {
+		if point.Depth < depthMin || point.Depth >= depthMax {
+			continue
+		}
+
+		// near points get the upper end of the colormap
+		pointColor := colormap((depthMax - point.Depth) / (depthMax - depthMin))
+		x, y := int(point.U), int(point.V)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				m.SetRGBA(x+dx, y+dy, pointColor)
+			}
+		}
+	}
+	return m
+}
+
+// CameraImage is an image of a camera with its capture time.
+// Data holds the encoded image when it is decoded from the camera packets instead of a file.
+type CameraImage struct {
+	FileName string
+	Time     time.Time
+	Data     []byte
+}
+
+// imageExtensions are the supported camera image files
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
+
+// ListCameraImages returns the images of the directory sorted by time.
+// The file names are the capture times as unix seconds with a fraction, or as integer seconds, ms, µs or ns.
+func ListCameraImages(directory string) ([]CameraImage, error) {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []CameraImage
+	for _, file := range files {
+		extension := filepath.Ext(file.Name())
+		if file.IsDir() || !imageExtensions[strings.ToLower(extension)] {
+			continue
+		}
+
+		imageTime, err := parseImageTime(strings.TrimSuffix(file.Name(), extension))
+		if err != nil {
+			continue
+		}
+		images = append(images, CameraImage{
+			FileName: filepath.Join(directory, file.Name()),
+			Time:     imageTime})
+	}
+
+	sort.Slice(images, func(i, j int) bool { return images[i].Time.Before(images[j].Time) })
+	return images, nil
+}
+
+// parseImageTime reads the unix time of a file name, the unit of an integer is detected by its magnitude
+func parseImageTime(name string) (time.Time, error) {
+	if strings.Contains(name, ".") {
+		seconds, err := strconv.ParseFloat(name, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole := math.Floor(seconds)
+		return time.Unix(int64(whole), int64(math.Round((seconds-whole)*1e9))), nil
+	}
+
+	value, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case value >= 1e17:
+		return time.Unix(0, value), nil
+	case value >= 1e14:
+		return time.Unix(0, value*int64(time.Microsecond)), nil
+	case value >= 1e11:
+		return time.Unix(0, value*int64(time.Millisecond)), nil
+	}
+	return time.Unix(value, 0), nil
+}
+
+// findCameraImage returns the image nearest to the time, if it is within the maximum offset
+func findCameraImage(images []CameraImage, t time.Time, maxOffset time.Duration) (CameraImage, bool) {
+	index := sort.Search(len(images), func(i int) bool { return !images[i].Time.Before(t) })
+
+	best := -1
+	var bestOffset time.Duration
+	for _, i := range []int{index - 1, index} {
+		if i < 0 || i >= len(images) {
+			continue
+		}
+		offset := images[i].Time.Sub(t)
+		if offset < 0 {
+			offset = -offset
+		}
+		if best < 0 || offset < bestOffset {
+			best, bestOffset = i, offset
+		}
+	}
+
+	if best < 0 || bestOffset > maxOffset {
+		return CameraImage{}, false
+	}
+	return images[best], true
+}
+
+// Load decodes the camera image
+func (ci *CameraImage) Load() (image.Image, error) {
+	if ci.Data != nil {
+		m, _, err := image.Decode(bytes.NewReader(ci.Data))
+		return m, err
+	}
+
+	f, err := os.Open(ci.FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ci.FileName, err)
+	}
+	return m, nil
+}
+
+// CameraRenderer writes the depth maps and image overlays of the frames for each selected camera
+type CameraRenderer struct {
+	options  global.RenderInput
+	colormap Colormap
+	cameras  []Camera
+	images   map[string][]CameraImage
+}
+
+// NewCameraRenderer creates a CameraRenderer of the selected cameras of the current vehicle.
+// All cameras of the vehicle with intrinsics are selected when no camera is given.
+func NewCameraRenderer(options global.RenderInput) (*CameraRenderer, error) {
+	colormap, err := GetColormap(options.Colormap)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.RangeUnit <= 0 {
+		return nil, fmt.Errorf("range unit must be positive")
+	}
+	if options.DepthMax <= options.DepthMin || options.DepthMin < 0 {
+		return nil, fmt.Errorf("depth range must be increasing and must not be negative")
+	}
+	if options.MaxTimeOffset < 0 {
+		return nil, fmt.Errorf("maximum time offset must not be negative")
+	}
+
+	cameras, err := getCameras(options)
+	if err != nil {
+		return nil, err
+	}
+	images, err := listCameraImages(options.CameraImages, cameras)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CameraRenderer{
+		options:  options,
+		colormap: colormap,
+		cameras:  cameras,
+		images:   images}, nil
+}
+
+// getCameras returns the selected cameras of the current vehicle, or all cameras of the vehicle with intrinsics
+func getCameras(options global.RenderInput) ([]Camera, error) {
+	var calibs []registry.CameraCalib
+	if names := options.Cameras.Value(); len(names) > 0 {
+		for _, name := range names {
+			calib, err := registry.GetCamera(name)
+			if err != nil {
+				return nil, err
+			}
+			calibs = append(calibs, calib)
+		}
+	} else if registry.Current != nil {
+		for _, calib := range registry.Current.Cameras {
+			if calib.HasIntrinsics() {
+				calibs = append(calibs, calib)
+			}
+		}
+	}
+
+	if len(calibs) == 0 {
+		return nil, fmt.Errorf("camera projection needs the camera intrinsics of a vehicle")
+	}
+
+	cameras := make([]Camera, len(calibs))
+	for i, calib := range calibs {
+		camera, err := NewCamera(calib)
+		if err != nil {
+			return nil, err
+		}
+		cameras[i] = camera
+	}
+	return cameras, nil
+}
+
+// listCameraImages returns the images of each camera in the <directory>/<camera> folders
+func listCameraImages(directory string, cameras []Camera) (map[string][]CameraImage, error) {
+	images := make(map[string][]CameraImage)
+	if len(directory) == 0 {
+		return images, nil
+	}
+
+	for _, camera := range cameras {
+		name := camera.Calibration.Name
+		cameraImages, err := ListCameraImages(filepath.Join(directory, name))
+		if err != nil {
+			return nil, err
+		}
+		images[name] = cameraImages
+	}
+	return images, nil
+}
+
+// SaveFrame writes the depth map of the frame for each camera into the output path,
+// and the overlay when a camera image is within the maximum time offset of the frame
+func (r *CameraRenderer) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	outputPath := global.UserInput.OutputPath
+	maxOffset := time.Duration(r.options.MaxTimeOffset * float64(time.Second))
+
+	for i := range r.cameras {
+		camera := &r.cameras[i]
+		name := camera.Calibration.Name
+		points := camera.ProjectFrame(frame)
+
+		fileName := fmt.Sprintf("%s-%s-depth%d.png", ls.Name(), name, frame.Index)
+		if err := savePNG(filepath.Join(outputPath, fileName), camera.DepthPNG(points, r.options.RangeUnit)); err != nil {
+			return err
+		}
+
+		cameraImage, ok := findCameraImage(r.images[name], frame.Time, maxOffset)
+		if !ok {
+			continue
+		}
+		background, err := cameraImage.Load()
+		if err != nil {
+			return err
+		}
+
+		m := camera.Overlay(background, points, r.options.DepthMin, r.options.DepthMax, r.colormap)
+		fileName = fmt.Sprintf("%s-%s-overlay%d.png", ls.Name(), name, frame.Index)
+		if err := savePNG(filepath.Join(outputPath, fileName), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pinholeCamera looks forward with a focal length of 100 pixels
+var pinholeCamera = registry.CameraCalib{
+	Name:         "front",
+	AzimuthStart: 315,
+	AzimuthEnd:   45,
+	Intrinsics:   registry.CameraIntrinsics{Width: 640, Height: 480, Fx: 100, Fy: 100, Cx: 320, Cy: 240}}
+
+func TestCameraProject(t *testing.T) {
+	fisheye := pinholeCamera
+	fisheye.Intrinsics.Model = "fisheye"
+	fisheye.Intrinsics.Distortion = []float64{0.1}
+	radtan := pinholeCamera
+	radtan.Intrinsics.Model = "radtan"
+	radtan.Intrinsics.Distortion = []float64{0.1, 0, 0.01}
+	moved := pinholeCamera
+	moved.Extrinsics = global.Extrinsics{X: 1000, Z: -500}
+
+	// the point is 5m ahead, 1m right and 0.5m down, at the normalized coordinates (0.2, 0.1)
+	theta := math.Atan(math.Sqrt(0.05))
+	thetaD := theta * (1 + 0.1*theta*theta) / math.Sqrt(0.05)
+	tests := []struct {
+		calib registry.CameraCalib
+		u, v  float64
+	}{
+		{pinholeCamera, 340, 250},
+		{radtan, 320 + 100*(0.2*1.005+0.01*0.2*0.2), 240 + 100*(0.1*1.005+0.01*(0.05+0.02))},
+		{fisheye, 320 + 20*thetaD, 240 + 10*thetaD},
+		{moved, 320, 240},
+	}
+	for _, test := range tests {
+		camera, err := NewCamera(test.calib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		point, ok := camera.Project(CartesianPoint{X: 1000, Y: 5000, Z: -500})
+		if !ok || math.Abs(point.U-test.u) > 1e-9 || math.Abs(point.V-test.v) > 1e-9 || point.Depth != 5 {
+			t.Errorf("%s model %q: point is %+v, expected (%f, %f)", test.calib.Name, test.calib.Intrinsics.Model, point, test.u, test.v)
+		}
+	}
+
+	camera, _ := NewCamera(pinholeCamera)
+	for _, cp := range []CartesianPoint{{Y: -5000}, {Y: 50}, {X: 20000, Y: 5000}} {
+		if point, ok := camera.Project(cp); ok {
+			t.Errorf("%+v is projected to %+v", cp, point)
+		}
+	}
+	if _, err := NewCamera(registry.CameraCalib{Name: "left"}); err == nil {
+		t.Error("a camera without intrinsics is created")
+	}
+}
+
+func TestFindCameraImage(t *testing.T) {
+	names := map[string]time.Time{
+		"1577836800.25":       time.Unix(1577836800, 250000000),
+		"1577836800":          time.Unix(1577836800, 0),
+		"1577836800250":       time.Unix(1577836800, 250000000),
+		"1577836800250500":    time.Unix(1577836800, 250500000),
+		"1577836800250500100": time.Unix(1577836800, 250500100),
+	}
+	for name, expected := range names {
+		if imageTime, err := parseImageTime(name); err != nil || !imageTime.Equal(expected) {
+			t.Errorf("time of %s is %s, %v", name, imageTime, err)
+		}
+	}
+
+	images := []CameraImage{{FileName: "a", Time: testStart}, {FileName: "b", Time: testStart.Add(100 * time.Millisecond)}}
+	tests := []struct {
+		offset   time.Duration
+		fileName string
+	}{{-time.Second, ""}, {-10 * time.Millisecond, "a"}, {40 * time.Millisecond, "a"}, {60 * time.Millisecond, "b"}, {130 * time.Millisecond, "b"}, {200 * time.Millisecond, ""}}
+	for _, test := range tests {
+		found, ok := findCameraImage(images, testStart.Add(test.offset), 50*time.Millisecond)
+		if ok != (len(test.fileName) > 0) || found.FileName != test.fileName {
+			t.Errorf("image at %s is %q, expected %q", test.offset, found.FileName, test.fileName)
+		}
+	}
+}
+
+func TestCameraRendererSavesDepthAndOverlay(t *testing.T) {
+	keepUserInput(t)
+	keepVehicle(t)
+	global.UserInput.OutputPath = t.TempDir()
+
+	// one camera image at the time of frame 1
+	imagePath := t.TempDir()
+	if err := os.Mkdir(filepath.Join(imagePath, "front"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	background := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	imageName := filepath.Join(imagePath, "front", "1577836800100.png")
+	if err := savePNG(imageName, background); err != nil {
+		t.Fatal(err)
+	}
+
+	registry.Current = &registry.Vehicle{ID: "car1", Cameras: []registry.CameraCalib{pinholeCamera, {Name: "rear"}}}
+	options := global.UserInput.Render
+	options.CameraImages = imagePath
+	options.RangeUnit = 0.01
+	r, err := NewCameraRenderer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a point 4° ahead on the left, at 5m
+	frame := LidarFrame{Points: []LidarPoint{testPoint(1, 5, 356, 0)}}
+	for index, offset := range []time.Duration{0, 100 * time.Millisecond} {
+		frame.Index = uint(index)
+		frame.Time = time.Unix(1577836800, 0).Add(offset)
+		if err := r.SaveFrame(&LidarSource{Address: "10.0.0.1"}, &frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the camera without intrinsics is not rendered
+	for _, name := range []string{"10.0.0.1-front-depth0.png", "10.0.0.1-front-depth1.png", "10.0.0.1-front-overlay1.png"} {
+		if _, err := os.Stat(filepath.Join(global.UserInput.OutputPath, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, name := range []string{"10.0.0.1-front-overlay0.png", "10.0.0.1-rear-depth0.png"} {
+		if _, err := os.Stat(filepath.Join(global.UserInput.OutputPath, name)); err == nil {
+			t.Errorf("%s is written", name)
+		}
+	}
+
+	cp := frame.Points[0].GetXYZ()
+	u := int(320 + 100*cp.X/cp.Y)
+	v := int(240 - 100*cp.Z/cp.Y)
+	depth := readPNG(t, filepath.Join(global.UserInput.OutputPath, "10.0.0.1-front-depth1.png")).(*image.Gray16)
+	if value := depth.Gray16At(u, v).Y; value != uint16(math.Round(cp.Y/10)) {
+		t.Errorf("depth of (%d, %d) is %d", u, v, value)
+	}
+	overlay := readPNG(t, filepath.Join(global.UserInput.OutputPath, "10.0.0.1-front-overlay1.png"))
+	if c := color.RGBAModel.Convert(overlay.At(u+1, v+1)).(color.RGBA); c == (color.RGBA{}) {
+		t.Errorf("the point is not drawn on the overlay")
+	}
+}
@@ -0,0 +1,248 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxCameraFrameSize drops the buffered fragments of an image that never ends
+const maxCameraFrameSize = 16 << 20
+
+// Size and sync byte of the packets of an MPEG transport stream, 7 of them fill a camera payload
+const (
+	mpegTSPacketSize = 188
+	mpegTSSyncByte   = 0x47
+)
+
+// CameraFrame is a complete JPEG image of a camera
+type CameraFrame struct {
+	Index uint
+	Time  time.Time
+	Data  []byte
+}
+
+// CameraHandler processes a complete image of a camera source
+type CameraHandler func(cs *CameraSource, frame *CameraFrame) error
+
+// CameraSource reassembles the JPEG fragments of the camera packets of an IP address.
+// The payloads are taken as the bare byte stream of consecutive JPEG images, in capture order,
+// without a header or sequence number. An image with a lost or reordered fragment does not
+// decode and is dropped.
+type CameraSource struct {
+	Address     string
+	Interface   int
+	Calibration registry.CameraCalib
+	FrameIndex  uint
+	// Dropped counts the corrupt images
+	Dropped   uint
+	buffer    []byte
+	scan      jpegScan
+	frameTime time.Time
+}
+
+// jpegScan is the progress of the marker walk through the buffered image,
+// so that the next payload only scans its own bytes
+type jpegScan struct {
+	offset         int
+	isEntropyCoded bool
+}
+
+// NewCameraSource creates the CameraSource of an IP address with its calibration, if any
+func NewCameraSource(address string) *CameraSource {
+	calib, _ := registry.GetCameraByIP(address)
+	return &CameraSource{Address: address, Calibration: calib}
+}
+
+// Name returns the calibrated name of the camera, or its IP address, with its capture interface
+func (cs *CameraSource) Name() string {
+	if len(cs.Calibration.Name) > 0 {
+		return sourceID(cs.Calibration.Name, cs.Interface)
+	}
+	return sourceID(cs.Address, cs.Interface)
+}
+
+// Write appends the payload of a camera packet and returns the images that it completes.
+// An image is timestamped with the capture time of the packet holding its start of image marker.
+// The images that do not decode are counted in Dropped.
+func (cs *CameraSource) Write(payload []byte, recordTime time.Time) []CameraFrame {
+	if len(cs.buffer) == 0 {
+		cs.frameTime = recordTime
+	}
+	cs.buffer = append(cs.buffer, payload...)
+
+	var frames []CameraFrame
+	for {
+		start := bytes.Index(cs.buffer, jpegSOI)
+		if start < 0 {
+			// keep the last bytes in case they start a marker
+			if len(cs.buffer) > len(jpegSOI)-1 {
+				cs.buffer = cs.buffer[len(cs.buffer)-len(jpegSOI)+1:]
+			}
+			cs.frameTime = recordTime
+			return frames
+		}
+		if start > 0 {
+			cs.buffer = cs.buffer[start:]
+			cs.frameTime = recordTime
+		}
+
+		length, err := cs.scan.length(cs.buffer)
+		if err != nil {
+			// corrupt image, resynchronize at the next start of image
+			cs.buffer = cs.buffer[1:]
+			cs.scan = jpegScan{}
+			continue
+		}
+		if length == 0 {
+			if len(cs.buffer) > maxCameraFrameSize {
+				cs.buffer = cs.buffer[1:]
+				cs.scan = jpegScan{}
+				continue
+			}
+			return frames
+		}
+
+		data := append([]byte(nil), cs.buffer[:length]...)
+		if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+			cs.Dropped++
+		} else {
+			frames = append(frames, CameraFrame{
+				Index: cs.FrameIndex,
+				Time:  cs.frameTime,
+				Data:  data})
+			cs.FrameIndex++
+		}
+
+		cs.buffer = cs.buffer[length:]
+		cs.scan = jpegScan{}
+		cs.frameTime = recordTime
+	}
+}
+
+var jpegSOI = []byte{0xFF, 0xD8, 0xFF}
+
+// isMPEGTS checks if the payload is made of the packets of an MPEG transport stream instead of JPEG fragments
+func isMPEGTS(payload []byte) bool {
+	if len(payload) == 0 || len(payload)%mpegTSPacketSize != 0 {
+		return false
+	}
+	for i := 0; i < len(payload); i += mpegTSPacketSize {
+		if payload[i] != mpegTSSyncByte {
+			return false
+		}
+	}
+	return true
+}
+
+// length returns the length of the JPEG image at the start of the data by walking its markers.
+// 0 is returned when the image is not complete yet, the walk resumes there when more data is appended.
+func (s *jpegScan) length(data []byte) (int, error) {
+	i := s.offset
+	if i == 0 {
+		i = 2
+	}
+	isEntropyCoded := s.isEntropyCoded
+	defer func() { s.offset, s.isEntropyCoded = i, isEntropyCoded }()
+
+	for i+1 < len(data) {
+		if isEntropyCoded {
+			if data[i] != 0xFF {
+				i++
+				continue
+			}
+			marker := data[i+1]
+			switch {
+			case marker == 0x00, marker >= 0xD0 && marker <= 0xD7:
+				// stuffed byte or restart marker
+				i += 2
+				continue
+			case marker == 0xFF:
+				i++
+				continue
+			}
+			isEntropyCoded = false
+		}
+
+		if data[i] != 0xFF {
+			return 0, fmt.Errorf("invalid JPEG marker at byte %d", i)
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			i++
+			continue
+		case marker == 0xD9:
+			return i + 2, nil
+		case marker == 0x01, marker >= 0xD0 && marker <= 0xD7:
+			i += 2
+			continue
+		case marker == 0xD8:
+			return 0, fmt.Errorf("unexpected start of image at byte %d", i)
+		}
+
+		if i+4 > len(data) {
+			return 0, nil
+		}
+		segmentLength := int(data[i+2])<<8 | int(data[i+3])
+		if segmentLength < 2 {
+			return 0, fmt.Errorf("invalid JPEG segment length at byte %d", i)
+		}
+		i += 2 + segmentLength
+		isEntropyCoded = marker == 0xDA
+	}
+
+	return 0, nil
+}
+
+// decodeCameraPacket reassembles the camera images of an IP address on a capture interface from the UDP payload
+func (d *Decoder) decodeCameraPacket(address string, interfaceID int, payload []byte, recordTime time.Time) error {
+	id := sourceID(address, interfaceID)
+	if isMPEGTS(payload) {
+		if !d.unsupported[id] {
+			d.unsupported[id] = true
+			fmt.Fprintf(os.Stderr, "%s: camera packets of an MPEG transport stream are not supported, they are skipped\n", id)
+		}
+		return nil
+	}
+
+	cameraSource, ok := d.cameraSources[id]
+	if !ok {
+		cameraSource = NewCameraSource(address)
+		cameraSource.Interface = interfaceID
+		d.cameraSources[id] = cameraSource
+	}
+
+	dropped := cameraSource.Dropped
+	frames := cameraSource.Write(payload, recordTime)
+	if cameraSource.Dropped > dropped {
+		fmt.Fprintf(os.Stderr, "%s: dropped %d corrupt images at %s\n", cameraSource.Name(), cameraSource.Dropped-dropped, recordTime.Format(time.RFC3339Nano))
+	}
+	for _, frame := range frames {
+		for _, handler := range d.cameraHandlers {
+			if err := handler(cameraSource, &frame); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SaveCameraFrame writes the image into <output path>/<camera>/<unix time>.jpg,
+// which is the layout of the camera images of the camera render mode
+func SaveCameraFrame(cs *CameraSource, frame *CameraFrame) error {
+	folder := filepath.Join(global.UserInput.OutputPath, cs.Name())
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%d.%06d.jpg", frame.Time.Unix(), frame.Time.Nanosecond()/1000)
+	return ioutil.WriteFile(filepath.Join(folder, fileName), frame.Data, 0644)
+}
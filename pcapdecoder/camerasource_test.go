@@ -0,0 +1,116 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+// testJPEG encodes an image of about 35kB, which does not decode without any of its fragments
+func testJPEG(t *testing.T, seed int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			img.Set(x, y, color.RGBA{uint8(x*4 + seed), uint8(y * 5), uint8(x * y), 255})
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// cameraPayloads splits the image into the 1316 byte payloads of the camera packets, the last one is padded with zeros
+func cameraPayloads(data []byte) [][]byte {
+	var payloads [][]byte
+	for offset := 0; offset < len(data); offset += 1316 {
+		payload := make([]byte, 1316)
+		copy(payload, data[offset:])
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func TestCameraSourceReassemblesImages(t *testing.T) {
+	images := [][]byte{testJPEG(t, 0), testJPEG(t, 1), testJPEG(t, 2)}
+
+	cs := NewCameraSource("10.0.0.10")
+	var frames []CameraFrame
+	var starts []time.Time
+	recordTime := testStart
+	for i, data := range images {
+		starts = append(starts, recordTime)
+		for fragment, payload := range cameraPayloads(data) {
+			// the second image loses a fragment
+			if i == 1 && fragment == 3 {
+				continue
+			}
+			frames = append(frames, cs.Write(payload, recordTime)...)
+			recordTime = recordTime.Add(time.Millisecond)
+		}
+	}
+
+	if cs.Dropped != 1 {
+		t.Errorf("dropped %d images, expected 1", cs.Dropped)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("reassembled %d images, expected 2", len(frames))
+	}
+	for i, expected := range []int{0, 2} {
+		frame := frames[i]
+		if frame.Index != uint(i) {
+			t.Errorf("image %d has index %d", i, frame.Index)
+		}
+		if !frame.Time.Equal(starts[expected]) {
+			t.Errorf("image %d is at %s, expected the time of its first fragment %s", i, frame.Time, starts[expected])
+		}
+		if !bytes.Equal(frame.Data, images[expected]) {
+			t.Errorf("image %d differs from the encoded image %d", i, expected)
+		}
+	}
+}
+
+func TestIsMPEGTS(t *testing.T) {
+	payload := make([]byte, 7*mpegTSPacketSize)
+	for i := 0; i < len(payload); i += mpegTSPacketSize {
+		payload[i] = mpegTSSyncByte
+	}
+	if !isMPEGTS(payload) {
+		t.Error("the packets of a transport stream are not detected")
+	}
+	if isMPEGTS(cameraPayloads(testJPEG(t, 0))[0]) {
+		t.Error("a JPEG fragment is detected as a transport stream")
+	}
+}
+
+func TestCameraSourceResumesMarkerWalk(t *testing.T) {
+	data := testJPEG(t, 0)
+
+	// the image is written in small pieces, the walk stops at most at the 4 bytes of a segment header before their end
+	cs := NewCameraSource("10.0.0.10")
+	var frames []CameraFrame
+	for offset := 0; offset < len(data); offset += 100 {
+		end := offset + 100
+		if end > len(data) {
+			end = len(data)
+		}
+		frames = append(frames, cs.Write(data[offset:end], testStart)...)
+
+		if end < len(data) && cs.scan.offset < end-3 {
+			t.Fatalf("the walk is at byte %d of %d buffered bytes", cs.scan.offset, len(cs.buffer))
+		}
+	}
+
+	if len(frames) != 1 || !bytes.Equal(frames[0].Data, data) {
+		t.Fatalf("reassembled %d images", len(frames))
+	}
+	if cs.scan != (jpegScan{}) || len(cs.buffer) != 0 {
+		t.Errorf("the walk of the next image starts at %+v with %d bytes", cs.scan, len(cs.buffer))
+	}
+}
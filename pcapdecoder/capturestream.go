@@ -0,0 +1,135 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+)
+
+// StdinFile is the PCAP file name of a capture read from the standard input
+const StdinFile = "-"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// captureStream is the content of a capture file or the standard input, decompressed by its magic bytes
+type captureStream struct {
+	*bufio.Reader
+	// isFile tells that the content is a plain file, which can be opened again by its name
+	isFile       bool
+	isCompressed bool
+	closers      []func() error
+}
+
+func openCaptureStream(fileName string) (*captureStream, error) {
+	cs := &captureStream{isFile: fileName != StdinFile}
+	f := os.Stdin
+	if cs.isFile {
+		var err error
+		if f, err = os.Open(fileName); err != nil {
+			return nil, err
+		}
+		cs.closers = append(cs.closers, f.Close)
+	}
+	cs.Reader = bufio.NewReaderSize(f, 1<<16)
+
+	magic, _ := cs.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(cs.Reader)
+		if err != nil {
+			cs.Close()
+			return nil, err
+		}
+		cs.closers = append(cs.closers, gz.Close)
+		cs.Reader = bufio.NewReaderSize(gz, 1<<16)
+		cs.isFile = false
+		cs.isCompressed = true
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(cs.Reader)
+		if err != nil {
+			cs.Close()
+			return nil, err
+		}
+		cs.closers = append(cs.closers, func() error {
+			zr.Close()
+			return nil
+		})
+		cs.Reader = bufio.NewReaderSize(zr, 1<<16)
+		cs.isFile = false
+		cs.isCompressed = true
+	}
+	return cs, nil
+}
+
+// Close releases the decompressor and closes the file, the standard input stays open
+func (cs *captureStream) Close() error {
+	var err error
+	for i := len(cs.closers) - 1; i >= 0; i-- {
+		if closeErr := cs.closers[i](); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// pcapStream reads a PCAP file in pure Go, from a compressed file, the standard input, the offset of a resumed file or any file of the purego build
+type pcapStream struct {
+	*pcapgo.Reader
+	stream *captureStream
+}
+
+func newPcapStream(stream *captureStream) (packetDataSource, error) {
+	reader, err := pcapgo.NewReader(stream)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	// like libpcap, a file without a snap length holds packets of any length
+	if reader.Snaplen() == 0 {
+		reader.SetSnaplen(maxSnapLen)
+	}
+	return &pcapStream{Reader: reader, stream: stream}, nil
+}
+
+func (ps *pcapStream) LinkTypes() []layers.LinkType {
+	return []layers.LinkType{ps.LinkType()}
+}
+
+func (ps *pcapStream) SnapLen() uint32 {
+	return ps.Snaplen()
+}
+
+func (ps *pcapStream) Close() error {
+	return ps.stream.Close()
+}
+
+// openPcapFileAt reads a plain PCAP file from the byte offset of a packet
+func openPcapFileAt(fileName string, offset int64) (packetDataSource, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, pcapHeaderLength)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// the file header is followed by the packets from the offset on
+	return newPcapStream(&captureStream{
+		Reader:  bufio.NewReaderSize(io.MultiReader(bytes.NewReader(header), f), 1<<16),
+		closers: []func() error{f.Close}})
+}
@@ -0,0 +1,109 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CaptureWriter writes packets with their record time into a pcap file, or a pcapng file with nanosecond timestamps
+// that keeps the interface IDs of the packets
+type CaptureWriter struct {
+	FileName    string
+	PacketCount uint
+	f           *os.File
+	bw          *bufio.Writer
+	pcap        *pcapgo.Writer
+	ng          *pcapgo.NgWriter
+	linkType    layers.LinkType
+	snapLen     uint32
+	interfaces  int
+	// pcapInterface is the interface of the packets of a pcap file, which has no interface IDs
+	pcapInterface int
+}
+
+// NewCaptureWriter creates the capture file, in the pcapng format when the file name ends with .pcapng.
+// A pcapng file keeps the comment in its section header, a pcap file has no room for it.
+func NewCaptureWriter(fileName string, linkType layers.LinkType, snapLen uint32, comment string) (*CaptureWriter, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	cw := &CaptureWriter{FileName: fileName, f: f, linkType: linkType, snapLen: snapLen, interfaces: 1, pcapInterface: -1}
+	if isPcapngFile(fileName) {
+		intf := pcapgo.DefaultNgInterface
+		intf.LinkType = linkType
+		intf.SnapLength = snapLen
+		options := pcapgo.DefaultNgWriterOptions
+		options.SectionInfo.Comment = comment
+		cw.ng, err = pcapgo.NewNgWriterInterface(f, intf, options)
+	} else {
+		cw.bw = bufio.NewWriter(f)
+		cw.pcap = pcapgo.NewWriter(cw.bw)
+		err = cw.pcap.WriteFileHeader(snapLen, linkType)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cw, nil
+}
+
+// isPcapngFile tells that a capture file of this name is written in the pcapng format
+func isPcapngFile(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".pcapng")
+}
+
+// WritePacket appends the packet data with its capture info
+func (cw *CaptureWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	// the interface of a pcapng packet holds its link type
+	if len(ci.AncillaryData) > 0 {
+		if linkType, ok := ci.AncillaryData[0].(layers.LinkType); ok && linkType != cw.linkType {
+			return fmt.Errorf("%s: packet of link type %s in a capture of link type %s", cw.FileName, linkType, cw.linkType)
+		}
+	}
+
+	if cw.ng == nil {
+		if cw.pcapInterface < 0 {
+			cw.pcapInterface = ci.InterfaceIndex
+		} else if ci.InterfaceIndex != cw.pcapInterface {
+			return fmt.Errorf("%s: packets of several capture interfaces need a .pcapng file", cw.FileName)
+		}
+		cw.PacketCount++
+		return cw.pcap.WritePacket(ci, data)
+	}
+
+	cw.PacketCount++
+
+	for cw.interfaces <= ci.InterfaceIndex {
+		intf := pcapgo.DefaultNgInterface
+		intf.Name = fmt.Sprintf("intf%d", cw.interfaces)
+		intf.LinkType = cw.linkType
+		intf.SnapLength = cw.snapLen
+		if _, err := cw.ng.AddInterface(intf); err != nil {
+			return err
+		}
+		cw.interfaces++
+	}
+	return cw.ng.WritePacket(ci, data)
+}
+
+// Close flushes the buffered packets and closes the file
+func (cw *CaptureWriter) Close() error {
+	var err error
+	if cw.ng != nil {
+		err = cw.ng.Flush()
+	} else {
+		err = cw.bw.Flush()
+	}
+	if closeErr := cw.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+package pcapdecoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkpointFile holds the decoding state in the output path until the decoding is finished
+const checkpointFile = "checkpoint.json"
+
+// MinCheckpointInterval keeps the encoding of the state, with the pending points of every source,
+// a small part of the decoding time
+const MinCheckpointInterval = time.Second
+
+// checkpoint is the decoding state after a packet, from which a rerun of the same command resumes the decoding
+// with the same frame numbers. The frames that were completed after the checkpoint are decoded again.
+type checkpoint struct {
+	Args      []string          `json:"args"`
+	Inputs    []checkpointInput `json:"inputs"`
+	Time      time.Time         `json:"time"`
+	Positions []filePosition    `json:"positions"`
+	Lidars    []lidarState      `json:"lidars"`
+	Cameras   []cameraState     `json:"cameras"`
+}
+
+// checkpointInput identifies an input file, so that a changed file is decoded from the start
+type checkpointInput struct {
+	FileName string    `json:"fileName"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// lidarState is the state of a LidarSource between two packets. The points are
+// distance, azimuth, next azimuth, row index, product ID and intensity.
+type lidarState struct {
+	Address           string      `json:"address"`
+	Interface         int         `json:"interface"`
+	InitialAzimuth    uint16      `json:"initialAzimuth"`
+	NextPacketAzimuth uint16      `json:"nextPacketAzimuth"`
+	CurrentPacket     LidarPacket `json:"currentPacket"`
+	CurrentPacketTime time.Time   `json:"currentPacketTime"`
+	FrameIndex        uint        `json:"frameIndex"`
+	FrameTime         time.Time   `json:"frameTime"`
+	Points            [][6]uint16 `json:"points"`
+	Buffer            [][6]uint16 `json:"buffer"`
+}
+
+// cameraState is the state of a CameraSource with the fragments of its next image
+type cameraState struct {
+	Address    string    `json:"address"`
+	Interface  int       `json:"interface"`
+	FrameIndex uint      `json:"frameIndex"`
+	FrameTime  time.Time `json:"frameTime"`
+	Buffer     []byte    `json:"buffer"`
+}
+
+// checkpointer writes the decoding state of ParsePCAP into the output path every interval
+type checkpointer struct {
+	fileName string
+	interval time.Duration
+	last     time.Time
+	reader   *packetReader
+	decoder  *Decoder
+	args     []string
+	inputs   []checkpointInput
+}
+
+func newCheckpointer(reader *packetReader, decoder *Decoder, fileNames []string) (*checkpointer, error) {
+	c := &checkpointer{
+		fileName: filepath.Join(global.UserInput.OutputPath, checkpointFile),
+		interval: global.UserInput.Checkpoint,
+		last:     time.Now(),
+		reader:   reader,
+		decoder:  decoder,
+		args:     os.Args[1:]}
+
+	for _, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return nil, err
+		}
+		c.inputs = append(c.inputs, checkpointInput{FileName: fileName, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return c, nil
+}
+
+// resume restores the state of the checkpoint of a previous run of the same command on the same files, if any
+func (c *checkpointer) resume() error {
+	data, err := ioutil.ReadFile(c.fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("%s: %v", c.fileName, err)
+	}
+	if !cp.isSameRun(c.args, c.inputs) {
+		fmt.Fprintf(os.Stderr, "%s is of another command or of changed files, decoding from the start\n", c.fileName)
+		return nil
+	}
+
+	if err := c.reader.Seek(cp.Positions); err != nil {
+		return err
+	}
+	for _, state := range cp.Lidars {
+		ls, err := state.restore()
+		if err != nil {
+			return err
+		}
+		c.decoder.lidarSources[ls.ID()] = ls
+		fmt.Fprintf(os.Stderr, "%s: resuming at frame %d\n", ls.Name(), ls.CurrentFrame.Index)
+	}
+	for _, state := range cp.Cameras {
+		cs := state.restore()
+		c.decoder.cameraSources[sourceID(cs.Address, cs.Interface)] = cs
+	}
+	fmt.Fprintf(os.Stderr, "resumed from the checkpoint of %s\n", cp.Time.Format(time.RFC3339))
+	return nil
+}
+
+// update writes a checkpoint when the interval has passed since the last one
+func (c *checkpointer) update() error {
+	if time.Since(c.last) < c.interval {
+		return nil
+	}
+	c.last = time.Now()
+
+	cp := checkpoint{
+		Args:      c.args,
+		Inputs:    c.inputs,
+		Time:      c.last,
+		Positions: c.reader.Positions()}
+	for _, ls := range c.decoder.lidarSources {
+		cp.Lidars = append(cp.Lidars, newLidarState(&ls))
+	}
+	for _, cs := range c.decoder.cameraSources {
+		cp.Cameras = append(cp.Cameras, newCameraState(cs))
+	}
+	sort.Slice(cp.Lidars, func(i, j int) bool {
+		return sourceID(cp.Lidars[i].Address, cp.Lidars[i].Interface) < sourceID(cp.Lidars[j].Address, cp.Lidars[j].Interface)
+	})
+	sort.Slice(cp.Cameras, func(i, j int) bool {
+		return sourceID(cp.Cameras[i].Address, cp.Cameras[i].Interface) < sourceID(cp.Cameras[j].Address, cp.Cameras[j].Interface)
+	})
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	// an interrupted write leaves the previous checkpoint
+	temporary := c.fileName + ".tmp"
+	if err := ioutil.WriteFile(temporary, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, c.fileName)
+}
+
+// finish removes the checkpoint of the finished decoding
+func (c *checkpointer) finish() error {
+	if err := os.Remove(c.fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (cp *checkpoint) isSameRun(args []string, inputs []checkpointInput) bool {
+	if strings.Join(cp.Args, "\x00") != strings.Join(args, "\x00") || len(cp.Inputs) != len(inputs) {
+		return false
+	}
+	for i, input := range inputs {
+		if cp.Inputs[i].FileName != input.FileName || cp.Inputs[i].Size != input.Size || !cp.Inputs[i].ModTime.Equal(input.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+func newLidarState(ls *LidarSource) lidarState {
+	return lidarState{
+		Address:           ls.Address,
+		Interface:         ls.Interface,
+		InitialAzimuth:    ls.InitialAzimuth,
+		NextPacketAzimuth: ls.NextPacketAzimuth,
+		CurrentPacket:     ls.CurrentPacket,
+		CurrentPacketTime: ls.CurrentPacketTime,
+		FrameIndex:        ls.CurrentFrame.Index,
+		FrameTime:         ls.CurrentFrame.Time,
+		Points:            encodeLidarPoints(ls.CurrentFrame.Points),
+		Buffer:            encodeLidarPoints(ls.Buffer)}
+}
+
+// restore creates the LidarSource of the state, with the calibration of the current registry
+func (state *lidarState) restore() (LidarSource, error) {
+	ls, err := NewLidarSource(state.Address, state.InitialAzimuth, state.FrameTime)
+	if err != nil {
+		return LidarSource{}, err
+	}
+	ls.Interface = state.Interface
+	ls.NextPacketAzimuth = state.NextPacketAzimuth
+	ls.CurrentPacket = state.CurrentPacket
+	ls.CurrentPacketTime = state.CurrentPacketTime
+	ls.CurrentFrame.Index = state.FrameIndex
+	ls.CurrentFrame.Points = decodeLidarPoints(state.Points)
+	ls.Buffer = decodeLidarPoints(state.Buffer)
+	return ls, nil
+}
+
+func newCameraState(cs *CameraSource) cameraState {
+	return cameraState{
+		Address:    cs.Address,
+		Interface:  cs.Interface,
+		FrameIndex: cs.FrameIndex,
+		FrameTime:  cs.frameTime,
+		Buffer:     cs.buffer}
+}
+
+func (state *cameraState) restore() *CameraSource {
+	cs := NewCameraSource(state.Address)
+	cs.Interface = state.Interface
+	cs.FrameIndex = state.FrameIndex
+	cs.frameTime = state.FrameTime
+	cs.buffer = state.Buffer
+	return cs
+}
+
+func encodeLidarPoints(points []LidarPoint) [][6]uint16 {
+	values := make([][6]uint16, len(points))
+	for i, p := range points {
+		values[i] = [6]uint16{p.distance, p.azimuth, p.nextAzimuth, uint16(p.rowIndex), uint16(p.productID), uint16(p.Intensity)}
+	}
+	return values
+}
+
+func decodeLidarPoints(values [][6]uint16) []LidarPoint {
+	if len(values) == 0 {
+		return nil
+	}
+	points := make([]LidarPoint, len(values))
+	for i, v := range values {
+		points[i] = LidarPoint{
+			distance:    v[0],
+			azimuth:     v[1],
+			nextAzimuth: v[2],
+			rowIndex:    uint8(v[3]),
+			productID:   byte(v[4]),
+			Intensity:   byte(v[5])}
+	}
+	return points
+}
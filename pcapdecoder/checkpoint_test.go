@@ -0,0 +1,165 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// checkpointRun holds the frames of a run of runWithCheckpoints
+type checkpointRun struct {
+	lidarFrames  map[string][]LidarFrame
+	cameraFrames []CameraFrame
+}
+
+// runWithCheckpoints decodes the files with a checkpoint every 50 packets, until the packet limit or the end
+func runWithCheckpoints(t *testing.T, fileNames []string, packetLimit int) checkpointRun {
+	t.Helper()
+	reader, err := openPacketReader(fileNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	run := checkpointRun{lidarFrames: make(map[string][]LidarFrame)}
+	d := NewDecoder()
+	d.AddFrameHandler(func(ls *LidarSource, frame *LidarFrame) error {
+		run.lidarFrames[ls.ID()] = append(run.lidarFrames[ls.ID()], copyFrame(frame))
+		return nil
+	})
+	d.AddCameraHandler(func(cs *CameraSource, frame *CameraFrame) error {
+		run.cameraFrames = append(run.cameraFrames, *frame)
+		return nil
+	})
+
+	checkpoints, err := newCheckpointer(reader, d, fileNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints.interval = 0
+	if err := checkpoints.resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	for packets := 0; packetLimit < 0 || packets < packetLimit; packets++ {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			if err := checkpoints.finish(); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.DecodePacket(packet); err != nil {
+			t.Fatal(err)
+		}
+		if packets%50 != 49 {
+			continue
+		}
+		if err := checkpoints.update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return run
+}
+
+func TestCheckpointResumesWithSameFrames(t *testing.T) {
+	keepUserInput(t)
+
+	folder := t.TempDir()
+	global.UserInput.OutputPath = folder
+
+	// lidar packets of two sources with camera images between them
+	packets := lidarCapture(t, 400)
+	for i := 0; i < 3; i++ {
+		recordTime := testStart.Add(time.Duration(i)*100*time.Millisecond + 200*time.Microsecond)
+		for _, payload := range cameraPayloads(testJPEG(t, i)) {
+			packets = append(packets, testPacket{time: recordTime, data: udpPacket(t, "10.0.0.10", 5000, payload)})
+			recordTime = recordTime.Add(10 * time.Microsecond)
+		}
+	}
+	sort.SliceStable(packets, func(i, j int) bool { return packets[i].time.Before(packets[j].time) })
+
+	// the capture is rotated into two files, which are resumed at their positions
+	fileNames := []string{filepath.Join(folder, "capture1.pcap"), filepath.Join(folder, "capture2.pcap")}
+	writePcap(t, fileNames[0], packets[:len(packets)/2])
+	writePcap(t, fileNames[1], packets[len(packets)/2:])
+
+	expected := runWithCheckpoints(t, fileNames, -1)
+	if _, err := os.Stat(filepath.Join(folder, checkpointFile)); !os.IsNotExist(err) {
+		t.Fatalf("the checkpoint of the finished decoding is not removed: %v", err)
+	}
+
+	// an interrupted run within the second frame and the camera images is resumed
+	runWithCheckpoints(t, fileNames, 250)
+	resumed := runWithCheckpoints(t, fileNames, -1)
+
+	for _, id := range []string{"10.0.0.1", "10.0.0.2"} {
+		frames := resumed.lidarFrames[id]
+		all := expected.lidarFrames[id]
+		if len(frames) == 0 || len(frames) == len(all) {
+			t.Fatalf("%s: decoded %d of %d frames after the checkpoint", id, len(frames), len(all))
+		}
+		for i, frame := range frames {
+			original := all[len(all)-len(frames)+i]
+			if frame.Index != original.Index || !frame.Time.Equal(original.Time) || !reflect.DeepEqual(frame.Points, original.Points) {
+				t.Errorf("%s: resumed frame %d differs from frame %d", id, frame.Index, original.Index)
+			}
+		}
+	}
+
+	frames := resumed.cameraFrames
+	all := expected.cameraFrames
+	if len(frames) == 0 || len(frames) > len(all) {
+		t.Fatalf("decoded %d of %d camera images after the checkpoint", len(frames), len(all))
+	}
+	for i, frame := range frames {
+		original := all[len(all)-len(frames)+i]
+		if frame.Index != original.Index || !frame.Time.Equal(original.Time) || !bytes.Equal(frame.Data, original.Data) {
+			t.Errorf("resumed camera image %d differs from image %d", frame.Index, original.Index)
+		}
+	}
+}
+
+func TestCheckpointWaitsForInterval(t *testing.T) {
+	keepUserInput(t)
+
+	folder := t.TempDir()
+	global.UserInput.OutputPath = folder
+	global.UserInput.Checkpoint = MinCheckpointInterval
+	fileName := filepath.Join(folder, "capture.pcap")
+	writePcap(t, fileName, lidarPackets(t, "10.0.0.1", testStart, 10))
+
+	reader, err := openPacketReader([]string{fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	checkpoints, err := newCheckpointer(reader, NewDecoder(), []string{fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is written once per interval, not after every packet
+	if err := checkpoints.update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, checkpointFile)); !os.IsNotExist(err) {
+		t.Fatalf("a checkpoint is written before the interval: %v", err)
+	}
+	checkpoints.last = checkpoints.last.Add(-MinCheckpointInterval)
+	if err := checkpoints.update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, checkpointFile)); err != nil {
+		t.Fatalf("no checkpoint after the interval: %v", err)
+	}
+}
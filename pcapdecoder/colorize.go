@@ -0,0 +1,212 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/color"
+	"time"
+)
+
+// maxDecodedImages is the number of recent camera packet images kept by the Colorizer for each camera
+const maxDecodedImages = 30
+
+// maxPendingFrames bounds the frames waiting for the next camera image, the oldest ones are colorized
+// with the images at hand beyond it
+const maxPendingFrames = 50
+
+// ColoredPoint is a CartesianPoint with the color of the camera image it falls into.
+// Points outside of all cameras have the gray of their intensity.
+type ColoredPoint struct {
+	CartesianPoint
+	R         uint8 `json:"r"`
+	G         uint8 `json:"g"`
+	B         uint8 `json:"b"`
+	IsColored bool  `json:"-"`
+}
+
+// PointsHandler processes the colored points of a frame
+type PointsHandler func(ls *LidarSource, frame *LidarFrame, points []ColoredPoint) error
+
+// Colorizer samples the colors of the lidar points from the time-nearest camera images
+type Colorizer struct {
+	cameras   []Camera
+	images    map[string][]CameraImage
+	maxOffset time.Duration
+	loaded    map[string]loadedImage
+	// isStreamed tells if the images come from the camera packets instead of the camera images folder
+	isStreamed bool
+	isClosed   bool
+	pending    []pendingFrame
+}
+
+type loadedImage struct {
+	source CameraImage
+	image  image.Image
+}
+
+// pendingFrame is a frame waiting for the camera images after its time
+type pendingFrame struct {
+	source  LidarSource
+	frame   LidarFrame
+	handler PointsHandler
+}
+
+// NewColorizer creates a Colorizer of the selected cameras with the images of the camera images folder.
+// The images decoded from the camera packets are added by AddCameraFrame.
+func NewColorizer(options global.RenderInput) (*Colorizer, error) {
+	cameras, err := getCameras(options)
+	if err != nil {
+		return nil, err
+	}
+	images, err := listCameraImages(options.CameraImages, cameras)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Colorizer{
+		cameras:    cameras,
+		images:     images,
+		maxOffset:  time.Duration(options.MaxTimeOffset * float64(time.Second)),
+		loaded:     make(map[string]loadedImage),
+		isStreamed: len(options.CameraImages) == 0}, nil
+}
+
+// AddCameraFrame keeps the recent images of the camera packets of the calibrated cameras,
+// and colorizes the waiting frames that are before the image
+func (c *Colorizer) AddCameraFrame(cs *CameraSource, frame *CameraFrame) error {
+	name := cs.Calibration.Name
+	if len(name) == 0 {
+		return nil
+	}
+
+	c.images[name] = append(c.images[name], CameraImage{Time: frame.Time, Data: frame.Data})
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	// the images are kept while they may be the nearest image of a waiting frame
+	images := c.images[name]
+	for len(images) > maxDecodedImages && (len(c.pending) == 0 || !images[1].Time.After(c.pending[0].frame.Time)) {
+		images = images[1:]
+	}
+	c.images[name] = images
+	return nil
+}
+
+// ColorizeFrame passes the colored points of the frame to the handler. When the images come from the camera packets,
+// the frame waits until each camera has an image after the frame time, or until Close at the end of the camera streams,
+// so that the nearest image is known.
+func (c *Colorizer) ColorizeFrame(ls *LidarSource, frame *LidarFrame, handler PointsHandler) error {
+	pending := pendingFrame{source: *ls, frame: *frame, handler: handler}
+	pending.frame.Points = append([]LidarPoint(nil), frame.Points...)
+	c.pending = append(c.pending, pending)
+	return c.flush()
+}
+
+// Close colorizes the waiting frames with the images at hand
+func (c *Colorizer) Close() error {
+	c.isClosed = true
+	return c.flush()
+}
+
+// flush colorizes the waiting frames whose images are known
+func (c *Colorizer) flush() error {
+	overflow := len(c.pending) - maxPendingFrames
+	waiting := c.pending[:0]
+	for i, pending := range c.pending {
+		if i >= overflow && !c.isReady(pending.frame.Time) {
+			waiting = append(waiting, pending)
+			continue
+		}
+
+		points, err := c.Colorize(&pending.frame)
+		if err != nil {
+			return err
+		}
+		if err := pending.handler(&pending.source, &pending.frame, points); err != nil {
+			return err
+		}
+	}
+	c.pending = waiting
+	return nil
+}
+
+// isReady checks if all cameras have their image after the time
+func (c *Colorizer) isReady(t time.Time) bool {
+	if !c.isStreamed || c.isClosed {
+		return true
+	}
+	for i := range c.cameras {
+		images := c.images[c.cameras[i].Calibration.Name]
+		if len(images) == 0 || images[len(images)-1].Time.Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Colorize returns the points of the frame in the vehicle coordinates with their colors.
+// A point seen by several cameras gets the color of the first one.
+func (c *Colorizer) Colorize(frame *LidarFrame) ([]ColoredPoint, error) {
+	cartesianPoints := frame.CartesianPoints(frame.rotation, frame.translation)
+
+	points := make([]ColoredPoint, len(cartesianPoints))
+	for i, cp := range cartesianPoints {
+		points[i] = ColoredPoint{CartesianPoint: cp, R: cp.Intensity, G: cp.Intensity, B: cp.Intensity}
+	}
+
+	for i := range c.cameras {
+		camera := &c.cameras[i]
+		m, err := c.getImage(camera.Calibration.Name, frame.Time)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+
+		// the image may be scaled from the calibrated size
+		bounds := m.Bounds()
+		scaleX := float64(bounds.Dx()) / float64(camera.Calibration.Intrinsics.Width)
+		scaleY := float64(bounds.Dy()) / float64(camera.Calibration.Intrinsics.Height)
+
+		for j := range points {
+			if points[j].IsColored {
+				continue
+			}
+			pixel, ok := camera.Project(points[j].CartesianPoint)
+			if !ok {
+				continue
+			}
+
+			x := bounds.Min.X + int(pixel.U*scaleX)
+			y := bounds.Min.Y + int(pixel.V*scaleY)
+			rgba := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+			points[j].R, points[j].G, points[j].B = rgba.R, rgba.G, rgba.B
+			points[j].IsColored = true
+		}
+	}
+
+	return points, nil
+}
+
+// getImage returns the decoded image of the camera nearest to the time, or nil when there is none within the maximum offset
+func (c *Colorizer) getImage(name string, t time.Time) (image.Image, error) {
+	cameraImage, ok := findCameraImage(c.images[name], t, c.maxOffset)
+	if !ok {
+		return nil, nil
+	}
+
+	// consecutive frames of several lidars often share the same image
+	loaded, ok := c.loaded[name]
+	if ok && loaded.source.Time.Equal(cameraImage.Time) && loaded.source.FileName == cameraImage.FileName {
+		return loaded.image, nil
+	}
+
+	m, err := cameraImage.Load()
+	if err != nil {
+		return nil, err
+	}
+	c.loaded[name] = loadedImage{source: cameraImage, image: m}
+	return m, nil
+}
@@ -0,0 +1,85 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+// solidJPEG encodes an image of one color
+func solidJPEG(t *testing.T, c color.RGBA) []byte {
+	t.Helper()
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(m, m.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestColorizerWaitsForNextImage(t *testing.T) {
+	keepVehicle(t)
+	registry.Current = &registry.Vehicle{ID: "car1", Cameras: []registry.CameraCalib{pinholeCamera}}
+	options := global.UserInput.Render
+	options.MaxTimeOffset = 0.2
+	c, err := NewColorizer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &CameraSource{Address: "10.0.1.1", Calibration: pinholeCamera}
+	red, blue := solidJPEG(t, color.RGBA{255, 0, 0, 255}), solidJPEG(t, color.RGBA{0, 0, 255, 255})
+	var colors []color.RGBA
+	handler := func(ls *LidarSource, frame *LidarFrame, points []ColoredPoint) error {
+		if len(points) != 1 || !points[0].IsColored {
+			t.Fatalf("frame %d has the points %+v", frame.Index, points)
+		}
+		colors = append(colors, color.RGBA{points[0].R, points[0].G, points[0].B, 255})
+		return nil
+	}
+
+	// the frame completes before the image that is nearest to its time
+	frame := LidarFrame{Time: testStart.Add(50 * time.Millisecond), Points: []LidarPoint{testPoint(1, 5, 0, 0)}}
+	if err := c.AddCameraFrame(cs, &CameraFrame{Time: testStart, Data: red}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ColorizeFrame(&LidarSource{Address: "10.0.0.1"}, &frame, handler); err != nil {
+		t.Fatal(err)
+	}
+	// the decoder reuses the points of the frame
+	frame.Points[0] = testPoint(1, 5, 180, 0)
+	if len(colors) != 0 {
+		t.Fatal("the frame is colorized before the next image")
+	}
+
+	if err := c.AddCameraFrame(cs, &CameraFrame{Time: testStart.Add(60 * time.Millisecond), Data: blue}); err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 1 || colors[0].B < 200 || colors[0].R > 50 {
+		t.Fatalf("the frame has the colors %v, expected the blue of the next image", colors)
+	}
+
+	// the last frame waits until the end of the camera stream
+	frame.Index, frame.Time = 1, testStart.Add(150*time.Millisecond)
+	frame.Points[0] = testPoint(1, 5, 0, 0)
+	if err := c.ColorizeFrame(&LidarSource{Address: "10.0.0.1"}, &frame, handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 1 {
+		t.Fatal("the last frame is colorized before the end of the camera stream")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 2 || colors[1].B < 200 {
+		t.Errorf("the last frame has the colors %v", colors)
+	}
+}
@@ -0,0 +1,75 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Colormap converts a normalized value between 0 and 1 into a color
+type Colormap func(value float64) color.RGBA
+
+var colormaps = map[string]Colormap{
+	"viridis": newColormap([][3]uint8{
+		{68, 1, 84}, {72, 40, 120}, {62, 74, 137}, {49, 104, 142}, {38, 130, 142},
+		{31, 158, 137}, {53, 183, 121}, {109, 205, 89}, {180, 222, 44}, {253, 231, 37}}),
+	"jet": newColormap([][3]uint8{
+		{0, 0, 143}, {0, 0, 255}, {0, 127, 255}, {0, 255, 255}, {127, 255, 127},
+		{255, 255, 0}, {255, 127, 0}, {255, 0, 0}, {127, 0, 0}}),
+	"turbo": newColormap([][3]uint8{
+		{48, 18, 59}, {70, 107, 227}, {40, 187, 236}, {49, 242, 153}, {162, 252, 60},
+		{237, 208, 58}, {251, 128, 34}, {208, 47, 5}, {122, 4, 3}}),
+	"hot": newColormap([][3]uint8{
+		{10, 0, 0}, {255, 0, 0}, {255, 255, 0}, {255, 255, 255}}),
+	"gray": newColormap([][3]uint8{
+		{0, 0, 0}, {255, 255, 255}}),
+	"green": newColormap([][3]uint8{
+		{0, 255, 0}, {0, 255, 0}}),
+}
+
+// GetColormap returns the colormap of the name
+func GetColormap(name string) (Colormap, error) {
+	colormap, ok := colormaps[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("colormap %q is not supported, use one of [%s]", name, strings.Join(ColormapNames(), ", "))
+	}
+	return colormap, nil
+}
+
+// ColormapNames returns the names of the supported colormaps
+func ColormapNames() []string {
+	names := make([]string, 0, len(colormaps))
+	for name := range colormaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newColormap interpolates linearly between evenly spaced colors
+func newColormap(stops [][3]uint8) Colormap {
+	return func(value float64) color.RGBA {
+		if math.IsNaN(value) || value < 0 {
+			value = 0
+		} else if value > 1 {
+			value = 1
+		}
+
+		position := value * float64(len(stops)-1)
+		index := int(position)
+		if index >= len(stops)-1 {
+			index = len(stops) - 2
+		}
+		weight := position - float64(index)
+
+		var c [3]uint8
+		for i := range c {
+			from := float64(stops[index][i])
+			to := float64(stops[index+1][i])
+			c[i] = uint8(math.Round(from + (to-from)*weight))
+		}
+		return color.RGBA{c[0], c[1], c[2], 255}
+	}
+}
@@ -30,7 +30,7 @@ func setBlocks(data *[]byte, blocks *[]LidarBlock) {
 	blkIndex := uint8(0)
 	var blocksWG sync.WaitGroup
 	blocksWG.Add(12)
-	for index := uint16(42); index < 1242; index += 100 {
+	for index := uint16(0); index < 1200; index += 100 {
 		// Set Azimuth
 		(*blocks)[blkIndex].Azimuth = binary.LittleEndian.Uint16((*data)[index+2 : index+4])
 
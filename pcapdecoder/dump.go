@@ -0,0 +1,151 @@
+package pcapdecoder
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DumpRecord is a raw lidar packet together with its PCAP record info
+type DumpRecord struct {
+	Index      int       `json:"index"`
+	RecordTime time.Time `json:"recordTime"`
+	Address    string    `json:"address"`
+	LidarPacket
+}
+
+var csvHeader = []string{
+	"index", "recordTime", "address", "timestamp", "productID", "returnMode",
+	"block", "azimuth", "channel", "distance", "reflectivity"}
+
+// DumpPCAP writes the raw lidar packets of the PCAP file as NDJSON or CSV
+func DumpPCAP() error {
+	format := global.UserInput.DumpFormat
+	if format != "ndjson" && format != "csv" {
+		return fmt.Errorf("dump format %q is not supported", format)
+	}
+
+	reader, err := openPacketReader(global.UserInput.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	outputFileName := filepath.Join(global.UserInput.OutputPath, "packets."+format)
+	f, err := os.Create(outputFileName)
+	if err != nil {
+		return err
+	}
+
+	if err := dumpPackets(reader, f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dumpPackets writes the lidar packets within the packet range into the file
+func dumpPackets(reader *packetReader, f io.Writer, format string) error {
+	var writeRecord func(record *DumpRecord) error
+	flush := func() error { return nil }
+	if format == "csv" {
+		w := csv.NewWriter(f)
+		if err := w.Write(csvHeader); err != nil {
+			return err
+		}
+		writeRecord = func(record *DumpRecord) error {
+			return writeCSVRecord(w, record)
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		encoder := json.NewEncoder(f)
+		writeRecord = func(record *DumpRecord) error {
+			return encoder.Encode(record)
+		}
+	}
+
+	startPacket := global.UserInput.StartPacket
+	endPacket := global.UserInput.EndPacket
+
+	index := -1
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		payload := getPayload(packet)
+		if len(payload) != lidarPayloadLength {
+			continue
+		}
+
+		index++
+		if index < startPacket {
+			continue
+		}
+		if endPacket >= 0 && index > endPacket {
+			break
+		}
+
+		address := getIPv4(packet)
+		if !global.UserInput.IsWhitelisted(address) {
+			continue
+		}
+
+		lidarPacket, err := NewLidarPacket(&payload)
+		if err != nil {
+			return fmt.Errorf("packet %d of %s: %v", index, address, err)
+		}
+
+		err = writeRecord(&DumpRecord{
+			Index:       index,
+			RecordTime:  packet.Metadata().Timestamp,
+			Address:     address,
+			LidarPacket: lidarPacket})
+		if err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// writeCSVRecord writes one row per channel of the record
+func writeCSVRecord(w *csv.Writer, record *DumpRecord) error {
+	row := make([]string, len(csvHeader))
+	row[0] = strconv.Itoa(record.Index)
+	row[1] = record.RecordTime.Format(time.RFC3339Nano)
+	row[2] = record.Address
+	row[3] = strconv.FormatUint(uint64(record.TimeStamp), 10)
+	row[4] = fmt.Sprintf("0x%x", record.ProductID)
+	row[5] = fmt.Sprintf("0x%x", record.ReturnMode)
+
+	for blkIndex, block := range record.Blocks {
+		row[6] = strconv.Itoa(blkIndex)
+		row[7] = strconv.FormatUint(uint64(block.Azimuth), 10)
+
+		for chIndex, channel := range block.Channels {
+			row[8] = strconv.Itoa(chIndex)
+			row[9] = strconv.FormatUint(uint64(channel.Distance), 10)
+			row[10] = strconv.FormatUint(uint64(channel.Reflectivity), 10)
+
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
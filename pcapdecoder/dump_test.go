@@ -0,0 +1,153 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dumpCapture writes a capture of two lidar sources of 10 packets each, with a position packet, and selects it as input
+func dumpCapture(t *testing.T, format string) string {
+	t.Helper()
+	keepUserInput(t)
+
+	folder := t.TempDir()
+	fileName := filepath.Join(folder, "capture.pcap")
+	packets := lidarCapture(t, 10)
+	packets = append(packets[:1], append([]testPacket{{
+		time: packets[0].time,
+		data: udpPacket(t, "10.0.0.2", 8308, make([]byte, 512))}}, packets[1:]...)...)
+	writePcap(t, fileName, packets)
+
+	ui := &global.UserInput
+	ui.PcapFiles = *cli.NewStringSlice(fileName)
+	ui.OutputPath = folder
+	ui.DumpFormat = format
+	// the lidar packets are numbered across the sources, 10.0.0.2 has the odd ones
+	ui.StartPacket = 2
+	ui.EndPacket = 7
+	ui.Channels = *cli.NewStringSlice("10.0.0.2")
+	return filepath.Join(folder, "packets."+format)
+}
+
+func TestDumpPCAPWritesNDJSON(t *testing.T) {
+	fileName := dumpCapture(t, "ndjson")
+	if err := DumpPCAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []DumpRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var record DumpRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %v", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("dumped %d packets, expected 3", len(records))
+	}
+	for i, record := range records {
+		index := 3 + 2*i
+		// the packet of the source within the capture
+		packet := index / 2
+		if record.Index != index || record.Address != "10.0.0.2" {
+			t.Errorf("record %d is packet %d of %s, expected packet %d of 10.0.0.2", i, record.Index, record.Address, index)
+		}
+		if !record.RecordTime.Equal(testStart.Add(500*time.Microsecond + time.Duration(packet)*time.Millisecond)) {
+			t.Errorf("record %d is recorded at %s", i, record.RecordTime)
+		}
+		if record.TimeStamp != uint32(1000*(packet+1)) || record.ProductID != 0x22 || record.ReturnMode != strongestReturn || record.IsDualMode {
+			t.Errorf("record %d has timestamp %d, product ID 0x%x, return mode 0x%x, dual %t",
+				i, record.TimeStamp, record.ProductID, record.ReturnMode, record.IsDualMode)
+		}
+		if len(record.Blocks) != 12 || len(record.Blocks[11].Channels) != 32 {
+			t.Fatalf("record %d has %d blocks", i, len(record.Blocks))
+		}
+		if azimuth := record.Blocks[11].Azimuth; azimuth != uint16((packet*12+11)*37) {
+			t.Errorf("record %d has the azimuth %d in block 11", i, azimuth)
+		}
+		if channel := record.Blocks[11].Channels[31]; channel.Distance != uint16(1000+packet+31) || channel.Reflectivity != 11+31 {
+			t.Errorf("record %d has channel %+v in block 11", i, channel)
+		}
+	}
+}
+
+func TestDumpPCAPWritesCSV(t *testing.T) {
+	fileName := dumpCapture(t, "csv")
+	if err := DumpPCAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one row per channel of each block
+	if len(rows) != 1+3*12*32 {
+		t.Fatalf("dumped %d rows, expected %d", len(rows), 1+3*12*32)
+	}
+	if len(rows[0]) != len(csvHeader) || rows[0][0] != "index" {
+		t.Errorf("header is %v", rows[0])
+	}
+	expected := []string{"3", rows[1][1], "10.0.0.2", "2000", "0x22", "0x37", "0", "444", "0", "1001", "0"}
+	for i, value := range rows[1] {
+		if value != expected[i] {
+			t.Errorf("%s is %s, expected %s", csvHeader[i], value, expected[i])
+		}
+	}
+	if last := rows[len(rows)-1]; last[0] != "7" || last[6] != "11" || last[8] != "31" {
+		t.Errorf("last row is %v", last)
+	}
+}
+
+func TestDumpPCAPReturnsReadErrors(t *testing.T) {
+	dumpCapture(t, "ndjson")
+
+	// a compressed capture cut in the middle of a packet
+	data, err := ioutil.ReadFile(global.UserInput.PcapFiles.Value()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(data[:len(data)-100])
+	writer.Close()
+	fileName := filepath.Join(global.UserInput.OutputPath, "truncated.pcap.gz")
+	if err := ioutil.WriteFile(fileName, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	global.UserInput.PcapFiles = *cli.NewStringSlice(fileName)
+	global.UserInput.EndPacket = -1
+
+	if err := DumpPCAP(); err == nil {
+		t.Error("the dump of a truncated capture succeeds")
+	}
+}
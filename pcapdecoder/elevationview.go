@@ -0,0 +1,136 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"image"
+	"math"
+	"path/filepath"
+)
+
+// ElevationView renders the depth of the points within the azimuth range of the camera.
+// Columns follow the azimuth and rows follow the height, the nearest point of each pixel is kept.
+func (lf *LidarFrame) ElevationView(camera registry.CameraCalib, options global.RenderInput, colormap Colormap) *image.RGBA {
+	width := options.ImageWidth
+	height := options.ImageHeight
+	m := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	Ar := camera.AzimuthRange()
+	arLen := (Ar[1] - Ar[0] + 36000) % 36000
+	if arLen == 0 {
+		arLen = 36000
+	}
+
+	// heights and depths in meters
+	Hr := [2]float64{options.ZMin, options.ZMax}
+	Dr := [2]float64{options.DepthMin, options.DepthMax}
+
+	depths := make([]float64, width*height)
+
+	A := getRotationMultipliers(&lf.rotation)
+	isRotated := lf.rotation != RotationAngles{}
+
+	var distance, bearing, azimuth100 float64
+
+	for _, point := range lf.Points {
+		if isRotated {
+			sp := point.GetXYZ().Rotate(&A).ToSpherical()
+
+			distance = sp.Radius
+			bearing = sp.Bearing
+			azimuth100 = sp.Azimuth * 100
+		} else {
+			distance = point.Distance()
+			bearing = point.Bearing()
+			azimuth100 = point.Azimuth() * 100
+		}
+
+		// Check if azimuth is within range
+		azimuth := (int(math.Round(azimuth100)) + 36000 - Ar[0]) % 36000
+		if azimuth >= arLen {
+			continue
+		}
+
+		h := distance * math.Sin(radians(bearing)) / 1000
+		depth := distance * math.Cos(radians(bearing)) / 1000
+		if h < Hr[0] || h >= Hr[1] || depth < Dr[0] || depth >= Dr[1] {
+			continue
+		}
+
+		xInd := int(float64(width) * float64(azimuth) / float64(arLen))
+		yInd := int(float64(height) * (Hr[1] - h) / (Hr[1] - Hr[0]))
+		if yInd >= height {
+			yInd = height - 1
+		}
+
+		index := yInd*width + xInd
+		if depths[index] != 0 && depths[index] <= depth {
+			continue
+		}
+		depths[index] = depth
+
+		// near points get the upper end of the colormap
+		m.SetRGBA(xInd, yInd, colormap((Dr[1]-depth)/(Dr[1]-Dr[0])))
+	}
+
+	return m
+}
+
+// ElevationRenderer writes the elevation views of the frames for each selected camera
+type ElevationRenderer struct {
+	options  global.RenderInput
+	colormap Colormap
+	cameras  []registry.CameraCalib
+}
+
+// NewElevationRenderer creates an ElevationRenderer of the selected cameras of the current vehicle.
+// All cameras of the vehicle are selected when no camera is given.
+func NewElevationRenderer(options global.RenderInput) (*ElevationRenderer, error) {
+	colormap, err := GetColormap(options.Colormap)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ImageWidth <= 0 || options.ImageHeight <= 0 {
+		return nil, fmt.Errorf("image size must be positive")
+	}
+	if options.ZMax <= options.ZMin || options.DepthMax <= options.DepthMin || options.DepthMin < 0 {
+		return nil, fmt.Errorf("height and depth ranges must be increasing and the depth must not be negative")
+	}
+
+	var cameras []registry.CameraCalib
+	if names := options.Cameras.Value(); len(names) > 0 {
+		for _, name := range names {
+			camera, err := registry.GetCamera(name)
+			if err != nil {
+				return nil, err
+			}
+			cameras = append(cameras, camera)
+		}
+	} else if registry.Current != nil {
+		cameras = registry.Current.Cameras
+	}
+
+	if len(cameras) == 0 {
+		return nil, fmt.Errorf("elevation view needs the camera calibrations of a vehicle")
+	}
+
+	return &ElevationRenderer{
+		options:  options,
+		colormap: colormap,
+		cameras:  cameras}, nil
+}
+
+// SaveFrame writes the elevation view of the frame for each camera into the output path
+func (r *ElevationRenderer) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	for _, camera := range r.cameras {
+		fileName := fmt.Sprintf("%s-%s-elev%d.png", ls.Name(), camera.Name, frame.Index)
+		m := frame.ElevationView(camera, r.options, r.colormap)
+
+		if err := savePNG(filepath.Join(global.UserInput.OutputPath, fileName), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"github.com/urfave/cli"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// frontCamera looks forward with a field of view of 90°
+var frontCamera = registry.CameraCalib{Name: "front", AzimuthStart: 315, AzimuthEnd: 45}
+
+func elevationOptions() global.RenderInput {
+	options := global.UserInput.Render
+	options.ImageWidth, options.ImageHeight = 90, 50
+	options.ZMin, options.ZMax = -3, 2
+	options.DepthMin, options.DepthMax = 0, 10
+	return options
+}
+
+func TestElevationViewKeepsNearestPoint(t *testing.T) {
+	options := elevationOptions()
+	colormap, _ := GetColormap(options.Colormap)
+
+	// the points behind the camera and beyond the depth range are left out
+	frame := LidarFrame{Points: []LidarPoint{
+		testPoint(1, 5, 0, 0), testPoint(1, 3, 0, 0), testPoint(1, 5, 180, 0), testPoint(1, 12, 20, 0)}}
+	m := frame.ElevationView(frontCamera, options, colormap)
+	if m.Bounds() != image.Rect(0, 0, 90, 50) {
+		t.Fatalf("image is %v", m.Bounds())
+	}
+
+	// the azimuth 0 is in the middle column, and 1° up at 3m is in the row of 0.05m
+	depth := frame.Points[1].GetXYZ().Y / 1000
+	if c, expected := m.RGBAAt(45, 19), colormap((10-depth)/10); !closeColor(c, expected) {
+		t.Errorf("pixel of the nearest point is %v, expected %v", c, expected)
+	}
+	if n := countPixels(m); n != 1 {
+		t.Errorf("%d pixels are drawn, expected 1", n)
+	}
+
+	// the frame is rotated into the vehicle coordinates, the point at 90° or 270° turns to the front
+	frame = LidarFrame{Points: []LidarPoint{testPoint(1, 3, 0, 0), testPoint(1, 3, 90, 0), testPoint(1, 3, 270, 0)}}
+	frame.rotation = RotationAngles{yaw: 9000}
+	m = frame.ElevationView(frontCamera, options, colormap)
+	if m.RGBAAt(45, 19).A == 0 || countPixels(m) != 1 {
+		t.Errorf("the rotated frame draws %d pixels", countPixels(m))
+	}
+}
+
+func TestElevationRendererSavesCameras(t *testing.T) {
+	keepUserInput(t)
+	keepVehicle(t)
+	global.UserInput.OutputPath = t.TempDir()
+
+	registry.Current = nil
+	if _, err := NewElevationRenderer(elevationOptions()); err == nil {
+		t.Error("elevation renderer is created without cameras")
+	}
+
+	rear := registry.CameraCalib{Name: "rear", AzimuthStart: 135, AzimuthEnd: 225}
+	registry.Current = &registry.Vehicle{ID: "car1", Cameras: []registry.CameraCalib{frontCamera, rear}}
+	r, err := NewElevationRenderer(elevationOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := LidarFrame{Index: 2, Points: []LidarPoint{testPoint(1, 3, 0, 0)}}
+	if err := r.SaveFrame(&LidarSource{Address: "10.0.0.1"}, &frame); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"10.0.0.1-front-elev2.png", "10.0.0.1-rear-elev2.png"} {
+		if _, err := os.Stat(filepath.Join(global.UserInput.OutputPath, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the selected cameras must be calibrated
+	options := elevationOptions()
+	options.Cameras = *cli.NewStringSlice("left")
+	if _, err := NewElevationRenderer(options); err == nil {
+		t.Error("elevation renderer is created for an unknown camera")
+	}
+}
+
+// countPixels returns the number of drawn pixels
+func countPixels(m *image.RGBA) int {
+	count := 0
+	for i := 3; i < len(m.Pix); i += 4 {
+		if m.Pix[i] != 0 {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,184 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// FrameInfo locates a frame of a lidar source in the capture
+type FrameInfo struct {
+	Index  uint      `json:"index"`
+	Time   time.Time `json:"time"`
+	Points int       `json:"points"`
+	// packet is the number of a packet of the source within the frame, -1 when the frame starts the capture
+	packet int
+	// start is the position of the reader at this packet
+	start []filePosition
+}
+
+// SourceIndex lists the frames of a lidar source
+type SourceIndex struct {
+	ID             string      `json:"id"`
+	Address        string      `json:"address"`
+	Interface      int         `json:"interface"`
+	Name           string      `json:"name"`
+	Model          string      `json:"model"`
+	FrameCount     int         `json:"frameCount"`
+	Frames         []FrameInfo `json:"-"`
+	initialAzimuth uint16
+	nextPacket     int
+	nextStart      []filePosition
+}
+
+// CaptureIndex lists the frames of all lidar sources of a PCAP file, so that any frame can be decoded
+// without decoding the capture from the beginning
+type CaptureIndex struct {
+	PcapFiles []string       `json:"pcapFiles"`
+	Sources   []*SourceIndex `json:"sources"`
+}
+
+// IndexPCAP decodes the whitelisted lidar sources of the PCAP files once and indexes their frames
+func IndexPCAP(fileNames []string) (*CaptureIndex, error) {
+	reader, err := openPacketReader(fileNames)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	sources := make(map[string]*SourceIndex)
+	packetNumber := 0
+
+	d := NewDecoder()
+	d.recordedAzimuths = reader.RecordedAzimuths()
+	d.AddFrameHandler(func(ls *LidarSource, frame *LidarFrame) error {
+		source, ok := sources[ls.ID()]
+		if !ok {
+			source = &SourceIndex{
+				ID:             ls.ID(),
+				Address:        ls.Address,
+				Interface:      ls.Interface,
+				Name:           ls.Name(),
+				Model:          ls.Model(),
+				initialAzimuth: ls.InitialAzimuth,
+				nextPacket:     -1}
+			sources[ls.ID()] = source
+		}
+
+		source.Frames = append(source.Frames, FrameInfo{
+			Index:  frame.Index,
+			Time:   frame.Time,
+			Points: len(frame.Points),
+			packet: source.nextPacket,
+			start:  source.nextStart})
+
+		// the current packet of the source is the first one of the next frame
+		source.nextPacket = packetNumber
+		source.nextStart = reader.PreviousPositions()
+		return nil
+	})
+
+	for ; ; packetNumber++ {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := d.DecodePacket(packet); err != nil {
+			return nil, err
+		}
+	}
+
+	index := &CaptureIndex{PcapFiles: fileNames}
+	for _, source := range sources {
+		source.FrameCount = len(source.Frames)
+		index.Sources = append(index.Sources, source)
+	}
+	sort.Slice(index.Sources, func(i, j int) bool { return index.Sources[i].ID < index.Sources[j].ID })
+
+	return index, nil
+}
+
+// GetSource returns the index of the lidar source by its ID
+func (ci *CaptureIndex) GetSource(id string) (*SourceIndex, error) {
+	for _, source := range ci.Sources {
+		if source.ID == id {
+			return source, nil
+		}
+	}
+	return nil, fmt.Errorf("source %s is not in the capture", id)
+}
+
+// GetFrame returns the position of the frame in the frame list of the source
+func (si *SourceIndex) GetFrame(frameIndex uint) (int, error) {
+	position := sort.Search(len(si.Frames), func(i int) bool { return si.Frames[i].Index >= frameIndex })
+	if position == len(si.Frames) || si.Frames[position].Index != frameIndex {
+		return 0, fmt.Errorf("source %s has no frame %d", si.ID, frameIndex)
+	}
+	return position, nil
+}
+
+// ReadFrame decodes a frame of a lidar source, starting from a packet of the previous frame.
+// A plain PCAP file is read from the byte offset of that packet, other files from the start.
+func (ci *CaptureIndex) ReadFrame(id string, frameIndex uint) (*LidarSource, *LidarFrame, error) {
+	source, err := ci.GetSource(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	position, err := source.GetFrame(frameIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := openPacketReader(ci.PcapFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	d := NewDecoder()
+	d.recordedAzimuths = reader.RecordedAzimuths()
+	if position > 0 && source.Frames[position-1].packet >= 0 {
+		previous := source.Frames[position-1]
+		if err := reader.Seek(previous.start); err != nil {
+			return nil, nil, err
+		}
+		if err := d.SeedLidarSource(source.Address, source.Interface, source.initialAzimuth, previous.Index); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var ls LidarSource
+	var frame *LidarFrame
+	d.AddFrameHandler(func(s *LidarSource, f *LidarFrame) error {
+		if f.Index == frameIndex {
+			ls = *s
+			copied := *f
+			frame = &copied
+		}
+		return nil
+	})
+
+	for frame == nil {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("source %s frame %d ends with the capture", id, frameIndex)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// only the packets of the source are decoded
+		if len(getPayload(packet)) != lidarPayloadLength || getSourceID(packet) != id {
+			continue
+		}
+		if err := d.DecodePacket(packet); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &ls, frame, nil
+}
@@ -0,0 +1,47 @@
+package pcapdecoder
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexPCAPReadsEachFrame(t *testing.T) {
+	keepUserInput(t)
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, lidarCapture(t, 400))
+
+	index, err := IndexPCAP([]string{fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Sources) != 2 || index.Sources[0].ID != "10.0.0.1" || index.Sources[1].ID != "10.0.0.2" {
+		t.Fatalf("index has the sources %+v", index.Sources)
+	}
+
+	// a frame read from its indexed position is the frame of a decoding from the start
+	expected := decodeFrames(t, fileName)
+	for _, source := range index.Sources {
+		frames := expected[source.ID]
+		if source.FrameCount != len(frames) || source.Model != "VLP16" {
+			t.Fatalf("source %s has %d frames of model %s, expected %d", source.ID, source.FrameCount, source.Model, len(frames))
+		}
+		for i, info := range source.Frames {
+			ls, frame, err := index.ReadFrame(source.ID, info.Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ls.ID() != source.ID || frame.Index != frames[i].Index || !frame.Time.Equal(frames[i].Time) ||
+				info.Points != len(frame.Points) || !reflect.DeepEqual(frame.Points, frames[i].Points) {
+				t.Errorf("source %s frame %d differs from the decoded frame %d", source.ID, frame.Index, frames[i].Index)
+			}
+		}
+	}
+
+	if _, _, err := index.ReadFrame("10.0.0.3", 0); err == nil {
+		t.Error("a frame of an unknown source is read")
+	}
+	if _, _, err := index.ReadFrame("10.0.0.1", 100); err == nil {
+		t.Error("an unknown frame is read")
+	}
+}
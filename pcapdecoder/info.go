@@ -0,0 +1,280 @@
+package pcapdecoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/google/gopacket"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SourceInfo is the summary of the packets of one lidar source
+type SourceInfo struct {
+	ID                  string    `json:"id"`
+	Address             string    `json:"address"`
+	Interface           int       `json:"interface"`
+	Model               string    `json:"model"`
+	ProductID           byte      `json:"productID"`
+	ReturnMode          string    `json:"returnMode"`
+	PacketCount         uint      `json:"packetCount"`
+	FrameCount          uint      `json:"frameCount"`
+	RPM                 float64   `json:"rpm"`
+	StartTime           time.Time `json:"startTime"`
+	EndTime             time.Time `json:"endTime"`
+	DroppedPackets      uint      `json:"droppedPackets"`
+	PositionPacketCount uint      `json:"positionPacketCount"`
+	PPSStatus           string    `json:"ppsStatus"`
+	GPSValid            bool      `json:"gpsValid"`
+
+	lidarSource    LidarSource
+	lastTimeStamp  uint32
+	firstAzimuth   uint16
+	lastAzimuth    uint16
+	totalAzimuth   uint64
+	totalTimeSpent uint64
+}
+
+// UnknownTraffic counts the unidentified packets of the same length and destination port
+type UnknownTraffic struct {
+	Length int    `json:"length"`
+	Port   uint16 `json:"port"`
+	Count  uint   `json:"count"`
+}
+
+// CaptureInfo is the summary of a PCAP file
+type CaptureInfo struct {
+	PcapFile           string           `json:"pcapFile"`
+	PacketCount        uint             `json:"packetCount"`
+	CameraPacketCount  uint             `json:"cameraPacketCount"`
+	StartTime          time.Time        `json:"startTime"`
+	EndTime            time.Time        `json:"endTime"`
+	Sources            []*SourceInfo    `json:"sources"`
+	UnknownTraffic     []UnknownTraffic `json:"unknownTraffic"`
+	sourcesByID        map[string]*SourceInfo
+	unknownTrafficByID map[[2]int]uint
+	recordedAzimuths   map[string]uint16
+}
+
+// ScanPCAP summarizes the PCAP file without decoding the frames
+func ScanPCAP() (CaptureInfo, error) {
+	reader, err := openPacketReader(global.UserInput.PcapFiles.Value())
+	if err != nil {
+		return CaptureInfo{}, err
+	}
+	defer reader.Close()
+
+	info := CaptureInfo{
+		PcapFile:           strings.Join(global.UserInput.PcapFiles.Value(), ", "),
+		sourcesByID:        make(map[string]*SourceInfo),
+		unknownTrafficByID: make(map[[2]int]uint),
+		recordedAzimuths:   reader.RecordedAzimuths()}
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return CaptureInfo{}, err
+		}
+		if err := info.addPacket(packet); err != nil {
+			return CaptureInfo{}, err
+		}
+	}
+
+	for _, source := range info.sourcesByID {
+		source.finalize()
+		info.Sources = append(info.Sources, source)
+	}
+	sort.Slice(info.Sources, func(i, j int) bool {
+		return info.Sources[i].ID < info.Sources[j].ID
+	})
+
+	for id, count := range info.unknownTrafficByID {
+		info.UnknownTraffic = append(info.UnknownTraffic, UnknownTraffic{
+			Length: id[0],
+			Port:   uint16(id[1]),
+			Count:  count})
+	}
+	sort.Slice(info.UnknownTraffic, func(i, j int) bool {
+		return info.UnknownTraffic[i].Count > info.UnknownTraffic[j].Count
+	})
+
+	return info, nil
+}
+
+func (info *CaptureInfo) addPacket(packet gopacket.Packet) error {
+	payload := getPayload(packet)
+	recordTime := packet.Metadata().Timestamp
+
+	if info.PacketCount == 0 {
+		info.StartTime = recordTime
+	}
+	info.EndTime = recordTime
+	info.PacketCount++
+
+	switch len(payload) {
+	case lidarPayloadLength:
+		lidarPacket, err := NewLidarPacket(&payload)
+		if err != nil {
+			return fmt.Errorf("packet %d: %v", info.PacketCount, err)
+		}
+		info.getSource(packet).addLidarPacket(&lidarPacket, recordTime, info.recordedAzimuths)
+	case positionPayloadLength:
+		positionPacket, err := NewPositionPacket(&payload)
+		if err != nil {
+			return fmt.Errorf("packet %d: %v", info.PacketCount, err)
+		}
+		info.getSource(packet).addPositionPacket(&positionPacket)
+	case cameraPayloadLength:
+		info.CameraPacketCount++
+	default:
+		info.unknownTrafficByID[[2]int{len(packet.Data()), int(getDestinationPort(packet))}]++
+	}
+	return nil
+}
+
+// getSource returns the summary of the source of the packet, by its IP address and capture interface
+func (info *CaptureInfo) getSource(packet gopacket.Packet) *SourceInfo {
+	id := getSourceID(packet)
+	source, ok := info.sourcesByID[id]
+	if !ok {
+		source = &SourceInfo{
+			ID:        id,
+			Address:   getIPv4(packet),
+			Interface: packet.Metadata().InterfaceIndex,
+			PPSStatus: "No position packet"}
+		info.sourcesByID[id] = source
+	}
+	return source
+}
+
+func (si *SourceInfo) addLidarPacket(lp *LidarPacket, recordTime time.Time, recordedAzimuths map[string]uint16) {
+	if si.PacketCount == 0 {
+		si.ProductID = lp.ProductID
+		si.Model = getModelName(lp.ProductID)
+		si.ReturnMode = getReturnModeName(lp.ReturnMode)
+		si.StartTime = recordTime
+
+		initialAzimuth, ok := recordedAzimuths[si.ID]
+		if !ok {
+			initialAzimuth = lp.Blocks[0].Azimuth
+		}
+		si.lidarSource = LidarSource{
+			Address:        si.Address,
+			Interface:      si.Interface,
+			InitialAzimuth: initialAzimuth}
+		if initialAzimuth != lp.Blocks[0].Azimuth {
+			si.lidarSource.CurrentFrame.Index = leadingFrame
+		}
+	} else {
+		timeGap := getTimeGap(si.lastTimeStamp, lp.TimeStamp)
+		interval := getPacketInterval(lp.ProductID, lp.ReturnMode)
+		missingPackets := math.Round(float64(timeGap)/interval) - 1
+
+		if missingPackets > 0 {
+			si.DroppedPackets += uint(missingPackets)
+		} else {
+			// azimuth rate is only reliable between consecutive packets
+			si.totalAzimuth += uint64(getAzimuthGap(si.firstAzimuth, lp.Blocks[0].Azimuth))
+			si.totalTimeSpent += uint64(timeGap)
+		}
+
+		if isNewFrame(si.lastAzimuth, lp.Blocks[0].Azimuth, &si.lidarSource) {
+			si.lidarSource.CurrentFrame.Index++
+		}
+	}
+
+	for colIndex := 0; colIndex < 11; colIndex++ {
+		if isNewFrame(lp.Blocks[colIndex].Azimuth, lp.Blocks[colIndex+1].Azimuth, &si.lidarSource) {
+			si.lidarSource.CurrentFrame.Index++
+		}
+	}
+
+	si.PacketCount++
+	si.EndTime = recordTime
+	si.lastTimeStamp = lp.TimeStamp
+	si.firstAzimuth = lp.Blocks[0].Azimuth
+	si.lastAzimuth = lp.Blocks[11].Azimuth
+}
+
+func (si *SourceInfo) addPositionPacket(pp *PositionPacket) {
+	si.PositionPacketCount++
+	si.PPSStatus = pp.PPSStatusName()
+	si.GPSValid = pp.IsGPSValid()
+}
+
+func (si *SourceInfo) finalize() {
+	if si.PacketCount > 0 {
+		si.FrameCount = si.lidarSource.CurrentFrame.Index + 1
+	}
+	if si.totalTimeSpent > 0 {
+		// 100x degrees per microsecond to revolutions per minute
+		degreesPerSecond := float64(si.totalAzimuth) / 100 / (float64(si.totalTimeSpent) / 1e6)
+		si.RPM = math.Round(degreesPerSecond/360*60*10) / 10
+	}
+}
+
+// getDestinationPort returns the UDP or TCP destination port of the packet
+func getDestinationPort(packet gopacket.Packet) uint16 {
+	transportLayer := packet.TransportLayer()
+	if transportLayer == nil {
+		return 0
+	}
+
+	port := transportLayer.TransportFlow().Dst().Raw()
+	if len(port) != 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(port)
+}
+
+// WriteJSON writes the capture summary in JSON format
+func (info *CaptureInfo) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(info)
+}
+
+// WriteText writes the capture summary in a readable format
+func (info *CaptureInfo) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "PCAP file:\t%s\n", info.PcapFile)
+	fmt.Fprintf(tw, "Packets:\t%d\n", info.PacketCount)
+	fmt.Fprintf(tw, "Camera packets:\t%d\n", info.CameraPacketCount)
+	fmt.Fprintf(tw, "Time span:\t%s - %s (%s)\n",
+		info.StartTime.Format(time.RFC3339Nano), info.EndTime.Format(time.RFC3339Nano), info.EndTime.Sub(info.StartTime))
+
+	for _, source := range info.Sources {
+		fmt.Fprintf(tw, "\n%s\n", source.ID)
+		if source.PacketCount > 0 {
+			fmt.Fprintf(tw, "  Model:\t%s (0x%x)\n", source.Model, source.ProductID)
+			fmt.Fprintf(tw, "  Return mode:\t%s\n", source.ReturnMode)
+			fmt.Fprintf(tw, "  Packets:\t%d\n", source.PacketCount)
+			fmt.Fprintf(tw, "  Dropped packets:\t%d\n", source.DroppedPackets)
+			fmt.Fprintf(tw, "  Frames:\t%d\n", source.FrameCount)
+			fmt.Fprintf(tw, "  RPM:\t%.1f\n", source.RPM)
+			fmt.Fprintf(tw, "  Time span:\t%s\n", source.EndTime.Sub(source.StartTime))
+		}
+		fmt.Fprintf(tw, "  Position packets:\t%d\n", source.PositionPacketCount)
+		fmt.Fprintf(tw, "  PPS:\t%s\n", source.PPSStatus)
+		fmt.Fprintf(tw, "  GPS fix:\t%t\n", source.GPSValid)
+	}
+
+	if len(info.UnknownTraffic) > 0 {
+		fmt.Fprintf(tw, "\nUnknown traffic\n")
+		fmt.Fprintf(tw, "  Length\tPort\tCount\n")
+		for _, traffic := range info.UnknownTraffic {
+			fmt.Fprintf(tw, "  %d\t%d\t%d\n", traffic.Length, traffic.Port, traffic.Count)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,94 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/urfave/cli"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanPCAPSummarizesSources(t *testing.T) {
+	keepUserInput(t)
+
+	// 10.0.0.2 loses its packet 50
+	var packets []testPacket
+	for _, packet := range lidarCapture(t, 200) {
+		if packet.time != testStart.Add(50500*time.Microsecond) {
+			packets = append(packets, packet)
+		}
+	}
+	packets = append(packets,
+		testPacket{time: testStart.Add(100 * time.Millisecond), data: positionPacket(t, "10.0.0.1", 2, testStart)},
+		testPacket{time: testStart.Add(100 * time.Millisecond), data: udpPacket(t, "10.0.0.3", 5353, make([]byte, 100))},
+		testPacket{time: testStart.Add(100 * time.Millisecond), data: udpPacket(t, "10.0.0.3", 5353, make([]byte, 100))})
+	for i := 0; i < 3; i++ {
+		packets = append(packets, testPacket{time: testStart.Add(150 * time.Millisecond), data: udpPacket(t, "10.0.0.10", 5000, make([]byte, 1316))})
+	}
+	sortPackets(packets)
+
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, packets)
+	global.UserInput.PcapFiles = *cli.NewStringSlice(fileName)
+
+	info, err := ScanPCAP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.PacketCount != 405 || info.CameraPacketCount != 3 {
+		t.Errorf("%d packets and %d camera packets, expected 405 and 3", info.PacketCount, info.CameraPacketCount)
+	}
+	if !info.StartTime.Equal(testStart) || !info.EndTime.Equal(testStart.Add(199500*time.Microsecond)) {
+		t.Errorf("time span %s - %s", info.StartTime, info.EndTime)
+	}
+	if len(info.UnknownTraffic) != 1 || info.UnknownTraffic[0] != (UnknownTraffic{Length: 142, Port: 5353, Count: 2}) {
+		t.Errorf("unknown traffic %+v", info.UnknownTraffic)
+	}
+
+	expected := []SourceInfo{
+		{ID: "10.0.0.1", Address: "10.0.0.1", Model: "VLP16", ProductID: 0x22, ReturnMode: "Strongest",
+			PacketCount: 200, FrameCount: 3, RPM: 740, PositionPacketCount: 1, PPSStatus: "Locked", GPSValid: true},
+		{ID: "10.0.0.2", Address: "10.0.0.2", Model: "VLP16", ProductID: 0x22, ReturnMode: "Strongest",
+			PacketCount: 199, FrameCount: 3, RPM: 740, DroppedPackets: 1, PPSStatus: "No position packet"},
+	}
+	if len(info.Sources) != len(expected) {
+		t.Fatalf("%d sources, expected %d", len(info.Sources), len(expected))
+	}
+	for i, source := range info.Sources {
+		e := expected[i]
+		if source.ID != e.ID || source.Address != e.Address || source.Model != e.Model || source.ProductID != e.ProductID ||
+			source.ReturnMode != e.ReturnMode || source.PacketCount != e.PacketCount || source.FrameCount != e.FrameCount ||
+			source.RPM != e.RPM || source.DroppedPackets != e.DroppedPackets || source.PositionPacketCount != e.PositionPacketCount ||
+			source.PPSStatus != e.PPSStatus || source.GPSValid != e.GPSValid {
+			t.Errorf("source %d is %+v, expected %+v", i, *source, e)
+		}
+	}
+
+	var text bytes.Buffer
+	if err := info.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	// the columns are aligned with spaces
+	summary := strings.Join(strings.Fields(text.String()), " ")
+	for _, line := range []string{"Packets: 405", "Dropped packets: 1", "RPM: 740.0", "PPS: Locked", "142 5353 2"} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("the text summary does not contain %q:\n%s", line, text.String())
+		}
+	}
+
+	var jsonInfo bytes.Buffer
+	if err := info.WriteJSON(&jsonInfo); err != nil {
+		t.Fatal(err)
+	}
+	var decoded CaptureInfo
+	if err := json.Unmarshal(jsonInfo.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Sources) != 2 || decoded.Sources[1].DroppedPackets != 1 {
+		t.Errorf("the JSON summary has the sources %+v", decoded.Sources)
+	}
+}
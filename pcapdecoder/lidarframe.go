@@ -3,20 +3,19 @@ package pcapdecoder
 import (
 	"encoding/json"
 	"fmt"
-	"image"
-	"image/color"
-	"image/png"
 	"math"
 	"os"
 	"path/filepath"
 	"pcap-decoder/cli"
 	"sync"
+	"time"
 )
 
 // LidarFrame contains one revolution of the lidar
 type LidarFrame struct {
 	Points      []LidarPoint
 	Index       uint
+	Time        time.Time
 	rotation    RotationAngles
 	translation Translation
 }
@@ -122,10 +121,10 @@ func (lf *LidarFrame) GetMatrix(limits *[3][2]float64, pixels uint16, rotAngles
 
 			colorIntensity := uint16(0xFF * (cp.Z - Zr[0]) / (Zr[1] - Zr[0]))
 
-			if frameMap[xInd] != nil && frameMap[xInd][yInd] < uint8(colorIntensity) {
-				frameMap[xInd][yInd] = uint8(colorIntensity)
-			} else {
+			if frameMap[xInd] == nil {
 				frameMap[xInd] = map[int]uint8{}
+			}
+			if frameMap[xInd][yInd] < uint8(colorIntensity) {
 				frameMap[xInd][yInd] = uint8(colorIntensity)
 			}
 		}
@@ -134,36 +133,6 @@ func (lf *LidarFrame) GetMatrix(limits *[3][2]float64, pixels uint16, rotAngles
 	return frameMap
 }
 
-func (lf *LidarFrame) visualizeFrame(limits *[3][2]float64, pixels uint16) {
-	index := lf.Index
-
-	Xr := limits[0]
-	Yr := limits[1]
-	// Zr := limits[2]
-
-	unit := getUnit(limits, pixels)
-
-	filename := fmt.Sprintf("./frame%d.png", index)
-
-	m := image.NewRGBA64(image.Rect(int(Xr[0]/unit), int(Yr[0]/unit), int(Xr[1]/unit), int(Yr[1]/unit)))
-
-	frameMap := lf.GetMatrix(limits, pixels, RotationAngles{}, lf.translation)
-
-	for xInd := range frameMap {
-		for yInd := range frameMap[xInd] {
-			m.Set(xInd, yInd, color.RGBA{
-				0,
-				255,
-				0,
-				255})
-		}
-	}
-
-	f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
-	defer f.Close()
-	png.Encode(f, m)
-}
-
 // ToJSON saves the lidar points in json format
 func (lf *LidarFrame) ToJSON(isSave bool) []byte {
 	pointsLen := len(lf.Points)
@@ -8,6 +8,7 @@ import (
 General Structure
 	LidarPacket
 		Time
+		ReturnMode
 		IsDualMode
 		productID
 		Blocks[12]
@@ -19,10 +20,11 @@ General Structure
 
 // LidarPacket is the raw decoded info of a lidar packet
 type LidarPacket struct {
-	TimeStamp  uint32 `json:"timestamp"`
-	ProductID  byte   `json:"productID"`
-	IsDualMode bool   `json:"isDualMode"`
-	Blocks     []LidarBlock
+	TimeStamp  uint32       `json:"timestamp"`
+	ProductID  byte         `json:"productID"`
+	ReturnMode byte         `json:"returnMode"`
+	IsDualMode bool         `json:"isDualMode"`
+	Blocks     []LidarBlock `json:"blocks"`
 }
 
 // LidarBlock contains the channels data
@@ -37,16 +39,17 @@ type LidarChannel struct {
 	Reflectivity uint8  `json:"reflectivity"`
 }
 
-// NewLidarPacket creates a new LidarPacket Object
+// NewLidarPacket creates a new LidarPacket Object from the UDP payload of a lidar packet
 func NewLidarPacket(data *[]byte) (LidarPacket, error) {
 	var lp LidarPacket
 	var err error
 
-	if len(*data) == 1248 {
+	if len(*data) == lidarPayloadLength {
 		blocks := make([]LidarBlock, 12)
 		setBlocks(data, &blocks)
 
 		lp = LidarPacket{
+			ReturnMode: getReturnMode(data),
 			IsDualMode: isDualMode(data),
 			ProductID:  getProductID(data),
 			TimeStamp:  getTime(data),
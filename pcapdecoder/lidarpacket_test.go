@@ -0,0 +1,35 @@
+package pcapdecoder
+
+import (
+	"testing"
+)
+
+func TestNewLidarPacketReadsReturnMode(t *testing.T) {
+	tests := []struct {
+		returnMode byte
+		isDualMode bool
+		name       string
+	}{
+		{0x37, false, "Strongest"},
+		{0x38, false, "Last"},
+		{0x39, true, "Dual"},
+		// the byte compared before the factory bytes were used
+		{0x57, false, "Unknown (0x57)"},
+	}
+	for _, test := range tests {
+		data := make([]byte, 1206)
+		data[1204] = test.returnMode
+		data[1205] = 0x22
+
+		packet, err := NewLidarPacket(&data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.ReturnMode != test.returnMode || packet.IsDualMode != test.isDualMode {
+			t.Errorf("0x%x: return mode 0x%x, dual %t, expected dual %t", test.returnMode, packet.ReturnMode, packet.IsDualMode, test.isDualMode)
+		}
+		if name := getReturnModeName(packet.ReturnMode); name != test.name {
+			t.Errorf("0x%x: return mode name %q, expected %q", test.returnMode, name, test.name)
+		}
+	}
+}
@@ -36,24 +36,26 @@ func (cp CartesianPoint) ToSpherical() SphericalPoint {
 	radius := math.Sqrt(cp.X*cp.X + cp.Y*cp.Y + cp.Z*cp.Z)
 	return SphericalPoint{
 		Radius:  radius,
-		Azimuth: normalizeAngle(degrees(math.Atan(cp.X / cp.Y))),
+		Azimuth: normalizeAngle(degrees(math.Atan2(cp.X, cp.Y))),
 		Bearing: normalizeAngle(degrees(math.Asin(cp.Z / radius)))}
 }
 
 // Rotate returns the rotated cartesian point
 func (cp CartesianPoint) Rotate(A *[3][3]float64) CartesianPoint {
 	return CartesianPoint{
-		X: A[0][0]*cp.X + A[0][1]*cp.Y + A[0][2]*cp.Z,
-		Y: A[1][0]*cp.X + A[1][1]*cp.Y + A[1][2]*cp.Z,
-		Z: A[2][0]*cp.X + A[2][1]*cp.Y + A[2][2]*cp.Z}
+		X:         A[0][0]*cp.X + A[0][1]*cp.Y + A[0][2]*cp.Z,
+		Y:         A[1][0]*cp.X + A[1][1]*cp.Y + A[1][2]*cp.Z,
+		Z:         A[2][0]*cp.X + A[2][1]*cp.Y + A[2][2]*cp.Z,
+		Intensity: cp.Intensity}
 }
 
 // Translate returns the translated CartesianPoint position
 func (cp CartesianPoint) Translate(t Translation) CartesianPoint {
 	return CartesianPoint{
-		X: cp.X + float64(t.x),
-		Y: cp.Y + float64(t.y),
-		Z: cp.Z + float64(t.z)}
+		X:         cp.X + float64(t.x),
+		Y:         cp.Y + float64(t.y),
+		Z:         cp.Z + float64(t.z),
+		Intensity: cp.Intensity}
 }
 
 // GetXYZ returns the XYZ Coordinates
@@ -2,24 +2,82 @@ package pcapdecoder
 
 import (
 	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
 	"os"
-	"pcap-decoder/calibration"
+	"time"
 )
 
 // LidarSource contains the iteration info of an IP address
 type LidarSource struct {
 	Address           string
+	Interface         int
 	InitialAzimuth    uint16
 	NextPacketAzimuth uint16
 	CurrentPacket     LidarPacket
+	CurrentPacketTime time.Time
 	CurrentFrame      LidarFrame
 	PreviousFrame     LidarFrame
 	Buffer            []LidarPoint
-	Calibration       calibration.LidarCalib
+	Calibration       registry.LidarCalib
+}
+
+// NewLidarSource creates the LidarSource of an IP address with its calibration
+func NewLidarSource(address string, initialAzimuth uint16, startTime time.Time) (LidarSource, error) {
+	calib, err := registry.GetLidar(address)
+	if err != nil {
+		return LidarSource{}, err
+	}
+
+	ls := LidarSource{
+		Address:        address,
+		InitialAzimuth: initialAzimuth,
+		Calibration:    calib}
+	ls.CurrentFrame.rotation, ls.CurrentFrame.translation = ls.GetPose()
+	ls.CurrentFrame.Time = startTime
+
+	return ls, nil
+}
+
+// ID identifies the lidar by its IP address and capture interface
+func (ls *LidarSource) ID() string {
+	return sourceID(ls.Address, ls.Interface)
+}
+
+// Name returns the calibrated name of the lidar, or its IP address, with its capture interface
+func (ls *LidarSource) Name() string {
+	if len(ls.Calibration.Name) > 0 {
+		return sourceID(ls.Calibration.Name, ls.Interface)
+	}
+	return ls.ID()
+}
+
+// Model returns the model name of the lidar from the product ID of its packets
+func (ls *LidarSource) Model() string {
+	return getModelName(ls.CurrentPacket.ProductID)
+}
+
+// GetPose returns the rotation and translation of the lidar from its calibration
+func (ls *LidarSource) GetPose() (RotationAngles, Translation) {
+	return getPose(ls.Calibration.Extrinsics)
+}
+
+// getPose returns the rotation and translation of the extrinsics
+func getPose(extrinsics global.Extrinsics) (RotationAngles, Translation) {
+	rotation := RotationAngles{
+		pitch: int16(math.Round(extrinsics.Pitch * 100)),
+		roll:  int16(math.Round(extrinsics.Roll * 100)),
+		yaw:   int16(math.Round(extrinsics.Yaw * 100))}
+	translation := Translation{
+		x: float32(extrinsics.X),
+		y: float32(extrinsics.Y),
+		z: float32(extrinsics.Z)}
+
+	return rotation, translation
 }
 
 // SetCurrentFrame sets the point cloud of a LidarSource
@@ -81,7 +139,7 @@ func isNewFrame(currAzimuth uint16, nextAzimuth uint16, ls *LidarSource) bool {
 
 func getNextAzimuth(colIndex uint8, ls *LidarSource) uint16 {
 	var nextAzimuth uint16
-	if colIndex < 10 {
+	if colIndex < 11 {
 		nextAzimuth = ls.CurrentPacket.Blocks[colIndex+1].Azimuth
 	} else {
 		nextAzimuth = ls.NextPacketAzimuth
@@ -218,86 +276,3 @@ func getTotalMatch(previousFrame map[int]map[int]uint8, currentFrame map[int]map
 
 	return count
 }
-
-func (ls *LidarSource) elevationView(cameraName string, imgWidth int, imgHeight int) {
-
-	//fmt.Println(ls.CurrentFrame.Index)
-
-	camera := calibration.Cameras[cameraName]
-
-	Ar := camera.AzimuthRange()
-	Hr := []float64{-1500, 2500}
-	Dr := []int{0, 10000}
-
-	arLen := Ar[1] - Ar[0]
-	if arLen < 0 {
-		arLen = 36000 + arLen
-	}
-
-	unitH := (Hr[1] - Hr[0]) / float64(imgHeight)
-
-	m := image.NewRGBA64(image.Rect(0, int(Hr[0]/unitH), imgWidth, int(Hr[1]/unitH)))
-
-	// rotation := RotationAngles{
-	// 	pitch: ls.Calibration.Rotation.Yaw,
-	// 	roll:  ls.Calibration.Rotation.Pitch,
-	// 	yaw:   ls.Calibration.Rotation.Roll}
-	rotation := RotationAngles{}
-
-	A := getRotationMultipliers(&rotation)
-
-	// p := CartesianPoint{X: 1, Y: 1, Z: 1}
-	// fmt.Println(p, p.Rotate(&A), A)
-	// translation := Translation{x: 0, y: 0, z: 0}
-
-	var distance, bearing, azimuth100 float64
-
-	for _, point := range ls.CurrentFrame.Points {
-		if rotation.pitch == 0 && rotation.roll == 0 && rotation.yaw == 0 {
-			distance = point.Distance()
-			bearing = point.Bearing()
-			azimuth100 = point.Azimuth() * 100
-		} else {
-			sp := point.GetXYZ().Rotate(&A).ToSpherical()
-
-			distance = sp.Radius
-			bearing = sp.Bearing
-			azimuth100 = sp.Azimuth * 100
-		}
-
-		// fmt.Println(distance, azimuth100, bearing, point.GetXYZ().Rotate(&A).ToSpherical())
-
-		// Check if azimuth is within range
-		if int(azimuth100) < Ar[0] && int(azimuth100) > Ar[1] {
-			continue
-		}
-
-		azimuth := (int(math.Round(azimuth100)) + 36000 - Ar[0]) % 36000
-		xInd := int(float32(imgWidth) * float32(azimuth) / float32(arLen))
-
-		height := distance * math.Sin(radians(bearing))
-		depth := int(math.Round(distance * math.Cos(radians(bearing))))
-
-		if height < Hr[1] && height > Hr[0] && depth < Dr[1] {
-			c := uint32(float32(Dr[1]-depth) * 0xFFFFFF / float32(Dr[1]))
-			r := uint8((c & 0xFF0000) >> 16)
-			g := uint8((c & 0x00FF00) >> 8)
-			b := uint8(c & 0x0000FF)
-
-			invHeight := Hr[1] + Hr[0] - height
-
-			m.Set(
-				xInd,
-				int(invHeight/unitH),
-				color.RGBA{r, g, b, 255})
-
-		}
-	}
-
-	filename := fmt.Sprintf("./%s-elev%d.png", ls.Address, ls.CurrentFrame.Index)
-	fmt.Println(filename)
-
-	f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
-	defer f.Close()
-	png.Encode(f, m)
-}
@@ -0,0 +1,74 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"math"
+	"path/filepath"
+	"pcap-decoder/dictionary"
+	"testing"
+)
+
+func TestNewLidarSourceWithoutRegistry(t *testing.T) {
+	keepVehicle(t)
+	registry.Current = nil
+
+	ls, err := NewLidarSource("10.0.0.1", 0, testStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Calibration != registry.DefaultLidar("10.0.0.1") || ls.Name() != ls.ID() {
+		t.Errorf("source has the calibration %+v and the name %s", ls.Calibration, ls.Name())
+	}
+	if ls.CurrentFrame.rotation != (RotationAngles{}) || ls.CurrentFrame.translation != (Translation{}) {
+		t.Errorf("source has the pose %+v, %+v", ls.CurrentFrame.rotation, ls.CurrentFrame.translation)
+	}
+
+	// the points are placed by the elevation angles of the product ID
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, lidarPackets(t, "10.0.0.1", testStart, 200))
+	frames := decodeFrames(t, fileName)[sourceID("10.0.0.1", 0)]
+	if len(frames) == 0 {
+		t.Fatal("no frame is decoded")
+	}
+	frame := frames[0]
+	points := frame.CartesianPoints(frame.rotation, frame.translation)
+	for i, point := range frame.Points[:16] {
+		elevation := float64(dictionary.VLP16ElevationAngles[point.rowIndex]) / 1000
+		expected := point.Distance() * math.Sin(radians(elevation))
+		if math.Abs(points[i].Z-expected) > 1e-6 {
+			t.Errorf("point %d of row %d has z %f, expected %f", i, point.rowIndex, points[i].Z, expected)
+		}
+	}
+
+	// a selected vehicle needs an entry for each source
+	registry.Current = &registry.Vehicle{ID: "car1", Lidars: []registry.LidarCalib{{IP: "10.0.0.2", Extrinsics: global.Extrinsics{Z: 1000}}}}
+	if _, err := NewLidarSource("10.0.0.1", 0, testStart); err == nil {
+		t.Error("a source without calibration entry is created")
+	}
+}
+
+func TestLidarSourceInterpolatesWithinPacket(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, lidarPackets(t, "10.0.0.1", testStart, 200))
+
+	// the azimuth turns by 37 per block, so each block ends at the azimuth of the next one,
+	// block 10 at block 11 of its packet and block 11 at the first block of the next packet
+	frames := decodeFrames(t, fileName)[sourceID("10.0.0.1", 0)]
+	if len(frames) < 2 {
+		t.Fatalf("decoded %d frames", len(frames))
+	}
+	blocks := make(map[int]int)
+	for _, frame := range frames {
+		for _, point := range frame.Points {
+			if gap := getAzimuthGap(point.azimuth, point.nextAzimuth); gap != 37 {
+				t.Fatalf("frame %d has a point of block %d at azimuth %d interpolated to %d",
+					frame.Index, int(point.azimuth)/37%12, point.azimuth, point.nextAzimuth)
+			}
+			blocks[int(point.azimuth)/37%12]++
+		}
+	}
+	if blocks[10] == 0 || blocks[11] == 0 {
+		t.Errorf("the frames have %d points of block 10 and %d of block 11", blocks[10], blocks[11])
+	}
+}
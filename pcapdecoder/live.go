@@ -0,0 +1,216 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// datagram is a received UDP payload
+type datagram struct {
+	address string
+	data    []byte
+	time    time.Time
+}
+
+// liveStatus is the last reported state of a lidar source in live mode
+type liveStatus struct {
+	ppsStatus byte
+	gpsValid  bool
+}
+
+// ppsLocked is the PPS status of a lidar whose timestamps count the microseconds past the GPS hour
+const ppsLocked = 2
+
+// ParseLive decodes the lidar and position packets received on the UDP ports of the user input
+// and passes the frames to the registered handlers, until the end frame or an interrupt.
+// The packets of a lidar with a locked PPS and a valid GPRMC sentence are timed by the GPS clock,
+// the others by the time they are received.
+func ParseLive() error {
+	ui := &global.UserInput
+
+	dataConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: ui.DataPort})
+	if err != nil {
+		return err
+	}
+	defer dataConn.Close()
+
+	datagrams := make(chan datagram, 1024)
+	errs := make(chan error, 2)
+	done := make(chan struct{})
+	defer close(done)
+
+	go readDatagrams(dataConn, datagrams, errs, done)
+	fmt.Fprintf(os.Stderr, "listening for lidar packets on UDP port %d\n", ui.DataPort)
+
+	if ui.PositionPort > 0 && ui.PositionPort != ui.DataPort {
+		positionConn, err := net.ListenUDP("udp", &net.UDPAddr{Port: ui.PositionPort})
+		if err != nil {
+			return err
+		}
+		defer positionConn.Close()
+
+		go readDatagrams(positionConn, datagrams, errs, done)
+		fmt.Fprintf(os.Stderr, "listening for position packets on UDP port %d\n", ui.PositionPort)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	defaultDecoder.SetFrameRange(ui.StartFrame, ui.EndFrame, ui.Stride)
+	statuses := make(map[string]liveStatus)
+	gpsTimes := make(map[string]time.Time)
+	aliases := newLoopbackAliases()
+
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case err := <-errs:
+			return err
+		case dg := <-datagrams:
+			dg.address = aliases.resolve(dg.address)
+			if err := defaultDecoder.decodeDatagram(dg, statuses, gpsTimes); err != nil {
+				return err
+			}
+			if defaultDecoder.isAfterEndFrame() {
+				return nil
+			}
+		}
+	}
+}
+
+// readDatagrams receives the payloads of the socket
+func readDatagrams(conn *net.UDPConn, datagrams chan<- datagram, errs chan<- error, done <-chan struct{}) {
+	buffer := make([]byte, 65536)
+	for {
+		n, address, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		data := append([]byte(nil), buffer[:n]...)
+
+		select {
+		case datagrams <- datagram{address: address.IP.String(), data: data, time: time.Now()}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// decodeDatagram decodes a live lidar packet, and reports the new sources and the changes of their PPS and GPS status.
+// gpsTimes holds the time of the last GPRMC sentence of the lidars with a locked PPS.
+func (d *Decoder) decodeDatagram(dg datagram, statuses map[string]liveStatus, gpsTimes map[string]time.Time) error {
+	switch len(dg.data) {
+	case lidarPayloadLength:
+		if !global.UserInput.IsWhitelisted(dg.address) {
+			return nil
+		}
+
+		recordTime := dg.time
+		if gpsTime, ok := gpsTimes[dg.address]; ok {
+			recordTime = getLidarTime(gpsTime, getTime(&dg.data))
+		}
+
+		_, known := d.lidarSources[dg.address]
+		if err := d.decodeLidarPacket(dg.address, 0, &dg.data, recordTime); err != nil {
+			return err
+		}
+		if !known {
+			ls := d.lidarSources[dg.address]
+			fmt.Fprintf(os.Stderr, "%s: %s lidar\n", ls.Name(), getModelName(getProductID(&dg.data)))
+		}
+	case positionPayloadLength:
+		pp, err := NewPositionPacket(&dg.data)
+		if err != nil {
+			return err
+		}
+
+		status := liveStatus{ppsStatus: pp.PPSStatus, gpsValid: pp.IsGPSValid()}
+		if previous, ok := statuses[dg.address]; !ok || previous != status {
+			fmt.Fprintf(os.Stderr, "%s: PPS %s, GPS valid %t\n", dg.address, pp.PPSStatusName(), status.gpsValid)
+			statuses[dg.address] = status
+		}
+
+		delete(gpsTimes, dg.address)
+		if pp.PPSStatus == ppsLocked && status.gpsValid {
+			if gpsTime, err := pp.GetTime(); err == nil {
+				gpsTimes[dg.address] = gpsTime
+			}
+		}
+	}
+	return nil
+}
+
+// loopbackAliases maps the 127.x.y.z addresses of the sources replayed on the loopback interface
+// back to their recorded address: the channel or registry address with the same last three bytes
+type loopbackAliases struct {
+	addresses []net.IP
+	resolved  map[string]string
+}
+
+func newLoopbackAliases() *loopbackAliases {
+	la := &loopbackAliases{resolved: make(map[string]string)}
+
+	addresses := global.UserInput.Channels.Value()
+	if registry.Current != nil {
+		for _, lidar := range registry.Current.Lidars {
+			addresses = append(addresses, lidar.IP)
+		}
+		for _, camera := range registry.Current.Cameras {
+			addresses = append(addresses, camera.IP)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		if ip := net.ParseIP(address).To4(); ip != nil && !ip.IsLoopback() && !seen[ip.String()] {
+			seen[ip.String()] = true
+			la.addresses = append(la.addresses, ip)
+		}
+	}
+	return la
+}
+
+// resolve returns the recorded address of a loopback alias, when exactly one known address matches it
+func (la *loopbackAliases) resolve(address string) string {
+	if resolved, ok := la.resolved[address]; ok {
+		return resolved
+	}
+
+	resolved := address
+	if alias := net.ParseIP(address).To4(); alias != nil && alias.IsLoopback() {
+		var matches []string
+		for _, ip := range la.addresses {
+			if ip[1] == alias[1] && ip[2] == alias[2] && ip[3] == alias[3] {
+				matches = append(matches, ip.String())
+			}
+		}
+		if len(matches) == 1 {
+			resolved = matches[0]
+			fmt.Fprintf(os.Stderr, "%s: replayed source of %s\n", address, resolved)
+		}
+	}
+
+	la.resolved[address] = resolved
+	return resolved
+}
+
+// getLidarTime returns the time of a lidar timestamp, in microseconds past the hour, in the hour of the GPS time.
+// A timestamp more than half an hour away from the GPS time is in the previous or next hour.
+func getLidarTime(gpsTime time.Time, timestamp uint32) time.Time {
+	t := gpsTime.Truncate(time.Hour).Add(time.Duration(timestamp) * time.Microsecond)
+	if offset := t.Sub(gpsTime); offset > 30*time.Minute {
+		t = t.Add(-time.Hour)
+	} else if offset < -30*time.Minute {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
@@ -0,0 +1,89 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"testing"
+	"time"
+)
+
+// payloadOf returns the UDP payload of a test packet
+func payloadOf(data []byte) []byte {
+	return getPayload(gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default))
+}
+
+func TestReadDatagramsPassesPayloads(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	datagrams := make(chan datagram, 1)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go readDatagrams(conn, datagrams, errs, done)
+
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	payload := payloadOf(lidarPackets(t, "10.0.0.1", testStart, 1)[0].data)
+	if _, err := sender.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case dg := <-datagrams:
+		if !bytes.Equal(dg.data, payload) || dg.address != "127.0.0.1" {
+			t.Errorf("received %d bytes from %s, expected the %d bytes of the payload", len(dg.data), dg.address, len(payload))
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no datagram is received")
+	}
+}
+
+func TestDecodeDatagramTimesByGPS(t *testing.T) {
+	keepUserInput(t)
+	var frames []LidarFrame
+	d := NewDecoder()
+	d.AddFrameHandler(func(ls *LidarSource, frame *LidarFrame) error {
+		frames = append(frames, copyFrame(frame))
+		return nil
+	})
+
+	statuses := make(map[string]liveStatus)
+	gpsTimes := make(map[string]time.Time)
+	gpsTime := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	position := datagram{address: "10.0.0.1", data: payloadOf(positionPacket(t, "10.0.0.1", ppsLocked, gpsTime)), time: testStart}
+	if err := d.decodeDatagram(position, statuses, gpsTimes); err != nil {
+		t.Fatal(err)
+	}
+	if !gpsTimes["10.0.0.1"].Equal(gpsTime) || statuses["10.0.0.1"].ppsStatus != ppsLocked {
+		t.Fatalf("position packet sets the GPS time %s and the status %+v", gpsTimes["10.0.0.1"], statuses["10.0.0.1"])
+	}
+
+	for _, packet := range lidarPackets(t, "10.0.0.1", testStart, 200) {
+		dg := datagram{address: "10.0.0.1", data: payloadOf(packet.data), time: packet.time}
+		if err := d.decodeDatagram(dg, statuses, gpsTimes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(frames) < 2 {
+		t.Fatalf("decoded %d frames", len(frames))
+	}
+	// the timestamps count the microseconds past the hour of the GPS time, instead of the receive time
+	for _, frame := range frames {
+		if !frame.Time.Truncate(time.Hour).Equal(gpsTime) || len(frame.Points) == 0 {
+			t.Errorf("frame %d is at %s with %d points", frame.Index, frame.Time, len(frame.Points))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"os"
+)
+
+// MergePCAP writes the packets of all input PCAP files into the output file, ordered by their record time
+func MergePCAP() error {
+	ui := &global.UserInput
+
+	reader, err := openPacketReader(ui.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	linkType, err := reader.LinkType()
+	if err != nil {
+		return err
+	}
+	writer, err := NewCaptureWriter(ui.OutputFile, linkType, reader.SnapLen(), "")
+	if err != nil {
+		return err
+	}
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+
+		if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d packets of %d files\n", writer.FileName, writer.PacketCount, len(ui.PcapFiles.Value()))
+	return nil
+}
@@ -0,0 +1,229 @@
+package pcapdecoder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testPacket is a packet of a synthetic capture
+type testPacket struct {
+	time        time.Time
+	interfaceID int
+	data        []byte
+}
+
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// udpPacket returns an Ethernet frame of a UDP packet of the address
+func udpPacket(t *testing.T, address string, port int, payload []byte) []byte {
+	t.Helper()
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(address).To4(),
+		DstIP:    net.IPv4(255, 255, 255, 255).To4()}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(port), DstPort: layers.UDPPort(port)}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, ethernet, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// lidarPackets returns the VLP-16 packets of a source, 1ms apart, whose azimuth turns by 37 per block
+func lidarPackets(t *testing.T, address string, start time.Time, count int) []testPacket {
+	t.Helper()
+	var packets []testPacket
+	for i := 0; i < count; i++ {
+		payload := make([]byte, 1206)
+		for block := 0; block < 12; block++ {
+			offset := block * 100
+			azimuth := (i*12 + block) * 37 % 36000
+			payload[offset] = 0xFF
+			payload[offset+1] = 0xEE
+			binary.LittleEndian.PutUint16(payload[offset+2:], uint16(azimuth))
+			for channel := 0; channel < 32; channel++ {
+				binary.LittleEndian.PutUint16(payload[offset+4+channel*3:], uint16(1000+i%100+channel))
+				payload[offset+6+channel*3] = byte(block + channel)
+			}
+		}
+		binary.LittleEndian.PutUint32(payload[1200:], uint32(1000*(i+1)))
+		payload[1204] = 0x37
+		payload[1205] = 0x22
+
+		packets = append(packets, testPacket{
+			time: start.Add(time.Duration(i) * time.Millisecond),
+			data: udpPacket(t, address, 2368, payload)})
+	}
+	return packets
+}
+
+// positionPacket returns a position packet of the address with the PPS status and a valid GPRMC sentence of the GPS time
+func positionPacket(t *testing.T, address string, ppsStatus byte, gpsTime time.Time) []byte {
+	t.Helper()
+	payload := make([]byte, 512)
+	hour := gpsTime.Truncate(time.Hour)
+	binary.LittleEndian.PutUint32(payload[198:], uint32(gpsTime.Sub(hour)/time.Microsecond))
+	payload[202] = ppsStatus
+	copy(payload[206:], fmt.Sprintf("$GPRMC,%s,A,3540.1234,N,13945.1234,E,000.0,000.0,%s,,,A*00\r\n",
+		gpsTime.Format("150405.00"), gpsTime.Format("020106")))
+	return udpPacket(t, address, 8308, payload)
+}
+
+// writePcap writes the packets into a PCAP file
+func writePcap(t *testing.T, fileName string, packets []testPacket) {
+	t.Helper()
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	for _, packet := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: packet.time, CaptureLength: len(packet.data), Length: len(packet.data)}
+		if err := writer.WritePacket(ci, packet.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writePcapng writes the packets into a pcapng file of the interfaces
+func writePcapng(t *testing.T, fileName string, interfaces []pcapgo.NgInterface, packets []testPacket) {
+	t.Helper()
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := pcapgo.NewNgWriterInterface(file, interfaces[0], pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, intf := range interfaces[1:] {
+		if _, err := writer.AddInterface(intf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, packet := range packets {
+		ci := gopacket.CaptureInfo{
+			Timestamp:      packet.time,
+			CaptureLength:  len(packet.data),
+			Length:         len(packet.data),
+			InterfaceIndex: packet.interfaceID}
+		if err := writer.WritePacket(ci, packet.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readPackets returns all packets of the files
+func readPackets(t *testing.T, fileNames ...string) []gopacket.Packet {
+	t.Helper()
+	reader, err := openPacketReader(fileNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var packets []gopacket.Packet
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			return packets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+	}
+}
+
+// keepUserInput restores the user input after the test
+func keepUserInput(t *testing.T) {
+	saved := global.UserInput
+	t.Cleanup(func() { global.UserInput = saved })
+}
+
+// keepVehicle restores the current vehicle of the registry after the test
+func keepVehicle(t *testing.T) {
+	saved := registry.Current
+	t.Cleanup(func() { registry.Current = saved })
+}
+
+// lidarCapture returns the packets of two lidar sources, 0.5ms apart, in the order of their record time
+func lidarCapture(t *testing.T, count int) []testPacket {
+	t.Helper()
+	packets := append(lidarPackets(t, "10.0.0.1", testStart, count),
+		lidarPackets(t, "10.0.0.2", testStart.Add(500*time.Microsecond), count)...)
+	sortPackets(packets)
+	return packets
+}
+
+// sortPackets puts the packets in the order of their record time
+func sortPackets(packets []testPacket) {
+	sort.SliceStable(packets, func(i, j int) bool { return packets[i].time.Before(packets[j].time) })
+}
+
+// decodeFrames returns the completed frames of the files by source ID
+func decodeFrames(t *testing.T, fileNames ...string) map[string][]LidarFrame {
+	t.Helper()
+	reader, err := openPacketReader(fileNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	frames := make(map[string][]LidarFrame)
+	d := NewDecoder()
+	d.recordedAzimuths = reader.RecordedAzimuths()
+	d.AddFrameHandler(func(ls *LidarSource, frame *LidarFrame) error {
+		frames[ls.ID()] = append(frames[ls.ID()], copyFrame(frame))
+		return nil
+	})
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.DecodePacket(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// copyFrame returns a copy of a frame passed to a frame handler, with its own points
+func copyFrame(frame *LidarFrame) LidarFrame {
+	copied := *frame
+	copied.Points = append([]LidarPoint(nil), frame.Points...)
+	return copied
+}
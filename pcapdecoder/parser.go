@@ -1,78 +1,235 @@
 package pcapdecoder
 
 import (
-	"clarity/lib"
 	"fmt"
 	"github.com/bldulam1/pcap-decoder/global"
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
-	"pcap-decoder/calibration"
-	"strings"
+	"github.com/google/gopacket/layers"
+	"io"
+	"os"
+	"time"
 )
 
-var lidarSources = make(map[string]LidarSource)
+// Lengths of the UDP payloads of the sensor packets
+const (
+	lidarPayloadLength    = 1206
+	positionPayloadLength = 512
+	cameraPayloadLength   = 1316
+)
+
+// FrameHandler processes a completed frame of a lidar source
+type FrameHandler func(ls *LidarSource, frame *LidarFrame) error
+
+// Decoder holds the lidar and camera sources of one pass over the packets of a capture, by their source ID
+type Decoder struct {
+	lidarSources   map[string]LidarSource
+	cameraSources  map[string]*CameraSource
+	frameHandlers  []FrameHandler
+	cameraHandlers []CameraHandler
+	startFrame     int
+	endFrame       int
+	stride         int
+	// unsupported holds the skipped sources of unsupported lidar models and camera payloads, to warn once
+	unsupported map[string]bool
+	// recordedAzimuths holds the initial azimuths of the sources of a trimmed capture, by source ID
+	recordedAzimuths map[string]uint16
+}
+
+// leadingFrame is the index of the points of a trimmed capture before its first frame boundary.
+// The next frame wraps around to 0, and handleFrame skips the leading frame as its int index is negative.
+const leadingFrame = ^uint(0)
+
+// NewDecoder creates a Decoder of all frames without sources and handlers
+func NewDecoder() *Decoder {
+	return &Decoder{
+		lidarSources:  make(map[string]LidarSource),
+		cameraSources: make(map[string]*CameraSource),
+		unsupported:   make(map[string]bool),
+		endFrame:      -1,
+		stride:        1}
+}
+
+// SetFrameRange selects the frames passed to the frame handlers, an end frame of -1 decodes until the end
+func (d *Decoder) SetFrameRange(startFrame int, endFrame int, stride int) {
+	d.startFrame = startFrame
+	d.endFrame = endFrame
+	d.stride = stride
+}
+
+// defaultDecoder is the Decoder of ParsePCAP
+var defaultDecoder = NewDecoder()
+
+// AddFrameHandler registers a handler of the completed frames within the frame range of ParsePCAP
+func AddFrameHandler(handler FrameHandler) {
+	defaultDecoder.AddFrameHandler(handler)
+}
+
+// AddCameraHandler registers a handler of the complete camera images of ParsePCAP
+func AddCameraHandler(handler CameraHandler) {
+	defaultDecoder.AddCameraHandler(handler)
+}
+
+// AddFrameHandler registers a handler of the completed frames within the frame range
+func (d *Decoder) AddFrameHandler(handler FrameHandler) {
+	d.frameHandlers = append(d.frameHandlers, handler)
+}
+
+// AddCameraHandler registers a handler of the complete camera images
+func (d *Decoder) AddCameraHandler(handler CameraHandler) {
+	d.cameraHandlers = append(d.cameraHandlers, handler)
+}
 
-// ParsePCAP creates several go routines to start decoding the PCAP file.
-func ParsePCAP() {
-	// get packets handler
-	handle, err := pcap.OpenOffline(global.UserInput.PcapFile)
-	lib.DisplayError(err)
-	packets := gopacket.NewPacketSource(handle, handle.LinkType()).Packets()
+// ParsePCAP decodes the input PCAP file and passes the frames to the registered handlers
+func ParsePCAP() error {
+	reader, err := openPacketReader(global.UserInput.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
 
-PACKETS:
-	for packet := range packets {
-		nextPacketData := packet.Data()
+	ui := &global.UserInput
+	defaultDecoder.SetFrameRange(ui.StartFrame, ui.EndFrame, ui.Stride)
+	defaultDecoder.recordedAzimuths = reader.RecordedAzimuths()
 
-		switch len(nextPacketData) {
-		case 1248:
-			address := getIPv4(packet.String())
-			decodeLidarPacket(address, &nextPacketData)
+	var checkpoints *checkpointer
+	if ui.Checkpoint > 0 {
+		if checkpoints, err = newCheckpointer(reader, defaultDecoder, ui.PcapFiles.Value()); err != nil {
+			return err
+		}
+		if err := checkpoints.resume(); err != nil {
+			return err
+		}
+	}
 
-			//decodeLidarPacket(&packet, indexLookup, &lidarSources, &nextPacketData)
-		case 554:
-			// fmt.Println("GPRMC packet")
-		case 1358:
-			// decodeCameraPacket(&packet)
-		default:
-			continue PACKETS
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := defaultDecoder.DecodePacket(packet); err != nil {
+			return err
+		}
+		if defaultDecoder.isAfterEndFrame() {
+			break
+		}
+		if checkpoints != nil {
+			if err := checkpoints.update(); err != nil {
+				return err
+			}
 		}
+	}
 
+	if checkpoints != nil {
+		return checkpoints.finish()
 	}
+	return nil
 }
 
-// getIPv4 returns the IP address of the lidar packet
-func getIPv4(pcapString string) string {
-	srcIP := ""
-	details := strings.Split(pcapString, "\n")
-
-	for _, detail := range details {
-		if strings.Contains(detail, "SrcIP") {
-			subDetails := strings.Split(detail, " ")
-			for _, subDetail := range subDetails {
-				if strings.Contains(subDetail, "SrcIP") {
-					srcIP = strings.Split(subDetail, "=")[1]
-				}
-			}
+// DecodePacket decodes a lidar or camera packet of a whitelisted source
+func (d *Decoder) DecodePacket(packet gopacket.Packet) error {
+	payload := getPayload(packet)
+	metadata := packet.Metadata()
+
+	switch len(payload) {
+	case lidarPayloadLength:
+		address := getIPv4(packet)
+		if !global.UserInput.IsWhitelisted(address) {
+			return nil
 		}
+		return d.decodeLidarPacket(address, metadata.InterfaceIndex, &payload, metadata.Timestamp)
+	case positionPayloadLength:
+		// position packets are summarized by the info subcommand
+	case cameraPayloadLength:
+		address := getIPv4(packet)
+		if !global.UserInput.IsCameraWhitelisted(address) {
+			return nil
+		}
+		return d.decodeCameraPacket(address, metadata.InterfaceIndex, payload, metadata.Timestamp)
+	}
+	return nil
+}
+
+// SeedLidarSource starts the decoding of a source in the middle of a capture.
+// The initial azimuth and frame index of the source are known from a previous pass,
+// the next packets of the source must belong to the given frame.
+func (d *Decoder) SeedLidarSource(address string, interfaceID int, initialAzimuth uint16, frameIndex uint) error {
+	ls, err := NewLidarSource(address, initialAzimuth, time.Time{})
+	if err != nil {
+		return err
 	}
+	ls.Interface = interfaceID
+	ls.CurrentFrame.Index = frameIndex
+	d.lidarSources[ls.ID()] = ls
+	return nil
+}
+
+// getPayload returns the UDP payload of the packet, whatever its link layer, or nil when it is not a UDP packet
+func getPayload(packet gopacket.Packet) []byte {
+	if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		return udp.Payload
+	}
+	return nil
+}
+
+// getIPv4 returns the IP address of the lidar packet
+func getIPv4(packet gopacket.Packet) string {
+	networkLayer := packet.NetworkLayer()
+	if networkLayer == nil {
+		return ""
+	}
+
+	return networkLayer.NetworkFlow().Src().String()
+}
 
-	return srcIP
+// getSourceID returns the ID of the source of the packet, by its IP address and capture interface
+func getSourceID(packet gopacket.Packet) string {
+	return sourceID(getIPv4(packet), packet.Metadata().InterfaceIndex)
 }
 
-func decodeLidarPacket(address string, nextPacketData *[]byte) {
-	lidarSource := lidarSources[address]
+// sourceID tells apart the sources of the same address on the interfaces of a pcapng capture.
+// The first interface, and the only one of a PCAP file, keeps the plain address.
+func sourceID(address string, interfaceID int) string {
+	if interfaceID == 0 {
+		return address
+	}
+	return fmt.Sprintf("%s@%d", address, interfaceID)
+}
+
+func (d *Decoder) decodeLidarPacket(address string, interfaceID int, nextPacketData *[]byte, recordTime time.Time) error {
+	id := sourceID(address, interfaceID)
+	if productID := getProductID(nextPacketData); !isSupportedModel(productID) {
+		if !d.unsupported[id] {
+			d.unsupported[id] = true
+			fmt.Fprintf(os.Stderr, "%s: %s lidar is not supported, its packets are skipped\n", id, getModelName(productID))
+		}
+		return nil
+	}
+	lidarSource := d.lidarSources[id]
 
 	// Parse packet in advance
 	nextPacket, err := NewLidarPacket(nextPacketData)
-	check(err)
+	if err != nil {
+		return err
+	}
 
 	if len(lidarSource.Address) == 0 {
-		lidarSource = LidarSource{
-			Address:        address,
-			InitialAzimuth: nextPacket.Blocks[0].Azimuth,
-			Calibration:    calibration.Lidars[address],
+		initialAzimuth, ok := d.recordedAzimuths[id]
+		if !ok {
+			initialAzimuth = nextPacket.Blocks[0].Azimuth
+		}
+		lidarSource, err = NewLidarSource(address, initialAzimuth, recordTime)
+		if err != nil {
+			return err
+		}
+		lidarSource.Interface = interfaceID
+		// a trimmed capture starts with the packet that crosses the initial azimuth into its first frame
+		if initialAzimuth != nextPacket.Blocks[0].Azimuth {
+			lidarSource.CurrentFrame.Index = leadingFrame
 		}
-		fmt.Println(address, len(*nextPacketData))
 	}
 
 	// Wait for nonempty timestamp
@@ -82,20 +239,56 @@ func decodeLidarPacket(address string, nextPacketData *[]byte) {
 		prevFrameIndex := lidarSource.CurrentFrame.Index
 		lidarSource.SetCurrentFrame(lidarSource.CurrentFrame.Index)
 
-		if prevFrameIndex < lidarSource.CurrentFrame.Index {
-
-			if len(lidarSource.PreviousFrame.Points) > 0 {
-				fmt.Println(lidarSource.CurrentFrame.Index, address)
-			}
-
+		if prevFrameIndex != lidarSource.CurrentFrame.Index {
 			lidarSource.PreviousFrame = lidarSource.CurrentFrame
+			lidarSource.PreviousFrame.Index = prevFrameIndex
 			lidarSource.CurrentFrame.Points = lidarSource.Buffer
+			lidarSource.CurrentFrame.Time = lidarSource.CurrentPacketTime
 			lidarSource.Buffer = nil
+
+			if err := d.handleFrame(&lidarSource, &lidarSource.PreviousFrame); err != nil {
+				return err
+			}
 		}
 
 	}
 
 	// Update current packet
 	lidarSource.CurrentPacket = nextPacket
-	lidarSources[address] = lidarSource
+	lidarSource.CurrentPacketTime = recordTime
+	d.lidarSources[id] = lidarSource
+
+	return nil
+}
+
+// handleFrame passes the completed frame within the frame range to all frame handlers
+func (d *Decoder) handleFrame(ls *LidarSource, frame *LidarFrame) error {
+	index := int(frame.Index)
+	if index < d.startFrame || (d.endFrame >= 0 && index > d.endFrame) {
+		return nil
+	}
+	if d.stride > 1 && (index-d.startFrame)%d.stride != 0 {
+		return nil
+	}
+
+	for _, handler := range d.frameHandlers {
+		if err := handler(ls, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isAfterEndFrame checks if all lidar sources are done with the frame range, once a lidar source is found
+func (d *Decoder) isAfterEndFrame() bool {
+	if d.endFrame < 0 || len(d.lidarSources) == 0 {
+		return false
+	}
+
+	for _, ls := range d.lidarSources {
+		if int(ls.CurrentFrame.Index) <= d.endFrame {
+			return false
+		}
+	}
+	return true
 }
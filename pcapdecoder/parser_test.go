@@ -0,0 +1,89 @@
+package pcapdecoder
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// linkPacket returns the packet of a UDP payload of the address in the frame of the link type, an Ethernet frame is tagged with a VLAN
+func linkPacket(t *testing.T, linkType layers.LinkType, address string, payload []byte) []byte {
+	t.Helper()
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(address).To4(),
+		DstIP:    net.IPv4(255, 255, 255, 255).To4()}
+	udp := &layers.UDP{SrcPort: 2368, DstPort: 2368}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	serialized := []gopacket.SerializableLayer{ip, udp, gopacket.Payload(payload)}
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		ethernet := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			EthernetType: layers.EthernetTypeDot1Q}
+		vlan := &layers.Dot1Q{VLANIdentifier: 7, Type: layers.EthernetTypeIPv4}
+		serialized = append([]gopacket.SerializableLayer{ethernet, vlan}, serialized...)
+	case layers.LinkTypeLinuxSLL:
+		// packet type, ARP hardware type, address length, address and protocol of a Linux cooked capture
+		header := make([]byte, 16)
+		binary.BigEndian.PutUint16(header[2:], 1)
+		binary.BigEndian.PutUint16(header[4:], 6)
+		copy(header[6:], []byte{0, 1, 2, 3, 4, 5})
+		binary.BigEndian.PutUint16(header[14:], uint16(layers.EthernetTypeIPv4))
+		serialized = append([]gopacket.SerializableLayer{gopacket.Payload(header)}, serialized...)
+	}
+	if err := gopacket.SerializeLayers(buffer, options, serialized...); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecodePacketOfLinkTypes(t *testing.T) {
+	keepUserInput(t)
+	packets := lidarPackets(t, "10.0.0.1", testStart, 200)
+	expected := decodeLinkType(t, packets, layers.LinkTypeEthernet)
+	if len(expected) < 2 {
+		t.Fatalf("decoded %d frames of the Ethernet packets", len(expected))
+	}
+
+	// the Ethernet frames of a VLAN, the Linux cooked captures and the raw IP packets hold the same payloads
+	for _, linkType := range []layers.LinkType{layers.LinkTypeEthernet, layers.LinkTypeLinuxSLL, layers.LinkTypeRaw} {
+		var converted []testPacket
+		for _, packet := range packets {
+			payload := getPayload(gopacket.NewPacket(packet.data, layers.LayerTypeEthernet, gopacket.Default))
+			converted = append(converted, testPacket{time: packet.time, data: linkPacket(t, linkType, "10.0.0.1", payload)})
+		}
+		if frames := decodeLinkType(t, converted, linkType); !reflect.DeepEqual(frames, expected) {
+			t.Errorf("%s: decoded %d frames that differ from the %d frames of the Ethernet packets", linkType, len(frames), len(expected))
+		}
+	}
+}
+
+// decodeLinkType returns the frames of the packets of the link type
+func decodeLinkType(t *testing.T, packets []testPacket, linkType layers.LinkType) []LidarFrame {
+	t.Helper()
+	var frames []LidarFrame
+	d := NewDecoder()
+	d.AddFrameHandler(func(ls *LidarSource, frame *LidarFrame) error {
+		frames = append(frames, copyFrame(frame))
+		return nil
+	})
+
+	for _, packet := range packets {
+		decoded := gopacket.NewPacket(packet.data, linkType, gopacket.Default)
+		decoded.Metadata().Timestamp = packet.time
+		if err := d.DecodePacket(decoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return frames
+}
@@ -0,0 +1,152 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"path/filepath"
+)
+
+// minPerspectiveDepth is the near clipping plane of the virtual camera in meters
+const minPerspectiveDepth = 0.1
+
+// vector3 is a vector in the vehicle coordinates in meters
+type vector3 [3]float64
+
+func (a vector3) sub(b vector3) vector3 { return vector3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+
+func (a vector3) dot(b vector3) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func (a vector3) cross(b vector3) vector3 {
+	return vector3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func (a vector3) normalize() vector3 {
+	length := math.Sqrt(a.dot(a))
+	return vector3{a[0] / length, a[1] / length, a[2] / length}
+}
+
+// PerspectiveRenderer renders the frames from a virtual pinhole camera with z-buffered point splatting
+type PerspectiveRenderer struct {
+	options  global.RenderInput
+	colormap Colormap
+	eye      vector3
+	right    vector3
+	up       vector3
+	forward  vector3
+	focal    float64
+}
+
+// NewPerspectiveRenderer creates a PerspectiveRenderer looking from the eye to the look-at point, with the Z axis up
+func NewPerspectiveRenderer(options global.RenderInput) (*PerspectiveRenderer, error) {
+	colormap, err := GetColormap(options.Colormap)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.ColorMode {
+	case "depth", "height", "intensity", "ring":
+	default:
+		return nil, fmt.Errorf("color mode %q is not supported by the perspective view", options.ColorMode)
+	}
+
+	eye, lookAt := options.Eye.Value(), options.LookAt.Value()
+	if len(eye) != 3 || len(lookAt) != 3 {
+		return nil, fmt.Errorf("eye and look-at must be x,y,z in meters")
+	}
+	if options.FOV <= 0 || options.FOV >= 180 {
+		return nil, fmt.Errorf("field of view must be between 0 and 180 degrees")
+	}
+	if options.ImageWidth <= 0 || options.ImageHeight <= 0 || options.PointSize <= 0 {
+		return nil, fmt.Errorf("image size and point size must be positive")
+	}
+	if options.DepthMax <= options.DepthMin || options.ZMax <= options.ZMin {
+		return nil, fmt.Errorf("depth and height ranges must be increasing")
+	}
+
+	r := &PerspectiveRenderer{
+		options:  options,
+		colormap: colormap,
+		eye:      vector3{eye[0], eye[1], eye[2]},
+		focal:    float64(options.ImageHeight) / 2 / math.Tan(radians(options.FOV)/2)}
+
+	forward := vector3{lookAt[0], lookAt[1], lookAt[2]}.sub(r.eye)
+	right := forward.cross(vector3{0, 0, 1})
+	if forward.dot(forward) == 0 || right.dot(right) < 1e-12 {
+		return nil, fmt.Errorf("look-at must differ from the eye and must not be straight above or below it")
+	}
+	r.forward = forward.normalize()
+	r.right = right.normalize()
+	r.up = r.right.cross(r.forward)
+
+	return r, nil
+}
+
+// SaveFrame writes the perspective view of the frame into the output path
+func (r *PerspectiveRenderer) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	fileName := fmt.Sprintf("%s-persp%d.png", ls.Name(), frame.Index)
+	return savePNG(filepath.Join(global.UserInput.OutputPath, fileName), r.Render(ls, frame))
+}
+
+// Render returns the perspective view of the frame in the vehicle coordinates.
+// Each point is splatted as a square and the nearest point of each pixel is kept.
+func (r *PerspectiveRenderer) Render(ls *LidarSource, frame *LidarFrame) *image.RGBA {
+	width, height := r.options.ImageWidth, r.options.ImageHeight
+	m := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(m, m.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+
+	depths := make([]float64, width*height)
+	half := r.options.PointSize / 2
+
+	points := frame.CartesianPoints(frame.rotation, frame.translation)
+	for i, cp := range points {
+		d := vector3{cp.X / 1000, cp.Y / 1000, cp.Z / 1000}.sub(r.eye)
+		depth := d.dot(r.forward)
+		if depth <= minPerspectiveDepth {
+			continue
+		}
+
+		col := int(math.Floor(float64(width)/2 + r.focal*d.dot(r.right)/depth))
+		row := int(math.Floor(float64(height)/2 - r.focal*d.dot(r.up)/depth))
+		if col < -half || row < -half || col >= width+half || row >= height+half {
+			continue
+		}
+
+		var c color.RGBA
+		switch r.options.ColorMode {
+		case "depth":
+			// near points get the upper end of the colormap
+			c = r.colormap(clamp01((r.options.DepthMax - depth) / (r.options.DepthMax - r.options.DepthMin)))
+		case "height":
+			c = r.colormap(clamp01((cp.Z/1000 - r.options.ZMin) / (r.options.ZMax - r.options.ZMin)))
+		case "intensity":
+			c = r.colormap(float64(cp.Intensity) / 255)
+		case "ring":
+			ring, rings := getRingIndex(frame.Points[i].productID, frame.Points[i].rowIndex)
+			c = r.colormap(float64(ring) / float64(rings-1))
+		}
+
+		for y := row - half; y < row-half+r.options.PointSize; y++ {
+			for x := col - half; x < col-half+r.options.PointSize; x++ {
+				if x < 0 || y < 0 || x >= width || y >= height {
+					continue
+				}
+				index := y*width + x
+				if depths[index] != 0 && depths[index] <= depth {
+					continue
+				}
+				depths[index] = depth
+				m.SetRGBA(x, y, c)
+			}
+		}
+	}
+
+	return m
+}
+
+func clamp01(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
@@ -0,0 +1,88 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/urfave/cli"
+	"image"
+	"testing"
+)
+
+// perspectiveOptions looks along the Y axis from the origin with a focal length of 50 pixels
+func perspectiveOptions(colorMode string) global.RenderInput {
+	options := global.UserInput.Render
+	options.Eye = *cli.NewFloat64Slice(0, 0, 0)
+	options.LookAt = *cli.NewFloat64Slice(0, 10, 0)
+	options.FOV = 90
+	options.ImageWidth, options.ImageHeight = 100, 100
+	options.PointSize = 1
+	options.ColorMode = colorMode
+	return options
+}
+
+func TestPerspectiveRendererKeepsNearestPoint(t *testing.T) {
+	r, err := NewPerspectiveRenderer(perspectiveOptions("intensity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the far points of the same direction are hidden whatever their order, the point behind the eye is clipped
+	frame := LidarFrame{Points: []LidarPoint{
+		testPoint(1, 10, 20, 10), testPoint(1, 5, 20, 200), testPoint(1, 8, 20, 30), testPoint(1, 5, 200, 90)}}
+	m := r.Render(&LidarSource{Address: "10.0.0.1"}, &frame)
+
+	cp := frame.Points[1].GetXYZ()
+	col := int(50 + 50*cp.X/cp.Y)
+	row := int(50 - 50*cp.Z/cp.Y)
+	if c, expected := m.RGBAAt(col, row), r.colormap(200.0/255); c != expected {
+		t.Errorf("pixel (%d, %d) is %v, expected %v of the nearest point", col, row, c, expected)
+	}
+	if n := countColoredPixels(m); n != 1 {
+		t.Errorf("%d pixels are drawn, expected 1", n)
+	}
+
+	// the points are splatted as squares, and colored by their depth along the view
+	options := perspectiveOptions("depth")
+	options.PointSize = 3
+	r, err = NewPerspectiveRenderer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = r.Render(&LidarSource{Address: "10.0.0.1"}, &frame)
+	if c, expected := m.RGBAAt(col+1, row+1), r.colormap((10-cp.Y/1000)/10); !closeColor(c, expected) {
+		t.Errorf("pixel (%d, %d) is %v, expected %v of the depth", col+1, row+1, c, expected)
+	}
+	if n := countColoredPixels(m); n != 9 {
+		t.Errorf("%d pixels are drawn, expected 9", n)
+	}
+}
+
+func TestNewPerspectiveRendererRejectsInvalidOptions(t *testing.T) {
+	options := make([]global.RenderInput, 6)
+	for i := range options {
+		options[i] = perspectiveOptions("depth")
+	}
+	options[0].ColorMode = "density"
+	options[1].LookAt = *cli.NewFloat64Slice(0, 0, 0)
+	options[2].LookAt = *cli.NewFloat64Slice(0, 0, 10)
+	options[3].Eye = *cli.NewFloat64Slice(0, 0)
+	options[4].FOV = 180
+	options[5].PointSize = 0
+	for i, option := range options {
+		if _, err := NewPerspectiveRenderer(option); err == nil {
+			t.Errorf("options %d are accepted", i)
+		}
+	}
+}
+
+// countColoredPixels returns the number of pixels that differ from the background
+func countColoredPixels(m *image.RGBA) int {
+	count := 0
+	for y := m.Bounds().Min.Y; y < m.Bounds().Max.Y; y++ {
+		for x := m.Bounds().Min.X; x < m.Bounds().Max.X; x++ {
+			if m.RGBAAt(x, y) != backgroundColor {
+				count++
+			}
+		}
+	}
+	return count
+}
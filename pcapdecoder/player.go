@@ -0,0 +1,135 @@
+package pcapdecoder
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Player decodes the frames of selected lidar sources of an indexed capture packet by packet,
+// so that the caller can pace the packets by their timestamps
+type Player struct {
+	index        *CaptureIndex
+	handler      FrameHandler
+	reader       *packetReader
+	decoder      *Decoder
+	packetNumber int
+	// resume is the packet number from which each selected source is decoded
+	resume map[string]int
+	// firstFrame is the index of the first frame passed to the handler for each selected source
+	firstFrame map[string]uint
+}
+
+// NewPlayer creates a Player of the capture that passes the completed frames to the handler
+func (ci *CaptureIndex) NewPlayer(handler FrameHandler) *Player {
+	return &Player{index: ci, handler: handler}
+}
+
+// Seek restarts the playback at the first frame of each source that starts at or after the given time.
+// All sources of the capture are played when no source ID is given.
+func (p *Player) Seek(t time.Time, ids []string) error {
+	p.Close()
+
+	sources := p.index.Sources
+	if len(ids) > 0 {
+		sources = nil
+		for _, id := range ids {
+			source, err := p.index.GetSource(id)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, source)
+		}
+	}
+
+	p.decoder = NewDecoder()
+	p.decoder.AddFrameHandler(p.handleFrame)
+	p.resume = make(map[string]int)
+	p.firstFrame = make(map[string]uint)
+
+	start := math.MaxInt32
+	var startPositions []filePosition
+	for _, source := range sources {
+		position := 0
+		for position < len(source.Frames) && source.Frames[position].Time.Before(t) {
+			position++
+		}
+		if position == len(source.Frames) {
+			// the source has no frame left
+			continue
+		}
+
+		p.firstFrame[source.ID] = source.Frames[position].Index
+		p.resume[source.ID] = 0
+		if position > 0 && source.Frames[position-1].packet >= 0 {
+			previous := source.Frames[position-1]
+			p.resume[source.ID] = previous.packet
+			if err := p.decoder.SeedLidarSource(source.Address, source.Interface, source.initialAzimuth, previous.Index); err != nil {
+				return err
+			}
+		}
+
+		if p.resume[source.ID] < start {
+			start = p.resume[source.ID]
+			startPositions = nil
+			if start > 0 {
+				startPositions = source.Frames[position-1].start
+			}
+		}
+	}
+	if len(p.resume) == 0 {
+		return nil
+	}
+
+	reader, err := openPacketReader(p.index.PcapFiles)
+	if err != nil {
+		return err
+	}
+	p.reader = reader
+	p.decoder.recordedAzimuths = reader.RecordedAzimuths()
+	p.packetNumber = start
+	if startPositions == nil {
+		return nil
+	}
+	return reader.Seek(startPositions)
+}
+
+// Next decodes the next packet and returns its timestamp, or io.EOF after the last packet
+func (p *Player) Next() (time.Time, error) {
+	if p.reader == nil {
+		return time.Time{}, io.EOF
+	}
+
+	packet, err := p.reader.Next()
+	if err != nil {
+		return time.Time{}, err
+	}
+	packetNumber := p.packetNumber
+	p.packetNumber++
+
+	if len(getPayload(packet)) == lidarPayloadLength {
+		resume, ok := p.resume[getSourceID(packet)]
+		if ok && packetNumber >= resume {
+			if err := p.decoder.DecodePacket(packet); err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+	return packet.Metadata().Timestamp, nil
+}
+
+// Close releases the PCAP file of the playback
+func (p *Player) Close() {
+	if p.reader != nil {
+		p.reader.Close()
+		p.reader = nil
+	}
+}
+
+// handleFrame passes the frames from the seek position on to the handler
+func (p *Player) handleFrame(ls *LidarSource, frame *LidarFrame) error {
+	if frame.Index < p.firstFrame[ls.ID()] {
+		return nil
+	}
+	return p.handler(ls, frame)
+}
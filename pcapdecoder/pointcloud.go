@@ -0,0 +1,142 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// PointCloudWriter writes the frames as PLY or PCD point clouds in the vehicle coordinates
+type PointCloudWriter struct {
+	format    string
+	colorizer *Colorizer
+}
+
+// NewPointCloudWriter creates a PointCloudWriter of the "ply" or "pcd" format.
+// The colorizer is optional, the points have the gray of their intensity without it.
+func NewPointCloudWriter(format string, colorizer *Colorizer) (*PointCloudWriter, error) {
+	if format != "ply" && format != "pcd" {
+		return nil, fmt.Errorf("point cloud format %q is not supported", format)
+	}
+	return &PointCloudWriter{format: format, colorizer: colorizer}, nil
+}
+
+// SaveFrame writes the point cloud of the frame into <sensor>-frame<index>.ply or .pcd.
+// A colorized frame is written once the colorizer knows its camera images.
+func (w *PointCloudWriter) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	if w.colorizer != nil {
+		return w.colorizer.ColorizeFrame(ls, frame, w.writePoints)
+	}
+
+	var points []ColoredPoint
+	for _, cp := range frame.CartesianPoints(frame.rotation, frame.translation) {
+		points = append(points, ColoredPoint{CartesianPoint: cp, R: cp.Intensity, G: cp.Intensity, B: cp.Intensity})
+	}
+	return w.writePoints(ls, frame, points)
+}
+
+func (w *PointCloudWriter) writePoints(ls *LidarSource, frame *LidarFrame, points []ColoredPoint) error {
+	fileName := fmt.Sprintf("%s-frame%d.%s", ls.Name(), frame.Index, w.format)
+	f, err := os.Create(filepath.Join(global.UserInput.OutputPath, fileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	if w.format == "ply" {
+		err = WritePLY(bw, points)
+	} else {
+		err = WritePCD(bw, points)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WritePLY writes the points in meters as a binary little endian PLY file
+func WritePLY(w io.Writer, points []ColoredPoint) error {
+	header := "ply\n" +
+		"format binary_little_endian 1.0\n" +
+		fmt.Sprintf("element vertex %d\n", len(points)) +
+		"property float x\n" +
+		"property float y\n" +
+		"property float z\n" +
+		"property uchar intensity\n" +
+		"property uchar red\n" +
+		"property uchar green\n" +
+		"property uchar blue\n" +
+		"end_header\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	record := make([]byte, 16)
+	for _, point := range points {
+		putXYZ(record, &point)
+		record[12] = point.Intensity
+		record[13], record[14], record[15] = point.R, point.G, point.B
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePCD writes the points in meters as a binary PCD file, with the color packed into the rgb field of PCL
+func WritePCD(w io.Writer, points []ColoredPoint) error {
+	header := "# .PCD v0.7 - Point Cloud Data file format\n" +
+		"VERSION 0.7\n" +
+		"FIELDS x y z intensity rgb\n" +
+		"SIZE 4 4 4 1 4\n" +
+		"TYPE F F F U F\n" +
+		"COUNT 1 1 1 1 1\n" +
+		fmt.Sprintf("WIDTH %d\n", len(points)) +
+		"HEIGHT 1\n" +
+		"VIEWPOINT 0 0 0 1 0 0 0\n" +
+		fmt.Sprintf("POINTS %d\n", len(points)) +
+		"DATA binary\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	record := make([]byte, 17)
+	for _, point := range points {
+		putXYZ(record, &point)
+		record[12] = point.Intensity
+		rgb := uint32(point.R)<<16 | uint32(point.G)<<8 | uint32(point.B)
+		binary.LittleEndian.PutUint32(record[13:], rgb)
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putXYZ(record []byte, point *ColoredPoint) {
+	binary.LittleEndian.PutUint32(record[0:], math.Float32bits(float32(point.X/1000)))
+	binary.LittleEndian.PutUint32(record[4:], math.Float32bits(float32(point.Y/1000)))
+	binary.LittleEndian.PutUint32(record[8:], math.Float32bits(float32(point.Z/1000)))
+}
+
+// EncodeFloat32 returns the points of the frame in the vehicle coordinates as little endian float32 x, y, z in meters
+// and the intensity, 16 bytes per point
+func (lf *LidarFrame) EncodeFloat32() []byte {
+	points := lf.CartesianPoints(lf.rotation, lf.translation)
+	data := make([]byte, 16*len(points))
+
+	for i, cp := range points {
+		record := data[16*i:]
+		binary.LittleEndian.PutUint32(record[0:], math.Float32bits(float32(cp.X/1000)))
+		binary.LittleEndian.PutUint32(record[4:], math.Float32bits(float32(cp.Y/1000)))
+		binary.LittleEndian.PutUint32(record[8:], math.Float32bits(float32(cp.Z/1000)))
+		binary.LittleEndian.PutUint32(record[12:], math.Float32bits(float32(cp.Intensity)))
+	}
+	return data
+}
@@ -0,0 +1,74 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PositionPacket is the raw decoded info of a lidar position (GPRMC) packet
+type PositionPacket struct {
+	TimeStamp uint32 `json:"timestamp"`
+	PPSStatus byte   `json:"ppsStatus"`
+	NMEA      string `json:"nmea"`
+}
+
+// NewPositionPacket creates a new PositionPacket Object from the UDP payload of a position packet
+func NewPositionPacket(data *[]byte) (PositionPacket, error) {
+	var pp PositionPacket
+	var err error
+
+	if len(*data) == positionPayloadLength {
+		payload := *data
+		nmea := payload[206:334]
+		if end := bytes.IndexAny(nmea, "\x00\r\n"); end >= 0 {
+			nmea = nmea[:end]
+		}
+
+		pp = PositionPacket{
+			TimeStamp: binary.LittleEndian.Uint32(payload[198:202]),
+			PPSStatus: payload[202],
+			NMEA:      string(nmea)}
+	} else {
+		err = fmt.Errorf("not a position packet")
+	}
+
+	return pp, err
+}
+
+// PPSStatusName returns the readable status of the PPS signal
+func (pp PositionPacket) PPSStatusName() string {
+	switch pp.PPSStatus {
+	case 0:
+		return "Absent"
+	case 1:
+		return "Synchronizing"
+	case 2:
+		return "Locked"
+	case 3:
+		return "Error"
+	}
+	return fmt.Sprintf("Unknown (%d)", pp.PPSStatus)
+}
+
+// IsGPSValid checks if the GPRMC sentence has a valid fix
+func (pp PositionPacket) IsGPSValid() bool {
+	fields := strings.Split(pp.NMEA, ",")
+	return len(fields) > 2 && strings.HasSuffix(fields[0], "RMC") && fields[2] == "A"
+}
+
+// GetTime returns the UTC date and time of the GPRMC sentence
+func (pp PositionPacket) GetTime() (time.Time, error) {
+	fields := strings.Split(pp.NMEA, ",")
+	if len(fields) < 10 || !strings.HasSuffix(fields[0], "RMC") {
+		return time.Time{}, fmt.Errorf("not a GPRMC sentence: %q", pp.NMEA)
+	}
+
+	clock := fields[1]
+	if dot := strings.IndexByte(clock, '.'); dot >= 0 {
+		clock = clock[:dot]
+	}
+	return time.Parse("020106 150405", fields[9]+" "+clock)
+}
@@ -0,0 +1,134 @@
+package pcapdecoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// RangeImage is the projection of a frame into the rings and azimuth bins of the lidar.
+// Row 0 is the highest ring and the middle column is the azimuth 0.
+type RangeImage struct {
+	Rings     int
+	Bins      int
+	Range     []float32
+	Intensity []uint8
+}
+
+// NewRangeImage projects the frame into a RangeImage, keeping the nearest point of each pixel
+func NewRangeImage(frame *LidarFrame, bins int) RangeImage {
+	rings := 0
+	if len(frame.Points) > 0 {
+		_, rings = getRingIndex(frame.Points[0].productID, frame.Points[0].rowIndex)
+	}
+
+	ri := RangeImage{
+		Rings:     rings,
+		Bins:      bins,
+		Range:     make([]float32, rings*bins),
+		Intensity: make([]uint8, rings*bins)}
+
+	for _, point := range frame.Points {
+		ring, _ := getRingIndex(point.productID, point.rowIndex)
+		row := rings - 1 - ring
+
+		azimuth := math.Mod(point.Azimuth()+180, 360)
+		col := int(azimuth / 360 * float64(bins))
+		if col >= bins {
+			col = bins - 1
+		}
+
+		index := row*bins + col
+		distance := float32(point.Distance() / 1000)
+		if ri.Range[index] == 0 || distance < ri.Range[index] {
+			ri.Range[index] = distance
+			ri.Intensity[index] = point.Intensity
+		}
+	}
+
+	return ri
+}
+
+// RangePNG returns the 16-bit range image, where a pixel value is the range in units of meters. 0 means no return.
+func (ri *RangeImage) RangePNG(unit float64) *image.Gray16 {
+	m := image.NewGray16(image.Rect(0, 0, ri.Bins, ri.Rings))
+	for index, distance := range ri.Range {
+		value := math.Round(float64(distance) / unit)
+		if value > math.MaxUint16 {
+			value = math.MaxUint16
+		}
+		m.SetGray16(index%ri.Bins, index/ri.Bins, color.Gray16{uint16(value)})
+	}
+	return m
+}
+
+// IntensityPNG returns the 8-bit intensity panorama
+func (ri *RangeImage) IntensityPNG() *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, ri.Bins, ri.Rings))
+	copy(m.Pix, ri.Intensity)
+	return m
+}
+
+// SaveRaw writes the ranges in meters as little endian float32, row by row
+func (ri *RangeImage) SaveRaw(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := binary.Write(w, binary.LittleEndian, ri.Range); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// RangeRenderer writes the range image and intensity panorama of the frames
+type RangeRenderer struct {
+	options global.RenderInput
+}
+
+// NewRangeRenderer creates a RangeRenderer with validated options
+func NewRangeRenderer(options global.RenderInput) (*RangeRenderer, error) {
+	if options.AzimuthBins <= 0 || options.AzimuthBins > 36000 {
+		return nil, fmt.Errorf("azimuth bins must be between 1 and 36000")
+	}
+	if options.RangeUnit <= 0 {
+		return nil, fmt.Errorf("range unit must be positive")
+	}
+
+	return &RangeRenderer{options: options}, nil
+}
+
+// SaveFrame writes the range image, intensity panorama and optionally the raw ranges of the frame
+func (r *RangeRenderer) SaveFrame(ls *LidarSource, frame *LidarFrame) error {
+	ri := NewRangeImage(frame, r.options.AzimuthBins)
+	if ri.Rings == 0 {
+		return nil
+	}
+
+	outputPath := global.UserInput.OutputPath
+	name := ls.Name()
+
+	err := savePNG(filepath.Join(outputPath, fmt.Sprintf("%s-range%d.png", name, frame.Index)), ri.RangePNG(r.options.RangeUnit))
+	if err != nil {
+		return err
+	}
+
+	err = savePNG(filepath.Join(outputPath, fmt.Sprintf("%s-intensity%d.png", name, frame.Index)), ri.IntensityPNG())
+	if err != nil {
+		return err
+	}
+
+	if r.options.IsSaveRaw {
+		return ri.SaveRaw(filepath.Join(outputPath, fmt.Sprintf("%s-range%d.bin", name, frame.Index)))
+	}
+	return nil
+}
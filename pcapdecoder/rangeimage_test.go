@@ -0,0 +1,92 @@
+package pcapdecoder
+
+import (
+	"encoding/binary"
+	"github.com/bldulam1/pcap-decoder/global"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readPNG(t *testing.T, fileName string) image.Image {
+	t.Helper()
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRangeRendererSavesFrame(t *testing.T) {
+	keepUserInput(t)
+	global.UserInput.OutputPath = t.TempDir()
+
+	options := global.UserInput.Render
+	options.AzimuthBins = 360
+	options.RangeUnit = 0.01
+	options.IsSaveRaw = true
+	r, err := NewRangeRenderer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// row 15 is the highest laser of the VLP-16 and row 0 the lowest, the nearest point of a pixel is kept
+	frame := LidarFrame{Index: 4, Points: []LidarPoint{
+		testPoint(15, 10, 0, 20), testPoint(15, 5, 0.5, 50), testPoint(0, 2.5, 90, 200)}}
+	if err := r.SaveFrame(&LidarSource{Address: "10.0.0.1"}, &frame); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := readPNG(t, filepath.Join(global.UserInput.OutputPath, "10.0.0.1-range4.png")).(*image.Gray16)
+	intensities := readPNG(t, filepath.Join(global.UserInput.OutputPath, "10.0.0.1-intensity4.png")).(*image.Gray)
+	if ranges.Bounds() != image.Rect(0, 0, 360, 16) || intensities.Bounds() != ranges.Bounds() {
+		t.Fatalf("images are %v and %v", ranges.Bounds(), intensities.Bounds())
+	}
+
+	// the azimuth 0 is in the middle column
+	pixels := []struct {
+		col, row  int
+		value     uint16
+		intensity uint8
+	}{{180, 0, 500, 50}, {270, 15, 250, 200}, {0, 0, 0, 0}, {270, 0, 0, 0}}
+	for _, pixel := range pixels {
+		if value := ranges.Gray16At(pixel.col, pixel.row).Y; value != pixel.value {
+			t.Errorf("range of (%d, %d) is %d, expected %d", pixel.col, pixel.row, value, pixel.value)
+		}
+		if intensity := intensities.GrayAt(pixel.col, pixel.row).Y; intensity != pixel.intensity {
+			t.Errorf("intensity of (%d, %d) is %d, expected %d", pixel.col, pixel.row, intensity, pixel.intensity)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(global.UserInput.OutputPath, "10.0.0.1-range4.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4*360*16 {
+		t.Fatalf("raw ranges have %d bytes", len(data))
+	}
+	if value := math.Float32frombits(binary.LittleEndian.Uint32(data[4*(15*360+270):])); value != 2.5 {
+		t.Errorf("raw range of (270, 15) is %f", value)
+	}
+}
+
+func TestNewRangeRendererRejectsInvalidOptions(t *testing.T) {
+	options := []global.RenderInput{global.UserInput.Render, global.UserInput.Render, global.UserInput.Render}
+	options[0].AzimuthBins = 0
+	options[1].AzimuthBins = 36001
+	options[2].RangeUnit = 0
+	for i, option := range options {
+		if _, err := NewRangeRenderer(option); err == nil {
+			t.Errorf("options %d are accepted", i)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"os"
+	"strings"
+)
+
+// pcapngMagic starts the section header block of a pcapng file
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// maxSnapLen is the captured length of an interface without a snap length
+const maxSnapLen = 262144
+
+// Lengths of the file header and the packet record header of a PCAP file
+const (
+	pcapHeaderLength       = 24
+	pcapRecordHeaderLength = 16
+)
+
+// packetReader reads the packets of one or more PCAP or pcapng files one by one.
+// The packets of several files are merged by their record time.
+type packetReader struct {
+	files []*captureFile
+	// queue holds the files with a pending packet, by the record time of the packet
+	queue       captureQueue
+	isQueueRead bool
+	// last is the file of the last packet returned by Next
+	last *captureFile
+	// interfaceCount is the number of interfaces of the merged capture so far
+	interfaceCount int
+}
+
+// captureFile is an open PCAP or pcapng file with its next packet, once it is read ahead
+type captureFile struct {
+	position int
+	fileName string
+	data     packetDataSource
+	next     gopacket.Packet
+	// isSeekable tells that the file is a plain PCAP file, which can be read from the byte offset of a packet
+	isSeekable bool
+	// isCompressed tells that the file is decompressed, where a short packet is a corrupt stream
+	isCompressed bool
+	// packets and offset count the packets passed on by the reader
+	packets int64
+	offset  int64
+	// lastLength is the captured length of the last packet passed on
+	lastLength int64
+	// interfaceIDs maps the interfaces of the file to the interfaces of the merged capture
+	interfaceIDs []int
+	// isFinished tells that all packets of the file are read
+	isFinished bool
+}
+
+// filePosition is the position of the packet reader in a capture file
+type filePosition struct {
+	FileName string `json:"fileName"`
+	Packets  int64  `json:"packets"`
+	// Offset is the byte offset of the next packet in a plain PCAP file, other files are read from the start
+	Offset int64 `json:"offset,omitempty"`
+	// Interfaces maps the interfaces of the file to the interfaces of several merged files
+	Interfaces []int `json:"interfaces,omitempty"`
+}
+
+// interfaceKey identifies an interface of a file by its name and link type, the occurrence tells apart
+// the interfaces of the same name and link type within the file
+type interfaceKey struct {
+	name       string
+	linkType   layers.LinkType
+	occurrence int
+}
+
+// packetDataSource reads the packet data of a capture file
+type packetDataSource interface {
+	gopacket.PacketDataSource
+	gopacket.ZeroCopyPacketDataSource
+	// LinkTypes returns the link types of the interfaces read so far
+	LinkTypes() []layers.LinkType
+	SnapLen() uint32
+	Close() error
+}
+
+func openPacketReader(fileNames []string) (*packetReader, error) {
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no PCAP file is given")
+	}
+
+	pr := &packetReader{}
+	for position, fileName := range fileNames {
+		file, err := openCaptureFile(position, fileName)
+		if err != nil {
+			pr.Close()
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		pr.files = append(pr.files, file)
+	}
+	return pr, nil
+}
+
+// openCaptureFile opens a pcapng or PCAP file by its magic bytes, after decompressing a gzip or zstd file
+func openCaptureFile(position int, fileName string) (*captureFile, error) {
+	cf := &captureFile{position: position, fileName: fileName, offset: pcapHeaderLength}
+	stream, err := openCaptureStream(fileName)
+	if err != nil {
+		return nil, err
+	}
+	cf.isCompressed = stream.isCompressed
+
+	magic, err := stream.Peek(len(pcapngMagic))
+	if err == nil && bytes.Equal(magic, pcapngMagic) {
+		// the interfaces may differ in link type and timestamp resolution
+		ng, err := pcapgo.NewNgReader(stream, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+		if err != nil {
+			stream.Close()
+			return nil, err
+		}
+		cf.data = &ngFile{NgReader: ng, stream: stream}
+		return cf, nil
+	}
+
+	if stream.isFile {
+		stream.Close()
+		cf.data, err = openPcapFile(fileName)
+		cf.isSeekable = true
+	} else {
+		cf.data, err = newPcapStream(stream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// Next returns the next packet, or io.EOF at the end of the files
+func (pr *packetReader) Next() (gopacket.Packet, error) {
+	if len(pr.files) == 1 {
+		packet, err := pr.files[0].read()
+		if err != nil {
+			return nil, err
+		}
+		pr.files[0].count(packet.Metadata().CaptureInfo)
+		pr.last = pr.files[0]
+		return packet, nil
+	}
+
+	if !pr.isQueueRead {
+		pr.isQueueRead = true
+		for _, file := range pr.files {
+			if err := pr.enqueue(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pr.queue.Len() == 0 {
+		return nil, io.EOF
+	}
+
+	file := heap.Pop(&pr.queue).(*captureFile)
+	packet := file.next
+	file.next = nil
+	pr.mapInterface(file, packet)
+	file.count(packet.Metadata().CaptureInfo)
+	pr.last = file
+	if err := pr.enqueue(file); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// enqueue reads the next packet of the file and queues the file, unless it is at the end
+func (pr *packetReader) enqueue(file *captureFile) error {
+	packet, err := file.read()
+	if err == io.EOF {
+		file.isFinished = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file.next = packet
+	heap.Push(&pr.queue, file)
+	return nil
+}
+
+// mapInterface sets the interface of a packet of several files to an interface of the merged capture.
+// An interface continues the unused interface of the same name and link type of a finished file,
+// like in the rotated files of one capture, otherwise it is numbered after the interfaces found before.
+func (pr *packetReader) mapInterface(file *captureFile, packet gopacket.Packet) {
+	metadata := packet.Metadata()
+	// the interfaces read so far are mapped in their order
+	for len(file.interfaceIDs) <= metadata.InterfaceIndex || len(file.interfaceIDs) < len(file.data.LinkTypes()) {
+		file.interfaceIDs = append(file.interfaceIDs, pr.continueInterface(file, len(file.interfaceIDs)))
+	}
+	metadata.InterfaceIndex = file.interfaceIDs[metadata.InterfaceIndex]
+}
+
+// continueInterface returns the merged interface of a new interface of the file
+func (pr *packetReader) continueInterface(file *captureFile, interfaceID int) int {
+	used := make(map[int]bool)
+	for _, other := range pr.files {
+		if other == file || !other.isFinished {
+			for _, id := range other.interfaceIDs {
+				used[id] = true
+			}
+		}
+	}
+
+	key := file.interfaceKey(interfaceID)
+	for _, other := range pr.files {
+		if !other.isFinished {
+			continue
+		}
+		for i, id := range other.interfaceIDs {
+			if !used[id] && other.interfaceKey(i) == key {
+				return id
+			}
+		}
+	}
+
+	pr.interfaceCount++
+	return pr.interfaceCount - 1
+}
+
+// Positions returns the position of the reader in every file
+func (pr *packetReader) Positions() []filePosition {
+	var positions []filePosition
+	for _, file := range pr.files {
+		position := filePosition{FileName: file.fileName, Packets: file.packets}
+		if file.isSeekable {
+			position.Offset = file.offset
+		}
+		if len(pr.files) > 1 {
+			position.Interfaces = append([]int(nil), file.interfaceIDs...)
+		}
+		positions = append(positions, position)
+	}
+	return positions
+}
+
+// PreviousPositions returns the positions before the last packet returned by Next, from which a new reader
+// seeks to that packet
+func (pr *packetReader) PreviousPositions() []filePosition {
+	positions := pr.Positions()
+	if pr.last == nil {
+		return positions
+	}
+
+	position := &positions[pr.last.position]
+	position.Packets--
+	if pr.last.isSeekable {
+		position.Offset -= pcapRecordHeaderLength + pr.last.lastLength
+	}
+	return positions
+}
+
+// Seek continues the reading of a new reader at the positions of a previous reader of the same files.
+// A plain PCAP file is read from the byte offset of its position, other files skip the packets before.
+func (pr *packetReader) Seek(positions []filePosition) error {
+	if len(positions) != len(pr.files) {
+		return fmt.Errorf("the position has %d files instead of %d", len(positions), len(pr.files))
+	}
+
+	for i, file := range pr.files {
+		position := positions[i]
+		if position.FileName != file.fileName {
+			return fmt.Errorf("the position is in %s instead of %s", position.FileName, file.fileName)
+		}
+		if file.packets > 0 || file.next != nil {
+			return fmt.Errorf("%s: the reader has already read packets", file.fileName)
+		}
+
+		file.interfaceIDs = position.Interfaces
+		for _, id := range file.interfaceIDs {
+			if id >= pr.interfaceCount {
+				pr.interfaceCount = id + 1
+			}
+		}
+
+		if !file.isSeekable || position.Offset < pcapHeaderLength {
+			if err := file.skip(position.Packets); err != nil {
+				return fmt.Errorf("%s: %v", file.fileName, err)
+			}
+			continue
+		}
+
+		data, err := openPcapFileAt(file.fileName, position.Offset)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.fileName, err)
+		}
+		file.data.Close()
+		file.data = data
+		file.packets = position.Packets
+		file.offset = position.Offset
+	}
+	return nil
+}
+
+// RecordedAzimuths returns the initial azimuths of the sources recorded by trim in the section comment
+// of a pcapng file, by source ID. They apply to a trimmed capture that is read alone.
+func (pr *packetReader) RecordedAzimuths() map[string]uint16 {
+	azimuths := make(map[string]uint16)
+	if len(pr.files) > 1 {
+		return azimuths
+	}
+	for _, file := range pr.files {
+		ng, ok := file.data.(*ngFile)
+		if !ok {
+			continue
+		}
+		for _, line := range strings.Split(ng.SectionInfo().Comment, "\n") {
+			var address string
+			var interfaceID int
+			var azimuth uint16
+			if n, _ := fmt.Sscanf(line, initialAzimuthComment+" %s %d %d", &address, &interfaceID, &azimuth); n == 3 {
+				azimuths[sourceID(address, interfaceID)] = azimuth
+			}
+		}
+	}
+	return azimuths
+}
+
+// LinkType returns the link layer of the packets, which must be the same in all files and interfaces
+func (pr *packetReader) LinkType() (layers.LinkType, error) {
+	if err := pr.readInterfaces(); err != nil {
+		return 0, err
+	}
+
+	var linkTypes []layers.LinkType
+	for _, file := range pr.files {
+		linkTypes = append(linkTypes, file.data.LinkTypes()...)
+	}
+	if len(linkTypes) == 0 {
+		return 0, fmt.Errorf("the capture has no interface")
+	}
+	for _, linkType := range linkTypes[1:] {
+		if linkType != linkTypes[0] {
+			return linkTypes[0], fmt.Errorf("the capture interfaces have different link types, %s and %s", linkTypes[0], linkType)
+		}
+	}
+	return linkTypes[0], nil
+}
+
+// readInterfaces reads ahead the first packet of the pcapng files, as their interfaces are read with their packets
+func (pr *packetReader) readInterfaces() error {
+	for _, file := range pr.files {
+		if len(file.data.LinkTypes()) > 0 || file.next != nil {
+			continue
+		}
+		packet, err := file.decode()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		file.next = packet
+	}
+	return nil
+}
+
+// SnapLen returns the maximum captured length of a packet
+func (pr *packetReader) SnapLen() uint32 {
+	pr.readInterfaces()
+
+	var snapLen uint32
+	for _, file := range pr.files {
+		if file.data.SnapLen() > snapLen {
+			snapLen = file.data.SnapLen()
+		}
+	}
+	return snapLen
+}
+
+func (pr *packetReader) Close() {
+	for _, file := range pr.files {
+		file.data.Close()
+	}
+}
+
+// count moves the position of the file past a packet
+func (cf *captureFile) count(ci gopacket.CaptureInfo) {
+	cf.packets++
+	cf.lastLength = int64(ci.CaptureLength)
+	cf.offset += pcapRecordHeaderLength + cf.lastLength
+}
+
+// interfaceKey returns the name, link type and occurrence of an interface of the file, a PCAP file has one unnamed interface
+func (cf *captureFile) interfaceKey(interfaceID int) interfaceKey {
+	keys := make([]interfaceKey, interfaceID+1)
+	linkTypes := cf.data.LinkTypes()
+	for i := range keys {
+		if i < len(linkTypes) {
+			keys[i].linkType = linkTypes[i]
+		}
+		if ng, ok := cf.data.(*ngFile); ok {
+			if intf, err := ng.Interface(i); err == nil {
+				keys[i].name = intf.Name
+			}
+		}
+		for _, previous := range keys[:i] {
+			if previous.name == keys[i].name && previous.linkType == keys[i].linkType {
+				keys[i].occurrence++
+			}
+		}
+	}
+	return keys[interfaceID]
+}
+
+// skip reads over the next packets of the file without decoding them
+func (cf *captureFile) skip(count int64) error {
+	for i := int64(0); i < count; i++ {
+		_, ci, err := cf.data.ZeroCopyReadPacketData()
+		if err != nil {
+			return cf.readError(err)
+		}
+		cf.count(ci)
+	}
+	return nil
+}
+
+// read returns the packet read ahead, or decodes the next one
+func (cf *captureFile) read() (gopacket.Packet, error) {
+	if cf.next != nil {
+		packet := cf.next
+		cf.next = nil
+		return packet, nil
+	}
+	return cf.decode()
+}
+
+// decode reads the next packet with the link type of its interface
+func (cf *captureFile) decode() (gopacket.Packet, error) {
+	data, ci, err := cf.data.ReadPacketData()
+	if err != nil {
+		return nil, cf.readError(err)
+	}
+
+	var linkType layers.LinkType
+	if linkTypes := cf.data.LinkTypes(); len(linkTypes) > 0 {
+		linkType = linkTypes[0]
+	}
+	if len(ci.AncillaryData) > 0 {
+		if interfaceLinkType, ok := ci.AncillaryData[0].(layers.LinkType); ok {
+			linkType = interfaceLinkType
+		}
+	}
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	metadata := packet.Metadata()
+	metadata.CaptureInfo = ci
+	metadata.Truncated = metadata.Truncated || ci.CaptureLength < ci.Length
+	return packet, nil
+}
+
+// readError returns the error of a packet read with the file name, or io.EOF at the end of the file.
+// A short last packet of a plain file is the end of an interrupted capture, a compressed file must be complete.
+func (cf *captureFile) readError(err error) error {
+	switch {
+	case err == io.EOF:
+		return io.EOF
+	case err == io.ErrUnexpectedEOF && !cf.isCompressed:
+		fmt.Fprintf(os.Stderr, "%s: the last packet is truncated\n", cf.fileName)
+		return io.EOF
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%s: the compressed capture is truncated", cf.fileName)
+	}
+	return fmt.Errorf("%s: %v", cf.fileName, err)
+}
+
+// captureQueue is a heap of files by the record time of their next packet, ties are taken in file order
+type captureQueue []*captureFile
+
+func (cq captureQueue) Len() int { return len(cq) }
+
+func (cq captureQueue) Less(i, j int) bool {
+	ti, tj := cq[i].next.Metadata().Timestamp, cq[j].next.Metadata().Timestamp
+	if ti.Equal(tj) {
+		return cq[i].position < cq[j].position
+	}
+	return ti.Before(tj)
+}
+
+func (cq captureQueue) Swap(i, j int) { cq[i], cq[j] = cq[j], cq[i] }
+
+func (cq *captureQueue) Push(x interface{}) { *cq = append(*cq, x.(*captureFile)) }
+
+func (cq *captureQueue) Pop() interface{} {
+	old := *cq
+	file := old[len(old)-1]
+	*cq = old[:len(old)-1]
+	return file
+}
+
+// ngFile reads a pcapng file, its packets carry the ID and link type of their interface
+type ngFile struct {
+	*pcapgo.NgReader
+	stream *captureStream
+}
+
+func (nf *ngFile) LinkTypes() []layers.LinkType {
+	var linkTypes []layers.LinkType
+	for i := 0; i < nf.NInterfaces(); i++ {
+		intf, _ := nf.Interface(i)
+		linkTypes = append(linkTypes, intf.LinkType)
+	}
+	return linkTypes
+}
+
+func (nf *ngFile) SnapLen() uint32 {
+	var snapLen uint32
+	for i := 0; i < nf.NInterfaces(); i++ {
+		intf, _ := nf.Interface(i)
+		if intf.SnapLength == 0 {
+			return maxSnapLen
+		}
+		if intf.SnapLength > snapLen {
+			snapLen = intf.SnapLength
+		}
+	}
+	return snapLen
+}
+
+func (nf *ngFile) Close() error {
+	return nf.stream.Close()
+}
@@ -0,0 +1,35 @@
+//go:build !purego
+// +build !purego
+
+package pcapdecoder
+
+import (
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// pcapFile reads a PCAP file with libpcap
+type pcapFile struct {
+	*pcap.Handle
+}
+
+func openPcapFile(fileName string) (packetDataSource, error) {
+	handle, err := pcap.OpenOffline(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &pcapFile{handle}, nil
+}
+
+func (pf *pcapFile) LinkTypes() []layers.LinkType {
+	return []layers.LinkType{pf.LinkType()}
+}
+
+func (pf *pcapFile) SnapLen() uint32 {
+	return uint32(pf.Handle.SnapLen())
+}
+
+func (pf *pcapFile) Close() error {
+	pf.Handle.Close()
+	return nil
+}
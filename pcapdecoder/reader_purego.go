@@ -0,0 +1,13 @@
+//go:build purego
+// +build purego
+
+package pcapdecoder
+
+// openPcapFile reads a PCAP file without libpcap, for static builds without cgo
+func openPcapFile(fileName string) (packetDataSource, error) {
+	stream, err := openCaptureStream(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return newPcapStream(stream)
+}
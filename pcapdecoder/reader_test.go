@@ -0,0 +1,287 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPacketReaderMergesByRecordTime(t *testing.T) {
+	folder := t.TempDir()
+	first := filepath.Join(folder, "first.pcap")
+	second := filepath.Join(folder, "second.pcap")
+
+	// the packets at the same time are read in the order of the files
+	writePcap(t, first, []testPacket{
+		{time: testStart, data: udpPacket(t, "10.0.0.1", 2368, []byte{1})},
+		{time: testStart.Add(2 * time.Second), data: udpPacket(t, "10.0.0.1", 2368, []byte{2})},
+		{time: testStart.Add(3 * time.Second), data: udpPacket(t, "10.0.0.1", 2368, []byte{3})}})
+	writePcap(t, second, []testPacket{
+		{time: testStart.Add(time.Second), data: udpPacket(t, "10.0.0.2", 2368, []byte{1})},
+		{time: testStart.Add(2 * time.Second), data: udpPacket(t, "10.0.0.2", 2368, []byte{2})},
+		{time: testStart.Add(4 * time.Second), data: udpPacket(t, "10.0.0.2", 2368, []byte{3})}})
+
+	expected := []string{"10.0.0.1", "10.0.0.2", "10.0.0.2", "10.0.0.1", "10.0.0.1", "10.0.0.2"}
+	packets := readPackets(t, second, first)
+	if len(packets) != len(expected) {
+		t.Fatalf("read %d packets, expected %d", len(packets), len(expected))
+	}
+	for i, packet := range packets {
+		if address := getIPv4(packet); address != expected[i] {
+			t.Errorf("packet %d is of %s, expected %s", i, address, expected[i])
+		}
+		if i > 0 && packet.Metadata().Timestamp.Before(packets[i-1].Metadata().Timestamp) {
+			t.Errorf("packet %d is before the previous packet", i)
+		}
+	}
+}
+
+func TestPacketReaderReadsPcapngInterfaces(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.pcapng")
+	ip := udpPacket(t, "10.0.0.1", 2368, []byte{1})[14:]
+	writePcapng(t, fileName,
+		[]pcapgo.NgInterface{
+			{Name: "eth0", LinkType: layers.LinkTypeEthernet, SnapLength: 65536},
+			{Name: "eth1", LinkType: layers.LinkTypeEthernet, SnapLength: 65536},
+			{Name: "raw0", LinkType: layers.LinkTypeRaw, SnapLength: 1500}},
+		[]testPacket{
+			{time: testStart, interfaceID: 0, data: udpPacket(t, "10.0.0.1", 2368, []byte{1})},
+			{time: testStart.Add(time.Millisecond), interfaceID: 1, data: udpPacket(t, "10.0.0.1", 2368, []byte{1})},
+			{time: testStart.Add(2 * time.Millisecond), interfaceID: 2, data: ip}})
+
+	expected := []string{"10.0.0.1", "10.0.0.1@1", "10.0.0.1@2"}
+	packets := readPackets(t, fileName)
+	if len(packets) != len(expected) {
+		t.Fatalf("read %d packets, expected %d", len(packets), len(expected))
+	}
+	for i, packet := range packets {
+		// the packet of the raw interface is decoded from its IP layer
+		if id := getSourceID(packet); id != expected[i] {
+			t.Errorf("packet %d is of %s, expected %s", i, id, expected[i])
+		}
+	}
+
+	reader, err := openPacketReader([]string{fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for {
+		if _, err := reader.Next(); err != nil {
+			break
+		}
+	}
+	if _, err := reader.LinkType(); err == nil {
+		t.Error("the link type of interfaces of different link types is not an error")
+	}
+	if snapLen := reader.SnapLen(); snapLen != 65536 {
+		t.Errorf("snap length is %d, expected 65536", snapLen)
+	}
+}
+
+func TestPacketReaderContinuesInterfaces(t *testing.T) {
+	folder := t.TempDir()
+	interfaces := []pcapgo.NgInterface{
+		{Name: "eth0", LinkType: layers.LinkTypeEthernet, SnapLength: 65536},
+		{Name: "eth1", LinkType: layers.LinkTypeEthernet, SnapLength: 65536}}
+	writeFile := func(name string, start time.Time) string {
+		fileName := filepath.Join(folder, name)
+		writePcapng(t, fileName, interfaces, []testPacket{
+			{time: start, interfaceID: 1, data: udpPacket(t, "10.0.0.2", 2368, []byte{1})},
+			{time: start.Add(time.Millisecond), interfaceID: 0, data: udpPacket(t, "10.0.0.1", 2368, []byte{1})}})
+		return fileName
+	}
+
+	tests := []struct {
+		name     string
+		starts   []time.Duration
+		expected []string
+	}{
+		// consecutive files continue the interfaces of the files before them
+		{"consecutive", []time.Duration{0, time.Second},
+			[]string{"10.0.0.2@1", "10.0.0.1", "10.0.0.2@1", "10.0.0.1"}},
+		// files of the same time are captures of other interfaces
+		{"parallel", []time.Duration{0, 0},
+			[]string{"10.0.0.2@1", "10.0.0.2@3", "10.0.0.1", "10.0.0.1@2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fileNames []string
+			for i, start := range test.starts {
+				fileNames = append(fileNames, writeFile(test.name+string(rune('a'+i))+".pcapng", testStart.Add(start)))
+			}
+
+			packets := readPackets(t, fileNames...)
+			if len(packets) != len(test.expected) {
+				t.Fatalf("read %d packets, expected %d", len(packets), len(test.expected))
+			}
+			for i, packet := range packets {
+				if id := getSourceID(packet); id != test.expected[i] {
+					t.Errorf("packet %d is of %s, expected %s", i, id, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenPcapFileReadsLikePureGo(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, lidarCapture(t, 20))
+
+	// the reader of the build, libpcap or pure Go with the purego tag, reads the packets of the pure Go reader
+	source, err := openPcapFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	stream, err := openCaptureStream(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := newPcapStream(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expected.Close()
+
+	for i := 0; ; i++ {
+		data, ci, err := source.ReadPacketData()
+		expectedData, expectedCI, expectedErr := expected.ReadPacketData()
+		if err != nil || expectedErr != nil {
+			if err != expectedErr {
+				t.Errorf("packet %d: read error %v, expected %v", i, err, expectedErr)
+			}
+			break
+		}
+		if !bytes.Equal(data, expectedData) || !ci.Timestamp.Equal(expectedCI.Timestamp) || ci.Length != expectedCI.Length {
+			t.Errorf("packet %d of %d bytes at %s differs from %d bytes at %s", i, len(data), ci.Timestamp, len(expectedData), expectedCI.Timestamp)
+		}
+	}
+
+	if !reflect.DeepEqual(source.LinkTypes(), expected.LinkTypes()) || source.SnapLen() != expected.SnapLen() {
+		t.Errorf("link types %v and snap length %d, expected %v and %d", source.LinkTypes(), source.SnapLen(), expected.LinkTypes(), expected.SnapLen())
+	}
+}
+
+// compressFile writes the file compressed with gzip, or with zstd when the compressed file ends with .zst
+func compressFile(t *testing.T, fileName string, compressedName string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var compressed bytes.Buffer
+	if strings.HasSuffix(compressedName, ".zst") {
+		compressed.Write(zstdFrame(data))
+	} else {
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(data)
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(compressedName, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// zstdFrame returns a zstd frame of the data in raw blocks of at most 128kB, a single segment with its content size
+func zstdFrame(data []byte) []byte {
+	frame := append([]byte(nil), zstdMagic...)
+	frame = append(frame, 0xA0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(frame[5:], uint32(len(data)))
+	for offset := 0; offset == 0 || offset < len(data); {
+		size := len(data) - offset
+		if size > 128<<10 {
+			size = 128 << 10
+		}
+		header := uint32(size) << 3
+		if offset+size == len(data) {
+			header |= 1
+		}
+		frame = append(frame, byte(header), byte(header>>8), byte(header>>16))
+		frame = append(frame, data[offset:offset+size]...)
+		offset += size
+	}
+	return frame
+}
+
+func TestPacketReaderDecompressesCaptures(t *testing.T) {
+	folder := t.TempDir()
+	packets := lidarCapture(t, 20)
+	plain := map[string]string{
+		"pcap":   filepath.Join(folder, "capture.pcap"),
+		"pcapng": filepath.Join(folder, "capture.pcapng")}
+	writePcap(t, plain["pcap"], packets)
+	writePcapng(t, plain["pcapng"], []pcapgo.NgInterface{{Name: "eth0", LinkType: layers.LinkTypeEthernet, SnapLength: 65536}}, packets)
+
+	for format, fileName := range plain {
+		expected := readPackets(t, fileName)
+		// the compression is detected by the content, whatever the extension
+		for _, compressedName := range []string{fileName + ".gz", fileName + ".zst", fileName + "-gzip"} {
+			compressFile(t, fileName, compressedName)
+			read := readPackets(t, compressedName)
+			if len(read) != len(expected) {
+				t.Fatalf("%s: read %d packets of %s, expected %d", format, len(read), filepath.Base(compressedName), len(expected))
+			}
+			for i, packet := range read {
+				if !bytes.Equal(packet.Data(), expected[i].Data()) || !packet.Metadata().Timestamp.Equal(expected[i].Metadata().Timestamp) {
+					t.Errorf("%s: packet %d of %s differs from the plain capture", format, i, filepath.Base(compressedName))
+				}
+			}
+		}
+	}
+}
+
+func TestPacketReaderFailsOnTruncatedCompressedCapture(t *testing.T) {
+	folder := t.TempDir()
+	fileName := filepath.Join(folder, "capture.pcap")
+	writePcap(t, fileName, lidarPackets(t, "10.0.0.1", testStart, 100))
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a truncated plain file ends at its last complete packet
+	truncated := filepath.Join(folder, "truncated.pcap")
+	if err := ioutil.WriteFile(truncated, data[:len(data)-100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if packets := readPackets(t, truncated); len(packets) != 99 {
+		t.Errorf("read %d packets of the truncated file, expected 99", len(packets))
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(data)
+	writer.Close()
+	truncated = filepath.Join(folder, "truncated.pcap.gz")
+	if err := ioutil.WriteFile(truncated, compressed.Bytes()[:compressed.Len()/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := openPacketReader([]string{truncated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for {
+		_, err := reader.Next()
+		if err == io.EOF {
+			t.Fatal("the truncated compressed file ends without an error")
+		}
+		if err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+)
+
+// NewFrameRenderer returns the frame handler of the render mode
+func NewFrameRenderer(options global.RenderInput) (FrameHandler, error) {
+	switch options.Mode {
+	case "bev":
+		renderer, err := NewBEVRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.SaveFrame, nil
+	case "range":
+		renderer, err := NewRangeRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.SaveFrame, nil
+	case "elevation":
+		renderer, err := NewElevationRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.SaveFrame, nil
+	case "perspective":
+		renderer, err := NewPerspectiveRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.SaveFrame, nil
+	case "camera":
+		renderer, err := NewCameraRenderer(options)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.SaveFrame, nil
+	}
+
+	return nil, fmt.Errorf("render mode %q is not supported", options.Mode)
+}
@@ -0,0 +1,187 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// replaySource sends the payloads of one captured source
+type replaySource struct {
+	conn            *net.UDPConn
+	dataPackets     uint
+	positionPackets uint
+}
+
+// replayer sends the lidar and position payloads of a capture to the UDP destination of the user input
+type replayer struct {
+	host    net.IP
+	sources map[string]*replaySource
+	// the wall clock and capture time of the first packet of the current pass
+	wallStart    time.Time
+	captureStart time.Time
+}
+
+// ReplayPCAP sends the lidar and position payloads of the input PCAP files to UDP ports,
+// at the recorded timing divided by the speed, until the end of the file or an interrupt
+func ReplayPCAP() error {
+	ui := &global.UserInput
+
+	addresses, err := net.LookupIP(ui.Destination)
+	if err != nil {
+		return err
+	}
+	// the captured sources are IPv4
+	host := addresses[0]
+	for _, address := range addresses {
+		if address.To4() != nil {
+			host = address
+			break
+		}
+	}
+	r := &replayer{host: host, sources: make(map[string]*replaySource)}
+	defer r.close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	for pass := 0; pass == 0 || ui.IsLoop; pass++ {
+		stopped, err := r.replay(ui.PcapFiles.Value(), interrupt)
+		if err != nil {
+			return err
+		}
+		if stopped || len(r.sources) == 0 {
+			break
+		}
+	}
+
+	r.report()
+	return nil
+}
+
+// replay sends the packets of one pass over the files, it returns true when interrupted
+func (r *replayer) replay(fileNames []string, interrupt chan os.Signal) (bool, error) {
+	reader, err := openPacketReader(fileNames)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	ui := &global.UserInput
+	r.captureStart = time.Time{}
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		payload := getPayload(packet)
+		var port int
+		switch len(payload) {
+		case lidarPayloadLength:
+			port = ui.DataPort
+		case positionPayloadLength:
+			port = ui.PositionPort
+		default:
+			continue
+		}
+
+		address := getIPv4(packet)
+		if port == 0 || !ui.IsWhitelisted(address) {
+			continue
+		}
+
+		// wait until the packet is due
+		recordTime := packet.Metadata().Timestamp
+		if r.captureStart.IsZero() {
+			r.captureStart = recordTime
+			r.wallStart = time.Now()
+		}
+		delay := time.Duration(float64(recordTime.Sub(r.captureStart))/ui.Speed) - time.Since(r.wallStart)
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-interrupt:
+				timer.Stop()
+				return true, nil
+			}
+		}
+		select {
+		case <-interrupt:
+			return true, nil
+		default:
+		}
+
+		source, err := r.getSource(address)
+		if err != nil {
+			return false, err
+		}
+		if _, err := source.conn.WriteToUDP(payload, &net.UDPAddr{IP: r.host, Port: port}); err != nil {
+			return false, err
+		}
+		if len(payload) == lidarPayloadLength {
+			source.dataPackets++
+		} else {
+			source.positionPackets++
+		}
+	}
+}
+
+// getSource returns the socket of the captured source. On a loopback destination the socket is bound to
+// 127.x.y.z of the last three bytes of the source address, so that the receiver can tell the sources apart.
+func (r *replayer) getSource(address string) (*replaySource, error) {
+	if source, ok := r.sources[address]; ok {
+		return source, nil
+	}
+
+	var conn *net.UDPConn
+	var err error
+	if ip := net.ParseIP(address).To4(); ip != nil && r.host.IsLoopback() {
+		alias := net.IPv4(127, ip[1], ip[2], ip[3])
+		if conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: alias}); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: can not send from %s, the sources will share one address: %v\n", address, alias, err)
+		}
+	}
+	if conn == nil {
+		if conn, err = net.ListenUDP("udp", nil); err != nil {
+			return nil, err
+		}
+	}
+
+	source := &replaySource{conn: conn}
+	r.sources[address] = source
+	fmt.Fprintf(os.Stderr, "%s: sending from %s\n", address, conn.LocalAddr())
+	return source, nil
+}
+
+// report prints the number of sent packets of each source
+func (r *replayer) report() {
+	var addresses []string
+	for address := range r.sources {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		source := r.sources[address]
+		fmt.Fprintf(os.Stderr, "%s: %d lidar packets, %d position packets\n", address, source.dataPackets, source.positionPackets)
+	}
+}
+
+func (r *replayer) close() {
+	for _, source := range r.sources {
+		source.conn.Close()
+	}
+}
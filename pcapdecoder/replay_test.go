@@ -0,0 +1,80 @@
+package pcapdecoder
+
+import (
+	"bytes"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/google/gopacket/layers"
+	"github.com/urfave/cli"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// receive returns the payloads received by the socket until it is idle
+func receive(t *testing.T, conn *net.UDPConn) [][]byte {
+	t.Helper()
+	var payloads [][]byte
+	buffer := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return payloads
+		}
+		payloads = append(payloads, append([]byte(nil), buffer[:n]...))
+	}
+}
+
+func TestReplayPCAPSendsPayloads(t *testing.T) {
+	keepUserInput(t)
+	var dataConns []*net.UDPConn
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		dataConns = append(dataConns, conn)
+	}
+
+	// the lidar packets are tagged with a VLAN, so that their payload does not start after 42 bytes
+	var packets []testPacket
+	var lidarPayloads [][]byte
+	for _, packet := range lidarPackets(t, "10.0.0.1", testStart, 20) {
+		payload := payloadOf(packet.data)
+		lidarPayloads = append(lidarPayloads, payload)
+		packets = append(packets, testPacket{time: packet.time, data: linkPacket(t, layers.LinkTypeEthernet, "10.0.0.1", payload)})
+	}
+	position := positionPacket(t, "10.0.0.1", ppsLocked, testStart)
+	packets = append(packets, testPacket{time: testStart.Add(5 * time.Millisecond), data: position})
+	sortPackets(packets)
+
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	writePcap(t, fileName, packets)
+
+	ui := &global.UserInput
+	ui.PcapFiles = *cli.NewStringSlice(fileName)
+	ui.Channels = cli.StringSlice{}
+	ui.Destination = "127.0.0.1"
+	ui.DataPort = dataConns[0].LocalAddr().(*net.UDPAddr).Port
+	ui.PositionPort = dataConns[1].LocalAddr().(*net.UDPAddr).Port
+	ui.Speed = 10
+	ui.IsLoop = false
+	if err := ReplayPCAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := receive(t, dataConns[0])
+	if len(received) != len(lidarPayloads) {
+		t.Fatalf("received %d lidar payloads, expected %d", len(received), len(lidarPayloads))
+	}
+	for i, payload := range received {
+		if !bytes.Equal(payload, lidarPayloads[i]) {
+			t.Errorf("lidar payload %d differs from the captured payload", i)
+		}
+	}
+	if received := receive(t, dataConns[1]); len(received) != 1 || !bytes.Equal(received[0], payloadOf(position)) {
+		t.Errorf("received %d position payloads, expected the captured payload", len(received))
+	}
+}
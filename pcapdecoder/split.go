@@ -0,0 +1,142 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/bldulam1/pcap-decoder/registry"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// otherTraffic names the captures of the packets that are not from a selected lidar source
+const otherTraffic = "other"
+
+// SplitPCAP writes the lidar and position packets of each selected lidar source of the input PCAP files into its own capture,
+// and all other packets into one more capture per capture interface. With a part duration, a new capture is started every part.
+func SplitPCAP() error {
+	ui := &global.UserInput
+
+	reader, err := openPacketReader(ui.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	linkType, err := reader.LinkType()
+	if err != nil {
+		return err
+	}
+
+	// the captures are named by the first input file
+	base := getCaptureName(ui.PcapFiles.Value()[0])
+	partDuration := time.Duration(ui.SplitMinutes * float64(time.Minute))
+
+	writers := make(map[string]*CaptureWriter)
+	parts := make(map[string]int)
+	var written []*CaptureWriter
+	defer func() {
+		for _, writer := range writers {
+			writer.Close()
+		}
+	}()
+
+	var captureStart time.Time
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		recordTime := packet.Metadata().Timestamp
+		if captureStart.IsZero() {
+			captureStart = recordTime
+		}
+
+		// lidar sources are identified by the source address of their packets,
+		// the packets of the sources that are not selected are other traffic
+		interfaceID := packet.Metadata().InterfaceIndex
+		name := sourceID(otherTraffic, interfaceID)
+		if length := len(getPayload(packet)); length == lidarPayloadLength || length == positionPayloadLength {
+			if address := getIPv4(packet); ui.IsWhitelisted(address) {
+				name = sourceID(getSourceName(address), interfaceID)
+			}
+		}
+
+		part := 0
+		if partDuration > 0 {
+			part = int(recordTime.Sub(captureStart) / partDuration)
+		}
+
+		writer, ok := writers[name]
+		if ok && part < parts[name] {
+			// a packet recorded out of order stays in the current part
+			part = parts[name]
+		}
+		if ok && parts[name] != part {
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			delete(writers, name)
+			ok = false
+		}
+		if !ok {
+			fileName := fmt.Sprintf("%s-%s.%s", base, name, ui.PcapFormat)
+			if partDuration > 0 {
+				fileName = fmt.Sprintf("%s-%s-%03d.%s", base, name, part, ui.PcapFormat)
+			}
+			if writer, err = NewCaptureWriter(filepath.Join(ui.OutputPath, fileName), linkType, reader.SnapLen(), ""); err != nil {
+				return err
+			}
+			writers[name] = writer
+			parts[name] = part
+			written = append(written, writer)
+		}
+
+		if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+			return err
+		}
+	}
+
+	for name, writer := range writers {
+		delete(writers, name)
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(written, func(i, j int) bool { return written[i].FileName < written[j].FileName })
+	for _, writer := range written {
+		fmt.Fprintf(os.Stderr, "%s: %d packets\n", writer.FileName, writer.PacketCount)
+	}
+	return nil
+}
+
+// getCaptureName returns the file name of the capture without its compression and capture extensions
+func getCaptureName(fileName string) string {
+	if fileName == StdinFile {
+		return "stdin"
+	}
+
+	name := filepath.Base(fileName)
+	for _, extension := range []string{".gz", ".zst"} {
+		if strings.HasSuffix(strings.ToLower(name), extension) {
+			name = name[:len(name)-len(extension)]
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// getSourceName returns the calibrated name of the lidar, or its IP address
+func getSourceName(address string) string {
+	if calib, err := registry.GetLidar(address); err == nil && len(calib.Name) > 0 {
+		return calib.Name
+	}
+	return address
+}
@@ -0,0 +1,57 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/urfave/cli"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitPCAPKeepsOtherTrafficByInterface(t *testing.T) {
+	keepUserInput(t)
+	keepVehicle(t)
+
+	var packets []testPacket
+	for interfaceID := 0; interfaceID < 2; interfaceID++ {
+		for _, packet := range lidarPackets(t, "10.0.0.1", testStart, 5) {
+			packet.interfaceID = interfaceID
+			packets = append(packets, packet)
+		}
+	}
+	// the packets of an unselected source and the unknown traffic are other packets of their interface
+	packets = append(packets, lidarPackets(t, "10.0.0.2", testStart, 3)...)
+	packets = append(packets,
+		testPacket{time: testStart.Add(time.Millisecond), data: positionPacket(t, "10.0.0.2", ppsLocked, testStart)},
+		testPacket{time: testStart.Add(2 * time.Millisecond), interfaceID: 1, data: udpPacket(t, "10.0.0.3", 5000, make([]byte, 100))})
+	sortPackets(packets)
+
+	folder := t.TempDir()
+	fileName := filepath.Join(folder, "capture.pcapng")
+	writePcapng(t, fileName, []pcapgo.NgInterface{
+		{Name: "eth0", LinkType: layers.LinkTypeEthernet, SnapLength: 65536},
+		{Name: "eth1", LinkType: layers.LinkTypeEthernet, SnapLength: 65536}}, packets)
+
+	ui := &global.UserInput
+	ui.PcapFiles = *cli.NewStringSlice(fileName)
+	ui.Channels = *cli.NewStringSlice("10.0.0.1")
+	ui.OutputPath = folder
+	ui.SplitMinutes = 0
+	ui.PcapFormat = "pcap"
+	if err := SplitPCAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]int{
+		"10.0.0.1":   5,
+		"10.0.0.1@1": 5,
+		"other":      4,
+		"other@1":    1,
+	} {
+		if count := len(readPackets(t, filepath.Join(folder, "capture-"+name+".pcap"))); count != expected {
+			t.Errorf("%s has %d packets, expected %d", name, count, expected)
+		}
+	}
+}
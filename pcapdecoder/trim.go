@@ -0,0 +1,223 @@
+package pcapdecoder
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// timeSpan is an inclusive range of packet record times, an open end is zero
+type timeSpan struct {
+	start time.Time
+	end   time.Time
+}
+
+func (ts timeSpan) contains(t time.Time) bool {
+	return !t.Before(ts.start) && (ts.end.IsZero() || !t.After(ts.end))
+}
+
+// initialAzimuthComment starts the lines of the pcapng section comment of a trimmed capture that record
+// the address, capture interface and initial azimuth of a lidar source
+const initialAzimuthComment = "initialAzimuth"
+
+// TrimPCAP writes the packets of the selected frames of the input PCAP file into the output file.
+// The frames are selected by the frame range, or by the time range when one is given. The position packets
+// of the selected sources and the camera packets are kept within the time of the selected frames.
+// A pcapng output records the initial azimuths of the sources, so that its frames are cut like the selected frames.
+func TrimPCAP() error {
+	ui := &global.UserInput
+
+	index, err := IndexPCAP(ui.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+
+	spans, err := getTrimSpans(index)
+	if err != nil {
+		return err
+	}
+	if len(spans) == 0 {
+		return fmt.Errorf("no frame is selected")
+	}
+
+	// the camera packets and the position packets of other sources are kept within all selected frames
+	var all timeSpan
+	isOpenEnd := false
+	for _, span := range spans {
+		if all.start.IsZero() || span.start.Before(all.start) {
+			all.start = span.start
+		}
+		if span.end.IsZero() {
+			isOpenEnd = true
+		} else if span.end.After(all.end) {
+			all.end = span.end
+		}
+	}
+	if isOpenEnd {
+		all.end = time.Time{}
+	}
+
+	reader, err := openPacketReader(ui.PcapFiles.Value())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	linkType, err := reader.LinkType()
+	if err != nil {
+		return err
+	}
+	// the first packet of a source is usually within the frame before the selected ones
+	var comment []string
+	isCut := false
+	for _, source := range index.Sources {
+		if span, ok := spans[source.ID]; ok {
+			comment = append(comment, fmt.Sprintf("%s %s %d %d", initialAzimuthComment, source.Address, source.Interface, source.initialAzimuth))
+			isCut = isCut || span.start.After(source.Frames[0].Time)
+		}
+	}
+	if isCut && !isPcapngFile(ui.OutputFile) {
+		fmt.Fprintf(os.Stderr, "%s: a pcap file does not record the initial azimuths, its frames are cut at the first packet of each source. Write a .pcapng file to keep the selected frames.\n", ui.OutputFile)
+	}
+
+	writer, err := NewCaptureWriter(ui.OutputFile, linkType, reader.SnapLen(), strings.Join(comment, "\n"))
+	if err != nil {
+		return err
+	}
+
+	// the decoder completes a frame with the packet after the one that starts the next frame
+	isTailWritten := make(map[string]bool)
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+
+		recordTime := packet.Metadata().Timestamp
+
+		var keep bool
+		switch len(getPayload(packet)) {
+		case lidarPayloadLength:
+			id := getSourceID(packet)
+			span, ok := spans[id]
+			keep = ok && span.contains(recordTime)
+			if ok && !keep && recordTime.After(span.end) && !isTailWritten[id] {
+				keep = true
+				isTailWritten[id] = true
+			}
+		case positionPayloadLength:
+			if span, ok := spans[getSourceID(packet)]; ok {
+				keep = span.contains(recordTime)
+			} else {
+				keep = ui.IsWhitelisted(getIPv4(packet)) && all.contains(recordTime)
+			}
+		case cameraPayloadLength:
+			keep = ui.IsCameraWhitelisted(getIPv4(packet)) && all.contains(recordTime)
+		}
+		if !keep {
+			continue
+		}
+
+		if err := writer.WritePacket(packet.Metadata().CaptureInfo, packet.Data()); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d packets\n", writer.FileName, writer.PacketCount)
+	return nil
+}
+
+// getTrimSpans returns the time span of the selected frames of each lidar source by its ID.
+// A frame starts with the packet that crosses the initial azimuth, and ends with the packet that starts the next frame.
+func getTrimSpans(index *CaptureIndex) (map[string]timeSpan, error) {
+	ui := &global.UserInput
+
+	startTime, endTime, err := getTrimTimes(index)
+	if err != nil {
+		return nil, err
+	}
+	isTimeRange := !startTime.IsZero() || !endTime.IsZero()
+
+	spans := make(map[string]timeSpan)
+	for _, source := range index.Sources {
+		first, last := -1, -1
+		for position, frame := range source.Frames {
+			var selected bool
+			if isTimeRange {
+				selected = !frame.Time.Before(startTime) && (endTime.IsZero() || !frame.Time.After(endTime))
+			} else {
+				selected = int(frame.Index) >= ui.StartFrame && (ui.EndFrame < 0 || int(frame.Index) <= ui.EndFrame)
+			}
+			if !selected {
+				continue
+			}
+			if first < 0 {
+				first = position
+			}
+			last = position
+		}
+		if first < 0 {
+			continue
+		}
+
+		span := timeSpan{start: source.Frames[first].Time}
+		if last+1 < len(source.Frames) {
+			span.end = source.Frames[last+1].Time
+		}
+		spans[source.ID] = span
+		fmt.Fprintf(os.Stderr, "%s: frames %d to %d\n", source.Name, source.Frames[first].Index, source.Frames[last].Index)
+	}
+	return spans, nil
+}
+
+// getTrimTimes parses the time range of the user input, as RFC 3339 times or as durations from the first lidar frame
+func getTrimTimes(index *CaptureIndex) (time.Time, time.Time, error) {
+	ui := &global.UserInput
+
+	var captureStart time.Time
+	for _, source := range index.Sources {
+		if len(source.Frames) > 0 && (captureStart.IsZero() || source.Frames[0].Time.Before(captureStart)) {
+			captureStart = source.Frames[0].Time
+		}
+	}
+
+	startTime, err := ParseTime(ui.StartTime, captureStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endTime, err := ParseTime(ui.EndTime, captureStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !startTime.IsZero() && !endTime.IsZero() && endTime.Before(startTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end time must not be before the start time")
+	}
+	return startTime, endTime, nil
+}
+
+// ParseTime parses an RFC 3339 time, or a duration from the capture start. An empty value is the zero time.
+func ParseTime(value string, captureStart time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	offset, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use an RFC 3339 time or a duration like 1m30s", value)
+	}
+	return captureStart.Add(offset), nil
+}
@@ -0,0 +1,114 @@
+package pcapdecoder
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"github.com/urfave/cli"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeSpanContains(t *testing.T) {
+	span := timeSpan{start: testStart, end: testStart.Add(time.Second)}
+	openSpan := timeSpan{start: testStart}
+
+	tests := []struct {
+		span     timeSpan
+		t        time.Time
+		expected bool
+	}{
+		{span, testStart.Add(-time.Nanosecond), false},
+		{span, testStart, true},
+		{span, testStart.Add(time.Second), true},
+		{span, testStart.Add(time.Second + time.Nanosecond), false},
+		{openSpan, testStart.Add(-time.Nanosecond), false},
+		{openSpan, testStart.Add(time.Hour), true},
+	}
+	for _, test := range tests {
+		if contains := test.span.contains(test.t); contains != test.expected {
+			t.Errorf("%v contains %s is %t, expected %t", test.span, test.t, contains, test.expected)
+		}
+	}
+}
+
+func TestGetTrimSpans(t *testing.T) {
+	keepUserInput(t)
+
+	source := &SourceIndex{ID: "10.0.0.1", Address: "10.0.0.1", Name: "10.0.0.1"}
+	for i := 0; i < 5; i++ {
+		source.Frames = append(source.Frames, FrameInfo{Index: uint(i), Time: testStart.Add(time.Duration(i) * 100 * time.Millisecond)})
+	}
+	index := &CaptureIndex{Sources: []*SourceIndex{source}}
+	frameTime := func(i int) time.Time { return source.Frames[i].Time }
+
+	tests := []struct {
+		name                 string
+		startFrame, endFrame int
+		startTime, endTime   string
+		expected             timeSpan
+	}{
+		// a span ends with the start of the frame after the selected ones
+		{"frames", 1, 2, "", "", timeSpan{frameTime(1), frameTime(3)}},
+		{"last frames", 3, -1, "", "", timeSpan{start: frameTime(3)}},
+		{"duration", 0, -1, "150ms", "300ms", timeSpan{frameTime(2), frameTime(4)}},
+		{"time", 0, -1, frameTime(1).Format(time.RFC3339Nano), "", timeSpan{start: frameTime(1)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			global.UserInput.StartFrame = test.startFrame
+			global.UserInput.EndFrame = test.endFrame
+			global.UserInput.StartTime = test.startTime
+			global.UserInput.EndTime = test.endTime
+
+			spans, err := getTrimSpans(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if span := spans[source.ID]; span != test.expected {
+				t.Errorf("span is %v, expected %v", span, test.expected)
+			}
+		})
+	}
+
+	global.UserInput.StartFrame = 5
+	global.UserInput.EndFrame = -1
+	global.UserInput.StartTime = ""
+	global.UserInput.EndTime = ""
+	if spans, err := getTrimSpans(index); err != nil || len(spans) != 0 {
+		t.Errorf("frames after the last frame are selected: %v, %v", spans, err)
+	}
+}
+
+func TestTrimPCAPKeepsSelectedFrames(t *testing.T) {
+	keepUserInput(t)
+
+	folder := t.TempDir()
+	fileName := filepath.Join(folder, "capture.pcap")
+	writePcap(t, fileName, lidarCapture(t, 400))
+	expected := decodeFrames(t, fileName)
+
+	ui := &global.UserInput
+	ui.PcapFiles = *cli.NewStringSlice(fileName)
+	ui.OutputFile = filepath.Join(folder, "slice.pcapng")
+	ui.StartFrame = 1
+	ui.EndFrame = 2
+	if err := TrimPCAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the frames of the trimmed capture are renumbered from 0
+	trimmed := decodeFrames(t, ui.OutputFile)
+	for _, id := range []string{"10.0.0.1", "10.0.0.2"} {
+		frames := trimmed[id]
+		if len(frames) != 2 {
+			t.Fatalf("%s: trimmed capture has %d frames, expected 2", id, len(frames))
+		}
+		for i, frame := range frames {
+			original := expected[id][i+1]
+			if frame.Index != uint(i) || !frame.Time.Equal(original.Time) || !reflect.DeepEqual(frame.Points, original.Points) {
+				t.Errorf("%s: frame %d of the trimmed capture differs from frame %d", id, frame.Index, original.Index)
+			}
+		}
+	}
+}
@@ -2,8 +2,13 @@ package pcapdecoder
 
 import (
 	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
 	"math"
+	"os"
 	"pcap-decoder/dictionary"
+	"sort"
 )
 
 func check(err error) {
@@ -12,16 +17,83 @@ func check(err error) {
 	}
 }
 
-func isDualMode(packetData *[]byte) bool {
-	return (*packetData)[1246] == 0x57
+// Return modes of the factory bytes
+const (
+	strongestReturn = 0x37
+	lastReturn      = 0x38
+	dualReturn      = 0x39
+)
+
+func getReturnMode(payload *[]byte) byte {
+	return (*payload)[1204]
+}
+
+func isDualMode(payload *[]byte) bool {
+	return getReturnMode(payload) == dualReturn
+}
+
+// getReturnModeName returns the readable name of the return mode
+func getReturnModeName(returnMode byte) string {
+	switch returnMode {
+	case strongestReturn:
+		return "Strongest"
+	case lastReturn:
+		return "Last"
+	case dualReturn:
+		return "Dual"
+	}
+	return fmt.Sprintf("Unknown (0x%x)", returnMode)
+}
+
+// getModelName returns the lidar model of the product ID
+func getModelName(productID byte) string {
+	switch productID {
+	case 0x21:
+		return "HDL32E"
+	case 0x22:
+		return "VLP16"
+	case 0x24:
+		return "VLP16 Hi-Res"
+	case 0x28:
+		return "VLP32"
+	case 0xA1:
+		return "VLS128"
+	}
+	return fmt.Sprintf("Unknown (0x%x)", productID)
+}
+
+// isSupportedModel checks if the points of the product ID can be located, by its elevation angles and firing times
+func isSupportedModel(productID byte) bool {
+	return productID == 0x22 || productID == 0x28
+}
+
+// getPacketInterval returns the expected time between two lidar packets in microseconds
+func getPacketInterval(productID byte, returnMode byte) float64 {
+	// one firing sequence takes 55.296 µs
+	interval := 12 * 55.296
+	if productID == 0x22 {
+		// VLP16 fires twice per block
+		interval *= 2
+	}
+	if returnMode == dualReturn {
+		// two blocks share the same firing sequence
+		interval /= 2
+	}
+	return interval
+}
+
+// getTimeGap returns the microseconds between two lidar timestamps, which roll over every hour
+func getTimeGap(currTime uint32, nextTime uint32) uint32 {
+	const hour = 3600000000
+	return (nextTime + hour - currTime) % hour
 }
 
-func getProductID(packetData *[]byte) byte {
-	return (*packetData)[1247]
+func getProductID(payload *[]byte) byte {
+	return (*payload)[1205]
 }
 
-func getTime(packetData *[]byte) uint32 {
-	return binary.LittleEndian.Uint32((*packetData)[1242:1246])
+func getTime(payload *[]byte) uint32 {
+	return binary.LittleEndian.Uint32((*payload)[1200:1204])
 }
 
 func getAzimuthGap(currAzimuth uint16, nextAzimuth uint16) uint16 {
@@ -31,6 +103,48 @@ func getAzimuthGap(currAzimuth uint16, nextAzimuth uint16) uint16 {
 	return nextAzimuth - currAzimuth
 }
 
+// ringIndexes maps the row index of each product ID to its rank by elevation angle
+var ringIndexes = map[byte][]int{
+	0x22: getRingIndexes(0x22, 16),
+	0x28: getRingIndexes(0x28, 32),
+}
+
+func getRingIndexes(productID byte, rings int) []int {
+	rowIndexes := make([]int, rings)
+	for i := range rowIndexes {
+		rowIndexes[i] = i
+	}
+	sort.Slice(rowIndexes, func(i, j int) bool {
+		return getRawElevationAngle(productID, uint8(rowIndexes[i])) < getRawElevationAngle(productID, uint8(rowIndexes[j]))
+	})
+
+	indexes := make([]int, rings)
+	for ring, rowIndex := range rowIndexes {
+		indexes[rowIndex] = ring
+	}
+	return indexes
+}
+
+// getRingIndex returns the ring of the row index, counted from the lowest elevation angle, and the number of rings
+func getRingIndex(productID byte, rowIndex uint8) (int, int) {
+	indexes, ok := ringIndexes[productID]
+	if !ok {
+		return int(rowIndex), 32
+	}
+	return indexes[int(rowIndex)%len(indexes)], len(indexes)
+}
+
+// savePNG writes the image into a PNG file
+func savePNG(fileName string, img image.Image) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
 // returns the elevation angle in degrees
 func getRawElevationAngle(productID byte, rowIndex uint8) int16 {
 	var elevAngle int16
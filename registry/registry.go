@@ -0,0 +1,233 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+	"sort"
+	"strings"
+)
+
+// Current is the calibration of the vehicle that recorded the PCAP file.
+// It is nil when no vehicle or sensor is configured.
+var Current *Vehicle
+
+// Registry contains the sensor calibrations of all vehicles
+type Registry struct {
+	Vehicles []Vehicle `json:"vehicles" yaml:"vehicles" toml:"vehicles"`
+}
+
+// Vehicle contains the calibration of all sensors of a vehicle
+type Vehicle struct {
+	ID      string        `json:"id" yaml:"id" toml:"id"`
+	Lidars  []LidarCalib  `json:"lidars" yaml:"lidars" toml:"lidars"`
+	Cameras []CameraCalib `json:"cameras" yaml:"cameras" toml:"cameras"`
+}
+
+// LidarCalib contains the calibration of a lidar
+type LidarCalib struct {
+	Name       string            `json:"name" yaml:"name" toml:"name"`
+	IP         string            `json:"ip" yaml:"ip" toml:"ip"`
+	Model      string            `json:"model" yaml:"model" toml:"model"`
+	Extrinsics global.Extrinsics `json:"extrinsics" yaml:"extrinsics" toml:"extrinsics"`
+}
+
+// CameraCalib contains the calibration of a camera. Azimuths are in degrees.
+// The IP address is only needed to name the images of the camera packets.
+// The extrinsics are the camera pose in the vehicle coordinates, looking along +Y when the rotation is 0.
+type CameraCalib struct {
+	Name         string            `json:"name" yaml:"name" toml:"name"`
+	IP           string            `json:"ip" yaml:"ip" toml:"ip"`
+	AzimuthStart float64           `json:"azimuthStart" yaml:"azimuthStart" toml:"azimuthStart"`
+	AzimuthEnd   float64           `json:"azimuthEnd" yaml:"azimuthEnd" toml:"azimuthEnd"`
+	Intrinsics   CameraIntrinsics  `json:"intrinsics" yaml:"intrinsics" toml:"intrinsics"`
+	Extrinsics   global.Extrinsics `json:"extrinsics" yaml:"extrinsics" toml:"extrinsics"`
+}
+
+// CameraIntrinsics is the pinhole model of a camera in pixels, with the distortion coefficients of the model.
+// "radtan" uses k1, k2, p1, p2, k3 and "fisheye" uses the equidistant k1, k2, k3, k4.
+type CameraIntrinsics struct {
+	Model      string    `json:"model" yaml:"model" toml:"model"`
+	Width      int       `json:"width" yaml:"width" toml:"width"`
+	Height     int       `json:"height" yaml:"height" toml:"height"`
+	Fx         float64   `json:"fx" yaml:"fx" toml:"fx"`
+	Fy         float64   `json:"fy" yaml:"fy" toml:"fy"`
+	Cx         float64   `json:"cx" yaml:"cx" toml:"cx"`
+	Cy         float64   `json:"cy" yaml:"cy" toml:"cy"`
+	Distortion []float64 `json:"distortion" yaml:"distortion" toml:"distortion"`
+}
+
+// HasIntrinsics checks if the camera can project points
+func (cc CameraCalib) HasIntrinsics() bool {
+	return cc.Intrinsics.Fx > 0 && cc.Intrinsics.Fy > 0 && cc.Intrinsics.Width > 0 && cc.Intrinsics.Height > 0
+}
+
+// AzimuthRange returns the start and end azimuth of the camera in 100x degrees
+func (cc CameraCalib) AzimuthRange() []int {
+	return []int{int(cc.AzimuthStart * 100), int(cc.AzimuthEnd * 100)}
+}
+
+var lidarModels = map[string]bool{"": true, "VLP16": true, "VLP32": true}
+
+// distortionModels maps the camera models to their number of distortion coefficients
+var distortionModels = map[string]int{"": 0, "pinhole": 0, "radtan": 5, "fisheye": 4}
+
+// Load reads and validates the registry files
+func Load(fileNames ...string) (*Registry, error) {
+	var registry Registry
+
+	for _, fileName := range fileNames {
+		var fileRegistry Registry
+		if err := global.DecodeFile(fileName, &fileRegistry); err != nil {
+			return nil, err
+		}
+		registry.Vehicles = append(registry.Vehicles, fileRegistry.Vehicles...)
+	}
+
+	if err := registry.validate(); err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
+
+func (r *Registry) validate() error {
+	ids := make(map[string]bool)
+	for _, vehicle := range r.Vehicles {
+		if len(vehicle.ID) == 0 {
+			return fmt.Errorf("registry has a vehicle without id")
+		}
+		if ids[vehicle.ID] {
+			return fmt.Errorf("vehicle %s is defined more than once", vehicle.ID)
+		}
+		ids[vehicle.ID] = true
+
+		if err := vehicle.validate(); err != nil {
+			return fmt.Errorf("vehicle %s: %v", vehicle.ID, err)
+		}
+	}
+	return nil
+}
+
+// Select returns the vehicle of the ID
+func (r *Registry) Select(id string) (*Vehicle, error) {
+	ids := make([]string, len(r.Vehicles))
+	for i := range r.Vehicles {
+		if r.Vehicles[i].ID == id {
+			vehicle := r.Vehicles[i]
+			return &vehicle, nil
+		}
+		ids[i] = r.Vehicles[i].ID
+	}
+
+	sort.Strings(ids)
+	return nil, fmt.Errorf("vehicle %q is not in the registry, known vehicles are [%s]", id, strings.Join(ids, ", "))
+}
+
+func (v *Vehicle) validate() error {
+	addresses := make(map[string]bool)
+	for _, lidar := range v.Lidars {
+		if err := lidar.validate(); err != nil {
+			return err
+		}
+		if addresses[lidar.IP] {
+			return fmt.Errorf("lidar ip %s is defined more than once", lidar.IP)
+		}
+		addresses[lidar.IP] = true
+	}
+
+	names := make(map[string]bool)
+	for _, camera := range v.Cameras {
+		if err := camera.validate(); err != nil {
+			return err
+		}
+		if names[camera.Name] {
+			return fmt.Errorf("camera %s is defined more than once", camera.Name)
+		}
+		names[camera.Name] = true
+	}
+	return nil
+}
+
+func (lc *LidarCalib) validate() error {
+	if len(lc.IP) == 0 {
+		return fmt.Errorf("lidar %q has no ip", lc.Name)
+	}
+	if !lidarModels[lc.Model] {
+		return fmt.Errorf("lidar %s has an unsupported model %q", lc.IP, lc.Model)
+	}
+	return nil
+}
+
+func (cc *CameraCalib) validate() error {
+	if len(cc.Name) == 0 {
+		return fmt.Errorf("registry has a camera without name")
+	}
+	if cc.AzimuthStart < 0 || cc.AzimuthStart >= 360 || cc.AzimuthEnd < 0 || cc.AzimuthEnd >= 360 {
+		return fmt.Errorf("camera %s azimuth range must be within [0, 360)", cc.Name)
+	}
+
+	maxDistortion, ok := distortionModels[cc.Intrinsics.Model]
+	if !ok {
+		return fmt.Errorf("camera %s has an unsupported model %q", cc.Name, cc.Intrinsics.Model)
+	}
+	if len(cc.Intrinsics.Distortion) > maxDistortion {
+		return fmt.Errorf("camera %s model %q has at most %d distortion coefficients", cc.Name, cc.Intrinsics.Model, maxDistortion)
+	}
+	return nil
+}
+
+// Lidar returns the calibration of the lidar with the IP address
+func (v *Vehicle) Lidar(address string) (LidarCalib, error) {
+	for _, lidar := range v.Lidars {
+		if lidar.IP == address {
+			return lidar, nil
+		}
+	}
+	return LidarCalib{}, fmt.Errorf("source %s has no calibration entry in vehicle %q", address, v.ID)
+}
+
+// Camera returns the calibration of the camera
+func (v *Vehicle) Camera(name string) (CameraCalib, error) {
+	for _, camera := range v.Cameras {
+		if camera.Name == name {
+			return camera, nil
+		}
+	}
+	return CameraCalib{}, fmt.Errorf("camera %q has no calibration entry in vehicle %q", name, v.ID)
+}
+
+// DefaultLidar returns the calibration of a lidar without registry entry.
+// The lidar is at the vehicle origin and its points use the built-in angle tables of its product ID.
+func DefaultLidar(address string) LidarCalib {
+	return LidarCalib{IP: address}
+}
+
+// GetLidar returns the calibration of the lidar with the IP address of the current vehicle,
+// or the default calibration when no vehicle is selected
+func GetLidar(address string) (LidarCalib, error) {
+	if Current == nil {
+		return DefaultLidar(address), nil
+	}
+	return Current.Lidar(address)
+}
+
+// GetCamera returns the calibration of the camera of the current vehicle
+func GetCamera(name string) (CameraCalib, error) {
+	if Current == nil {
+		return CameraCalib{}, fmt.Errorf("camera %q has no calibration, no vehicle is selected", name)
+	}
+	return Current.Camera(name)
+}
+
+// GetCameraByIP returns the calibration of the camera with the IP address of the current vehicle
+func GetCameraByIP(address string) (CameraCalib, bool) {
+	if Current == nil {
+		return CameraCalib{}, false
+	}
+	for _, camera := range Current.Cameras {
+		if len(camera.IP) > 0 && camera.IP == address {
+			return camera, true
+		}
+	}
+	return CameraCalib{}, false
+}
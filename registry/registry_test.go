@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"github.com/bldulam1/pcap-decoder/global"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const registryFile = `vehicles:
+  - id: car1
+    lidars:
+      - {name: roof, ip: 10.0.0.1, model: VLP16, extrinsics: {z: 1800, yaw: 90}}
+    cameras:
+      - {name: front, ip: 10.0.1.1, azimuthStart: 315, azimuthEnd: 45, intrinsics: {model: radtan, width: 640, height: 480, fx: 500, fy: 500, cx: 320, cy: 240}}
+  - id: car2
+    lidars:
+      - {ip: 10.0.0.2}
+`
+
+func writeRegistry(t *testing.T, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "vehicles.yaml")
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+// keepCurrent restores the current vehicle after the test
+func keepCurrent(t *testing.T) {
+	saved := Current
+	t.Cleanup(func() { Current = saved })
+}
+
+func TestSetupSelectsVehicle(t *testing.T) {
+	keepCurrent(t)
+	fileName := writeRegistry(t, registryFile)
+
+	sensors := []global.SensorConfig{{Name: "rear", IP: "10.0.0.3"}, {IP: "10.0.0.1", Extrinsics: global.Extrinsics{Z: 2000}}}
+	if err := Setup([]string{fileName}, "car1", sensors); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sensors of the job replace the registry entries of their IP address
+	roof, err := GetLidar("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roof != (LidarCalib{IP: "10.0.0.1", Extrinsics: global.Extrinsics{Z: 2000}}) {
+		t.Errorf("roof lidar is %+v", roof)
+	}
+	if rear, err := GetLidar("10.0.0.3"); err != nil || rear.Name != "rear" {
+		t.Errorf("rear lidar is %+v, %v", rear, err)
+	}
+
+	// the lidars of the other vehicles are not calibrated
+	if _, err := GetLidar("10.0.0.2"); err == nil || !strings.Contains(err.Error(), "car1") {
+		t.Errorf("lidar of car2 returns the error %v", err)
+	}
+
+	front, err := GetCamera("front")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !front.HasIntrinsics() || front.AzimuthRange()[0] != 31500 || front.AzimuthRange()[1] != 4500 {
+		t.Errorf("front camera is %+v", front)
+	}
+	if camera, ok := GetCameraByIP("10.0.1.1"); !ok || camera.Name != "front" {
+		t.Errorf("camera of 10.0.1.1 is %+v", camera)
+	}
+}
+
+func TestGetLidarWithoutVehicle(t *testing.T) {
+	keepCurrent(t)
+	if err := Setup(nil, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if Current != nil {
+		t.Fatalf("vehicle %+v is selected without registry", Current)
+	}
+
+	// the lidars fall back to the built-in tables at the vehicle origin
+	lidar, err := GetLidar("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lidar != DefaultLidar("10.0.0.1") || lidar.IP != "10.0.0.1" || lidar.Extrinsics != (global.Extrinsics{}) {
+		t.Errorf("lidar is %+v", lidar)
+	}
+
+	if _, err := GetCamera("front"); err == nil {
+		t.Error("a camera is calibrated without vehicle")
+	}
+	if _, ok := GetCameraByIP("10.0.1.1"); ok {
+		t.Error("a camera address is calibrated without vehicle")
+	}
+}
+
+func TestSetupRejectsInvalidRegistries(t *testing.T) {
+	keepCurrent(t)
+	tests := []struct {
+		content string
+		vehicle string
+		err     string
+	}{
+		{registryFile, "car3", "known vehicles are [car1, car2]"},
+		{registryFile, "", "vehicle is required"},
+		{"vehicles: [{lidars: []}]\n", "car1", "without id"},
+		{"vehicles: [{id: car1}, {id: car1}]\n", "car1", "more than once"},
+		{"vehicles: [{id: car1, lidars: [{ip: 10.0.0.1}, {ip: 10.0.0.1}]}]\n", "car1", "lidar ip 10.0.0.1"},
+		{"vehicles: [{id: car1, lidars: [{ip: 10.0.0.1, model: HDL64}]}]\n", "car1", "unsupported model"},
+		{"vehicles: [{id: car1, cameras: [{name: front, azimuthEnd: 360}]}]\n", "car1", "[0, 360)"},
+		{"vehicles: [{id: car1, cameras: [{name: front, intrinsics: {model: fisheye, distortion: [1, 2, 3, 4, 5]}}]}]\n", "car1", "at most 4"},
+	}
+	for _, test := range tests {
+		err := Setup([]string{writeRegistry(t, test.content)}, test.vehicle, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q of %q: error %v, expected %q", test.vehicle, test.content, err, test.err)
+		}
+	}
+
+	if err := Setup(nil, "car1", nil); err == nil {
+		t.Error("a vehicle is selected without registry")
+	}
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/global"
+)
+
+// Setup selects the current vehicle from the registry files and adds the sensors of the job configuration.
+// The configured sensors override the registry entries with the same IP address.
+func Setup(registryFiles []string, vehicleID string, sensors []global.SensorConfig) error {
+	Current = nil
+
+	vehicle := &Vehicle{ID: vehicleID}
+	if len(registryFiles) > 0 {
+		if len(vehicleID) == 0 {
+			return fmt.Errorf("vehicle is required to select a calibration from the registry")
+		}
+
+		registry, err := Load(registryFiles...)
+		if err != nil {
+			return err
+		}
+
+		vehicle, err = registry.Select(vehicleID)
+		if err != nil {
+			return err
+		}
+	} else if len(vehicleID) > 0 {
+		return fmt.Errorf("vehicle %q needs a registry file", vehicleID)
+	}
+
+	for _, sensor := range sensors {
+		lidar, err := getSensorCalib(sensor)
+		if err != nil {
+			return err
+		}
+		vehicle.setLidar(lidar)
+	}
+
+	if len(registryFiles) == 0 && len(sensors) == 0 {
+		return nil
+	}
+
+	if err := vehicle.validate(); err != nil {
+		return err
+	}
+
+	Current = vehicle
+	return nil
+}
+
+// getSensorCalib returns the calibration of a configured sensor.
+// The values of the configuration override the values of its calibration file.
+func getSensorCalib(sensor global.SensorConfig) (LidarCalib, error) {
+	var lidar LidarCalib
+	if len(sensor.CalibrationFile) > 0 {
+		if err := global.DecodeFile(sensor.CalibrationFile, &lidar); err != nil {
+			return lidar, err
+		}
+		if len(lidar.IP) > 0 && lidar.IP != sensor.IP {
+			return lidar, fmt.Errorf("%s: calibration is for %s, not for sensor %s", sensor.CalibrationFile, lidar.IP, sensor.IP)
+		}
+	}
+
+	lidar.IP = sensor.IP
+	if len(sensor.Name) > 0 {
+		lidar.Name = sensor.Name
+	}
+	if len(sensor.Model) > 0 {
+		lidar.Model = sensor.Model
+	}
+	if sensor.Extrinsics != (global.Extrinsics{}) {
+		lidar.Extrinsics = sensor.Extrinsics
+	}
+
+	return lidar, nil
+}
+
+func (v *Vehicle) setLidar(lidar LidarCalib) {
+	for i := range v.Lidars {
+		if v.Lidars[i].IP == lidar.IP {
+			v.Lidars[i] = lidar
+			return
+		}
+	}
+	v.Lidars = append(v.Lidars, lidar)
+}
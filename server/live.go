@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"sync"
+	"time"
+)
+
+// liveFrameBuffer is the number of frames queued for a client, the frames that do not fit are dropped
+const liveFrameBuffer = 8
+
+// liveCapture lists the lidar sources received so far in live mode
+type liveCapture struct {
+	Live    bool                       `json:"live"`
+	Sources []*pcapdecoder.SourceIndex `json:"sources"`
+}
+
+// liveFrames broadcasts the frames of the live decoder to the WebSocket clients
+type liveFrames struct {
+	mutex   sync.Mutex
+	sources []*pcapdecoder.SourceIndex
+	clients map[*liveClient]bool
+	ended   bool
+}
+
+// liveClient is a WebSocket client of the live frames
+type liveClient struct {
+	// sources is the subscription of the client, all sources when empty
+	sources map[string]bool
+	paused  bool
+	frames  chan liveFrame
+	// ended is closed at the end of the live decoding
+	ended chan struct{}
+}
+
+type liveFrame struct {
+	time    time.Time
+	message []byte
+}
+
+func newLiveFrames() *liveFrames {
+	return &liveFrames{clients: make(map[*liveClient]bool)}
+}
+
+// AddFrame passes a frame of the live decoder to the subscribed clients, it is the frame handler of the decoder in live mode
+func (s *Server) AddFrame(ls *pcapdecoder.LidarSource, frame *pcapdecoder.LidarFrame) error {
+	message, err := encodeFrame(ls, frame)
+	if err != nil {
+		return err
+	}
+
+	lf := s.live
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+
+	source := lf.getSource(ls.ID())
+	if source == nil {
+		source = &pcapdecoder.SourceIndex{
+			ID:        ls.ID(),
+			Address:   ls.Address,
+			Interface: ls.Interface,
+			Name:      ls.Name(),
+			Model:     ls.Model()}
+		lf.sources = append(lf.sources, source)
+	}
+	source.FrameCount++
+
+	for client := range lf.clients {
+		if client.paused || (len(client.sources) > 0 && !client.sources[source.ID]) {
+			continue
+		}
+		select {
+		case client.frames <- liveFrame{time: frame.Time, message: message}:
+		default:
+			// the client is slower than the decoder
+		}
+	}
+	return nil
+}
+
+// Close ends the streams of the live frames
+func (s *Server) Close() {
+	lf := s.live
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+
+	if !lf.ended {
+		lf.ended = true
+		for client := range lf.clients {
+			close(client.ended)
+		}
+	}
+}
+
+func (lf *liveFrames) getSource(id string) *pcapdecoder.SourceIndex {
+	for _, source := range lf.sources {
+		if source.ID == id {
+			return source
+		}
+	}
+	return nil
+}
+
+// capture returns a copy of the sources received so far
+func (lf *liveFrames) capture() liveCapture {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+
+	capture := liveCapture{Live: true, Sources: []*pcapdecoder.SourceIndex{}}
+	for _, source := range lf.sources {
+		copied := *source
+		capture.Sources = append(capture.Sources, &copied)
+	}
+	return capture
+}
+
+// stream pushes the live frames of the subscribed sources to the client until it disconnects or the decoding ends.
+// The client can pause, play and subscribe, the frames decoded while it is paused are not sent.
+func (lf *liveFrames) stream(st *stream, commands <-chan streamCommand) {
+	client := &liveClient{
+		frames: make(chan liveFrame, liveFrameBuffer),
+		ended:  make(chan struct{})}
+	client.sources = sourceSet(st.sources)
+
+	lf.mutex.Lock()
+	if lf.ended {
+		close(client.ended)
+	}
+	lf.clients[client] = true
+	lf.mutex.Unlock()
+
+	defer func() {
+		lf.mutex.Lock()
+		delete(lf.clients, client)
+		lf.mutex.Unlock()
+	}()
+
+	st.sendState("state", "")
+	for {
+		select {
+		case <-client.ended:
+			st.playing = false
+			st.sendState("end", "")
+			return
+		case frame := <-client.frames:
+			st.position = frame.time
+			if err := st.sendMessage(frame.message); err != nil {
+				return
+			}
+		case command, ok := <-commands:
+			if !ok {
+				return
+			}
+
+			var err error
+			lf.mutex.Lock()
+			switch command.Type {
+			case "play":
+				st.playing = true
+			case "pause":
+				st.playing = false
+			case "subscribe":
+				st.sources = command.Sources
+				client.sources = sourceSet(st.sources)
+			default:
+				err = fmt.Errorf("%q is not supported by a live stream", command.Type)
+			}
+			client.paused = !st.playing
+			lf.mutex.Unlock()
+
+			if err != nil {
+				st.sendState("error", err.Error())
+				continue
+			}
+			st.sendState("state", "")
+		}
+	}
+}
+
+func sourceSet(ids []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
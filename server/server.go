@@ -0,0 +1,181 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frameCacheSize is the number of decoded frames kept for scrubbing back and forth
+const frameCacheSize = 32
+
+// Timeouts of the HTTP requests. A response may decode a frame of a compressed capture from its start,
+// the WebSocket streams clear them after the upgrade.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 5 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// Server serves the embedded point cloud viewer and the frames of an indexed capture,
+// or streams the frames of the live decoder
+type Server struct {
+	index *pcapdecoder.CaptureIndex
+	live  *liveFrames
+	// allowedOrigins are the origins of the WebSocket clients of other hosts
+	allowedOrigins []string
+	mutex          sync.Mutex
+	cache          map[frameKey]*encodedFrame
+	order          []frameKey
+}
+
+type frameKey struct {
+	id    string
+	index uint
+}
+
+// encodedFrame is a frame in the binary format of the frame endpoint
+type encodedFrame struct {
+	index uint
+	time  time.Time
+	data  []byte
+}
+
+// New creates a Server of the capture index. Without an index, it streams the frames passed to AddFrame.
+// The WebSocket clients of other hosts need one of the allowed origins.
+func New(index *pcapdecoder.CaptureIndex, allowedOrigins []string) *Server {
+	return &Server{
+		index:          index,
+		live:           newLiveFrames(),
+		allowedOrigins: allowedOrigins,
+		cache:          make(map[frameKey]*encodedFrame)}
+}
+
+// HTTPServer returns the HTTP server of the viewer and the API on the address, with the request timeouts
+func (s *Server) HTTPServer(address string) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout}
+}
+
+// Handler returns the routes of the viewer and the API
+func (s *Server) Handler() http.Handler {
+	web, _ := fs.Sub(webFiles, "web")
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(web)))
+	mux.HandleFunc("/api/capture", s.handleCapture)
+	mux.HandleFunc("/api/sources/", s.handleSource)
+	mux.HandleFunc("/api/stream", s.handleStream)
+	return mux
+}
+
+// handleCapture lists the lidar sources of the capture
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if s.index == nil {
+		writeJSON(w, s.live.capture())
+		return
+	}
+	writeJSON(w, s.index)
+}
+
+// handleSource serves /api/sources/<id>/frames and /api/sources/<id>/frames/<index>
+func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/sources/"), "/")
+	if len(parts) < 2 || parts[1] != "frames" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	if s.index == nil {
+		http.Error(w, "the frames of a live capture are only streamed", http.StatusNotFound)
+		return
+	}
+
+	source, err := s.index.GetSource(parts[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		writeJSON(w, source.Frames)
+		return
+	}
+
+	frameIndex, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid frame index %q", parts[2]), http.StatusBadRequest)
+		return
+	}
+	if _, err := source.GetFrame(uint(frameIndex)); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	frame, err := s.getFrame(source.ID, uint(frameIndex))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Frame-Index", strconv.FormatUint(uint64(frame.index), 10))
+	w.Header().Set("X-Frame-Time", frame.time.UTC().Format(time.RFC3339Nano))
+	w.Header().Set("X-Point-Count", strconv.Itoa(len(frame.data)/16))
+	w.Write(frame.data)
+}
+
+// getFrame returns the encoded frame from the cache, or decodes it from the capture
+func (s *Server) getFrame(id string, frameIndex uint) (*encodedFrame, error) {
+	key := frameKey{id, frameIndex}
+
+	s.mutex.Lock()
+	frame, ok := s.cache[key]
+	s.mutex.Unlock()
+	if ok {
+		return frame, nil
+	}
+
+	_, lidarFrame, err := s.index.ReadFrame(id, frameIndex)
+	if err != nil {
+		return nil, err
+	}
+	frame = &encodedFrame{
+		index: lidarFrame.Index,
+		time:  lidarFrame.Time,
+		data:  lidarFrame.EncodeFloat32()}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.cache[key]; !ok {
+		s.cache[key] = frame
+		s.order = append(s.order, key)
+		if len(s.order) > frameCacheSize {
+			delete(s.cache, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	return frame, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// lidarPacket returns the Ethernet frame of a VLP-16 packet whose azimuth turns by 37 per block
+func lidarPacket(t *testing.T, address string, number int) []byte {
+	t.Helper()
+	payload := make([]byte, 1206)
+	for block := 0; block < 12; block++ {
+		offset := block * 100
+		binary.BigEndian.PutUint16(payload[offset:], 0xFFEE)
+		binary.LittleEndian.PutUint16(payload[offset+2:], uint16((number*12+block)*37%36000))
+		for channel := 0; channel < 32; channel++ {
+			binary.LittleEndian.PutUint16(payload[offset+4+3*channel:], uint16(1000+channel))
+			payload[offset+6+3*channel] = byte(channel)
+		}
+	}
+	binary.LittleEndian.PutUint32(payload[1200:], uint32(1000*(number+1)))
+	payload[1204], payload[1205] = 0x37, 0x22
+
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(address).To4(),
+		DstIP:    net.IPv4(255, 255, 255, 255).To4()}
+	udp := &layers.UDP{SrcPort: 2368, DstPort: 2368}
+	udp.SetNetworkLayerForChecksum(ip)
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, ethernet, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// testIndex indexes a capture of a lidar with about 4 frames
+func testIndex(t *testing.T) *pcapdecoder.CaptureIndex {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "capture.pcap")
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 350; i++ {
+		data := lidarPacket(t, "10.0.0.1", i)
+		ci := gopacket.CaptureInfo{Timestamp: testStart.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := pcapdecoder.IndexPCAP([]string{fileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func get(t *testing.T, server *httptest.Server, path string) *http.Response {
+	t.Helper()
+	response, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestServerServesFrames(t *testing.T) {
+	index := testIndex(t)
+	server := httptest.NewServer(New(index, nil).Handler())
+	defer server.Close()
+
+	if response := get(t, server, "/"); response.StatusCode != http.StatusOK {
+		t.Errorf("viewer has the status %d", response.StatusCode)
+	} else if body, _ := ioutil.ReadAll(response.Body); !strings.Contains(string(body), "viewer.js") {
+		t.Error("viewer does not load its script")
+	}
+
+	var capture struct {
+		Sources []struct {
+			ID         string `json:"id"`
+			FrameCount int    `json:"frameCount"`
+		} `json:"sources"`
+	}
+	if err := json.NewDecoder(get(t, server, "/api/capture").Body).Decode(&capture); err != nil {
+		t.Fatal(err)
+	}
+	if len(capture.Sources) != 1 || capture.Sources[0].ID != "10.0.0.1" || capture.Sources[0].FrameCount < 2 {
+		t.Fatalf("capture has the sources %+v", capture.Sources)
+	}
+
+	var frames []pcapdecoder.FrameInfo
+	if err := json.NewDecoder(get(t, server, "/api/sources/10.0.0.1/frames").Body).Decode(&frames); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != capture.Sources[0].FrameCount {
+		t.Fatalf("source has %d frames, expected %d", len(frames), capture.Sources[0].FrameCount)
+	}
+
+	// the frames are the points of the decoded frame, 16 bytes each, from the capture or the cache
+	for i := 0; i < 2; i++ {
+		last := frames[len(frames)-1]
+		response := get(t, server, "/api/sources/10.0.0.1/frames/"+strconv.Itoa(int(last.Index)))
+		body, _ := ioutil.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK || len(body) != 16*last.Points || response.Header.Get("X-Point-Count") != strconv.Itoa(last.Points) {
+			t.Fatalf("frame %d has the status %d and %d bytes of %s points, expected %d points",
+				last.Index, response.StatusCode, len(body), response.Header.Get("X-Point-Count"), last.Points)
+		}
+		if frameTime, err := time.Parse(time.RFC3339Nano, response.Header.Get("X-Frame-Time")); err != nil || !frameTime.Equal(last.Time) {
+			t.Errorf("frame %d is at %s", last.Index, response.Header.Get("X-Frame-Time"))
+		}
+	}
+
+	for path, status := range map[string]int{
+		"/api/sources/10.0.0.2/frames":      http.StatusNotFound,
+		"/api/sources/10.0.0.1/frames/999":  http.StatusNotFound,
+		"/api/sources/10.0.0.1/frames/x":    http.StatusBadRequest,
+		"/api/sources/10.0.0.1/points":      http.StatusNotFound,
+		"/api/sources/10.0.0.1/frames/1/xy": http.StatusNotFound,
+	} {
+		if response := get(t, server, path); response.StatusCode != status {
+			t.Errorf("%s has the status %d, expected %d", path, response.StatusCode, status)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPacketDelay caps the wait between two packets, so that gaps in the capture do not stall the stream
+const maxPacketDelay = time.Second
+
+// messageWriteTimeout closes the stream of a client that stops reading
+const messageWriteTimeout = 30 * time.Second
+
+// streamCommand is a playback control sent by the client
+type streamCommand struct {
+	Type    string    `json:"type"`
+	Sources []string  `json:"sources"`
+	Time    time.Time `json:"time"`
+	Speed   float64   `json:"speed"`
+}
+
+// streamState is sent to the client after every command and at the end of the capture
+type streamState struct {
+	Type    string    `json:"type"`
+	Playing bool      `json:"playing"`
+	Speed   float64   `json:"speed"`
+	Time    time.Time `json:"time"`
+	Sources []string  `json:"sources"`
+	Message string    `json:"message,omitempty"`
+}
+
+// frameMetadata describes the points of a streamed frame
+type frameMetadata struct {
+	ID      string    `json:"id"`
+	Address string    `json:"address"`
+	Name    string    `json:"name"`
+	Index   uint      `json:"index"`
+	Time    time.Time `json:"time"`
+	Points  int       `json:"points"`
+}
+
+// stream replays the capture to one WebSocket client at the recorded rate
+type stream struct {
+	conn     *websocket.Conn
+	player   *pcapdecoder.Player
+	sources  []string
+	playing  bool
+	speed    float64
+	position time.Time
+	// the wall clock and capture time at which the playback was last started or changed
+	wallStart    time.Time
+	captureStart time.Time
+}
+
+// handleStream upgrades the request to a WebSocket that pushes the frames of the subscribed sources
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 64 * 1024,
+		CheckOrigin:     s.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// the stream lasts longer than the timeouts of the HTTP requests
+	conn.UnderlyingConn().SetDeadline(time.Time{})
+
+	st := &stream{conn: conn, playing: true, speed: 1}
+	done := make(chan struct{})
+	defer close(done)
+
+	if s.index == nil {
+		st.sources = r.URL.Query()["source"]
+		s.live.stream(st, readCommands(conn, done))
+		return
+	}
+
+	st.player = s.index.NewPlayer(st.sendFrame)
+	defer st.player.Close()
+
+	start, err := st.parseQuery(r)
+	if err != nil {
+		st.sendState("error", err.Error())
+		return
+	}
+
+	commands := readCommands(conn, done)
+	if err := st.seek(start); err != nil {
+		st.sendState("error", err.Error())
+		return
+	}
+	st.sendState("state", "")
+
+	for {
+		if !st.playing {
+			command, ok := <-commands
+			if !ok {
+				return
+			}
+			st.apply(command)
+			continue
+		}
+
+		packetTime, err := st.player.Next()
+		if err == io.EOF {
+			st.playing = false
+			st.sendState("end", "")
+			continue
+		}
+		if err != nil {
+			st.sendState("error", err.Error())
+			return
+		}
+
+		if !st.wait(packetTime, commands) {
+			return
+		}
+	}
+}
+
+// checkOrigin accepts the requests without an origin, from the viewer of the same host, or from an allowed origin.
+// "*" allows all origins.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCommands passes the commands of the client until the connection is closed or done is closed
+func readCommands(conn *websocket.Conn, done <-chan struct{}) <-chan streamCommand {
+	commands := make(chan streamCommand)
+	go func() {
+		defer close(commands)
+		for {
+			var command streamCommand
+			if err := conn.ReadJSON(&command); err != nil {
+				return
+			}
+			select {
+			case commands <- command:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return commands
+}
+
+// parseQuery sets the initial sources and speed of the stream, and returns its start time
+func (st *stream) parseQuery(r *http.Request) (time.Time, error) {
+	query := r.URL.Query()
+	st.sources = query["source"]
+
+	if speed := query.Get("speed"); len(speed) > 0 {
+		value, err := strconv.ParseFloat(speed, 64)
+		if err != nil || value <= 0 {
+			return time.Time{}, fmt.Errorf("speed must be positive")
+		}
+		st.speed = value
+	}
+
+	var start time.Time
+	if t := query.Get("time"); len(t) > 0 {
+		var err error
+		if start, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", t)
+		}
+	}
+	return start, nil
+}
+
+// wait sleeps until the packet is due at the playback speed, while applying the incoming commands
+func (st *stream) wait(packetTime time.Time, commands <-chan streamCommand) bool {
+	if st.captureStart.IsZero() {
+		st.captureStart = packetTime
+		st.wallStart = time.Now()
+	}
+	st.position = packetTime
+
+	delay := time.Duration(float64(packetTime.Sub(st.captureStart))/st.speed) - time.Since(st.wallStart)
+	if delay > maxPacketDelay {
+		// skip over the gap of the capture
+		st.captureStart = packetTime
+		st.wallStart = time.Now()
+		delay = 0
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case command, ok := <-commands:
+		if !ok {
+			return false
+		}
+		st.apply(command)
+	}
+	return true
+}
+
+// apply executes a command of the client and reports the new state
+func (st *stream) apply(command streamCommand) {
+	var err error
+	switch command.Type {
+	case "play":
+		st.playing = true
+	case "pause":
+		st.playing = false
+	case "speed":
+		if command.Speed <= 0 {
+			err = fmt.Errorf("speed must be positive")
+			break
+		}
+		st.speed = command.Speed
+	case "seek":
+		err = st.seek(command.Time)
+	case "subscribe":
+		st.sources = command.Sources
+		err = st.seek(st.position)
+	default:
+		err = fmt.Errorf("unknown command %q", command.Type)
+	}
+
+	// the playback clock restarts at the current position
+	st.captureStart = time.Time{}
+
+	if err != nil {
+		st.sendState("error", err.Error())
+		return
+	}
+	st.sendState("state", "")
+}
+
+func (st *stream) seek(t time.Time) error {
+	st.position = t
+	return st.player.Seek(t, st.sources)
+}
+
+func (st *stream) sendState(stateType string, message string) {
+	st.conn.SetWriteDeadline(time.Now().Add(messageWriteTimeout))
+	st.conn.WriteJSON(streamState{
+		Type:    stateType,
+		Playing: st.playing,
+		Speed:   st.speed,
+		Time:    st.position,
+		Sources: st.sources,
+		Message: message})
+}
+
+// sendFrame writes the frame as one binary message
+func (st *stream) sendFrame(ls *pcapdecoder.LidarSource, frame *pcapdecoder.LidarFrame) error {
+	message, err := encodeFrame(ls, frame)
+	if err != nil {
+		return err
+	}
+	return st.sendMessage(message)
+}
+
+func (st *stream) sendMessage(message []byte) error {
+	st.conn.SetWriteDeadline(time.Now().Add(messageWriteTimeout))
+	return st.conn.WriteMessage(websocket.BinaryMessage, message)
+}
+
+// encodeFrame returns the stream message of a frame: the length of the JSON metadata as a little endian uint32,
+// the metadata padded with spaces to a multiple of 4 bytes, then the points of the frame endpoint
+func encodeFrame(ls *pcapdecoder.LidarSource, frame *pcapdecoder.LidarFrame) ([]byte, error) {
+	points := frame.EncodeFloat32()
+	metadata, err := json.Marshal(frameMetadata{
+		ID:      ls.ID(),
+		Address: ls.Address,
+		Name:    ls.Name(),
+		Index:   frame.Index,
+		Time:    frame.Time,
+		Points:  len(points) / 16})
+	if err != nil {
+		return nil, err
+	}
+	for len(metadata)%4 != 0 {
+		metadata = append(metadata, ' ')
+	}
+
+	var message bytes.Buffer
+	binary.Write(&message, binary.LittleEndian, uint32(len(metadata)))
+	message.Write(metadata)
+	message.Write(points)
+	return message.Bytes(), nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/bldulam1/pcap-decoder/pcapdecoder"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dial opens the WebSocket stream of the server with the origin header, if any
+func dial(t *testing.T, server *httptest.Server, query string, origin string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	header := http.Header{}
+	if len(origin) > 0 {
+		header.Set("Origin", origin)
+	}
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/stream"+query, header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, response, err
+}
+
+// readMessage returns the next state of the stream, or the metadata of the next frame
+func readMessage(t *testing.T, conn *websocket.Conn) (*streamState, *frameMetadata) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messageType == websocket.TextMessage {
+		var state streamState
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatal(err)
+		}
+		return &state, nil
+	}
+
+	length := binary.LittleEndian.Uint32(data)
+	var metadata frameMetadata
+	if err := json.Unmarshal(data[4:4+length], &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4+int(length)+16*metadata.Points {
+		t.Fatalf("frame %d has %d bytes for %d points", metadata.Index, len(data), metadata.Points)
+	}
+	return nil, &metadata
+}
+
+func TestStreamChecksOrigin(t *testing.T) {
+	server := httptest.NewServer(New(testIndex(t), []string{"https://dashboard.example.com/"}).Handler())
+	defer server.Close()
+
+	for _, origin := range []string{"", server.URL, "https://dashboard.example.com"} {
+		if _, _, err := dial(t, server, "", origin); err != nil {
+			t.Errorf("origin %q is rejected: %v", origin, err)
+		}
+	}
+
+	_, response, err := dial(t, server, "", "https://other.example.com")
+	if err == nil || response == nil || response.StatusCode != http.StatusForbidden {
+		t.Errorf("another origin is not forbidden: %v", err)
+	}
+
+	server = httptest.NewServer(New(nil, []string{"*"}).Handler())
+	defer server.Close()
+	if _, _, err := dial(t, server, "", "https://other.example.com"); err != nil {
+		t.Errorf("* does not allow all origins: %v", err)
+	}
+}
+
+func TestStreamReplaysIndexedCapture(t *testing.T) {
+	index := testIndex(t)
+	server := httptest.NewServer(New(index, nil).Handler())
+	defer server.Close()
+
+	conn, _, err := dial(t, server, "?source=10.0.0.1&speed=100", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := readMessage(t, conn); state == nil || state.Type != "state" || !state.Playing || state.Speed != 100 {
+		t.Fatalf("stream starts with the state %+v", state)
+	}
+
+	var indices []uint
+	for {
+		state, metadata := readMessage(t, conn)
+		if state != nil {
+			if state.Type != "end" {
+				t.Fatalf("stream sends the state %+v before its end", state)
+			}
+			break
+		}
+		if metadata.ID != "10.0.0.1" {
+			t.Errorf("frame of the source %q is streamed", metadata.ID)
+		}
+		indices = append(indices, metadata.Index)
+	}
+
+	source, _ := index.GetSource("10.0.0.1")
+	if len(indices) != source.FrameCount {
+		t.Fatalf("streamed the frames %v, expected %d frames", indices, source.FrameCount)
+	}
+	for i, frame := range source.Frames {
+		if indices[i] != frame.Index {
+			t.Errorf("frame %d is the frame %d of the index", indices[i], frame.Index)
+		}
+	}
+}
+
+func TestLiveStreamPushesDecodedFrames(t *testing.T) {
+	s := New(nil, nil)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	d := pcapdecoder.NewDecoder()
+	d.AddFrameHandler(s.AddFrame)
+	number := 0
+	// decode feeds the decoder with the packets of about one frame
+	decode := func() {
+		for end := number + 90; number < end; number++ {
+			packet := gopacket.NewPacket(lidarPacket(t, "10.0.0.1", number), layers.LayerTypeEthernet, gopacket.Default)
+			packet.Metadata().Timestamp = testStart.Add(time.Duration(number) * time.Millisecond)
+			if err := d.DecodePacket(packet); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	conn, _, err := dial(t, server, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := readMessage(t, conn); state == nil || state.Type != "state" {
+		t.Fatalf("stream starts with the state %+v", state)
+	}
+
+	decode()
+	decode()
+	_, metadata := readMessage(t, conn)
+	if metadata == nil || metadata.ID != "10.0.0.1" || metadata.Points == 0 {
+		t.Fatalf("stream sends the frame %+v", metadata)
+	}
+
+	var capture liveCapture
+	if err := json.NewDecoder(get(t, server, "/api/capture").Body).Decode(&capture); err != nil {
+		t.Fatal(err)
+	}
+	if !capture.Live || len(capture.Sources) != 1 || capture.Sources[0].ID != "10.0.0.1" || capture.Sources[0].Model != "VLP16" {
+		t.Fatalf("live capture has the sources %+v", capture.Sources)
+	}
+	if response := get(t, server, "/api/sources/10.0.0.1/frames"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("frames of a live capture have the status %d", response.StatusCode)
+	}
+
+	// the frames of other sources and the seeks are not streamed
+	conn.WriteJSON(streamCommand{Type: "subscribe", Sources: []string{"10.0.0.2"}})
+	for {
+		state, _ := readMessage(t, conn)
+		if state != nil {
+			if state.Type != "state" || len(state.Sources) != 1 {
+				t.Fatalf("subscription is answered by %+v", state)
+			}
+			break
+		}
+	}
+	conn.WriteJSON(streamCommand{Type: "seek", Time: testStart})
+	if state, _ := readMessage(t, conn); state == nil || state.Type != "error" {
+		t.Fatalf("seek is answered by %+v", state)
+	}
+
+	decode()
+	s.Close()
+	if state, metadata := readMessage(t, conn); state == nil || state.Type != "end" {
+		t.Fatalf("stream sends %+v %+v instead of its end", state, metadata)
+	}
+}
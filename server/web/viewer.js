@@ -0,0 +1,310 @@
+// Point cloud viewer of the frames served by the API.
+// A frame is little endian float32 x, y, z in meters and intensity per point, in the vehicle coordinates.
+'use strict';
+
+const canvas = document.getElementById('view');
+const sourceSelect = document.getElementById('source');
+const frameSlider = document.getElementById('frame');
+const colorSelect = document.getElementById('color');
+const playButton = document.getElementById('play');
+const speedSelect = document.getElementById('speed');
+const statusText = document.getElementById('status');
+
+const gl = canvas.getContext('webgl');
+
+const vertexShader = `
+attribute vec4 point;
+uniform mat4 projection;
+uniform int colorMode;
+varying vec3 color;
+
+vec3 colormap(float t) {
+  t = clamp(t, 0.0, 1.0);
+  return clamp(vec3(1.5 - abs(4.0 * t - 3.0), 1.5 - abs(4.0 * t - 2.0), 1.5 - abs(4.0 * t - 1.0)), 0.0, 1.0);
+}
+
+void main() {
+  gl_Position = projection * vec4(point.xyz, 1.0);
+  gl_PointSize = 2.0;
+  color = colorMode == 0 ? colormap(point.w / 255.0) : colormap((point.z + 3.0) / 8.0);
+}`;
+
+const fragmentShader = `
+precision mediump float;
+varying vec3 color;
+
+void main() {
+  gl_FragColor = vec4(color, 1.0);
+}`;
+
+function compile(type, source) {
+  const shader = gl.createShader(type);
+  gl.shaderSource(shader, source);
+  gl.compileShader(shader);
+  if (!gl.getShaderParameter(shader, gl.COMPILE_STATUS)) {
+    throw new Error(gl.getShaderInfoLog(shader));
+  }
+  return shader;
+}
+
+const program = gl.createProgram();
+gl.attachShader(program, compile(gl.VERTEX_SHADER, vertexShader));
+gl.attachShader(program, compile(gl.FRAGMENT_SHADER, fragmentShader));
+gl.linkProgram(program);
+gl.useProgram(program);
+
+const pointAttribute = gl.getAttribLocation(program, 'point');
+const projectionUniform = gl.getUniformLocation(program, 'projection');
+const colorModeUniform = gl.getUniformLocation(program, 'colorMode');
+const buffer = gl.createBuffer();
+
+let pointCount = 0;
+let frames = [];
+let source = null;
+let socket = null;
+let loading = false;
+// a live capture is only streamed, its frames are not indexed
+let live = false;
+
+// orbit camera around the target, Z up
+const camera = { yaw: -Math.PI / 2, pitch: 0.5, distance: 40, target: [0, 0, 0] };
+
+function perspective(fov, aspect, near, far) {
+  const f = 1 / Math.tan(fov / 2);
+  return [f / aspect, 0, 0, 0, 0, f, 0, 0, 0, 0, (far + near) / (near - far), -1, 0, 0, 2 * far * near / (near - far), 0];
+}
+
+function lookAt(eye, target, up) {
+  const sub = (a, b) => [a[0] - b[0], a[1] - b[1], a[2] - b[2]];
+  const cross = (a, b) => [a[1] * b[2] - a[2] * b[1], a[2] * b[0] - a[0] * b[2], a[0] * b[1] - a[1] * b[0]];
+  const dot = (a, b) => a[0] * b[0] + a[1] * b[1] + a[2] * b[2];
+  const normalize = (a) => { const l = Math.hypot(a[0], a[1], a[2]); return [a[0] / l, a[1] / l, a[2] / l]; };
+
+  const z = normalize(sub(eye, target));
+  const x = normalize(cross(up, z));
+  const y = cross(z, x);
+  return [x[0], y[0], z[0], 0, x[1], y[1], z[1], 0, x[2], y[2], z[2], 0, -dot(x, eye), -dot(y, eye), -dot(z, eye), 1];
+}
+
+function multiply(a, b) {
+  const m = new Array(16).fill(0);
+  for (let col = 0; col < 4; col++) {
+    for (let row = 0; row < 4; row++) {
+      for (let k = 0; k < 4; k++) {
+        m[col * 4 + row] += a[k * 4 + row] * b[col * 4 + k];
+      }
+    }
+  }
+  return m;
+}
+
+function draw() {
+  canvas.width = canvas.clientWidth;
+  canvas.height = canvas.clientHeight;
+  gl.viewport(0, 0, canvas.width, canvas.height);
+  gl.clearColor(0.07, 0.07, 0.07, 1);
+  gl.clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT);
+  gl.enable(gl.DEPTH_TEST);
+
+  const t = camera.target;
+  const eye = [
+    t[0] + camera.distance * Math.cos(camera.pitch) * Math.cos(camera.yaw),
+    t[1] + camera.distance * Math.cos(camera.pitch) * Math.sin(camera.yaw),
+    t[2] + camera.distance * Math.sin(camera.pitch)];
+  const projection = multiply(
+    perspective(Math.PI / 3, canvas.width / canvas.height, 0.1, 1000),
+    lookAt(eye, t, [0, 0, 1]));
+
+  gl.uniformMatrix4fv(projectionUniform, false, projection);
+  gl.uniform1i(colorModeUniform, Number(colorSelect.value));
+  gl.bindBuffer(gl.ARRAY_BUFFER, buffer);
+  gl.enableVertexAttribArray(pointAttribute);
+  gl.vertexAttribPointer(pointAttribute, 4, gl.FLOAT, false, 16, 0);
+  gl.drawArrays(gl.POINTS, 0, pointCount);
+}
+
+function showPoints(points, index, time) {
+  gl.bindBuffer(gl.ARRAY_BUFFER, buffer);
+  gl.bufferData(gl.ARRAY_BUFFER, points, gl.STATIC_DRAW);
+  pointCount = points.length / 4;
+  statusText.textContent = `frame ${index}  ${pointCount} points  ${time}`;
+  draw();
+}
+
+async function loadFrame(position) {
+  const frame = frames[position];
+  if (!frame) {
+    return;
+  }
+
+  loading = true;
+  try {
+    const response = await fetch(`/api/sources/${encodeURIComponent(source.id)}/frames/${frame.index}`);
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const data = await response.arrayBuffer();
+    showPoints(new Float32Array(data), frame.index, response.headers.get('X-Frame-Time'));
+  } catch (err) {
+    statusText.textContent = err.message;
+  } finally {
+    loading = false;
+  }
+}
+
+async function selectSource(id) {
+  if (live) {
+    stop();
+    source = { id: id };
+    play();
+    return;
+  }
+
+  const response = await fetch(`/api/sources/${encodeURIComponent(id)}/frames`);
+  frames = await response.json();
+  source = { id: id };
+  frameSlider.max = Math.max(frames.length - 1, 0);
+  frameSlider.value = 0;
+  await loadFrame(0);
+}
+
+// play streams the frames of the source from the slider position at the recorded rate
+function play() {
+  const frame = frames[Number(frameSlider.value)];
+  const query = new URLSearchParams({ source: source.id, speed: speedSelect.value });
+  if (frame) {
+    query.set('time', frame.time);
+  }
+  const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
+  socket = new WebSocket(`${protocol}//${location.host}/api/stream?${query}`);
+  socket.binaryType = 'arraybuffer';
+
+  socket.onmessage = (event) => {
+    if (typeof event.data === 'string') {
+      const state = JSON.parse(event.data);
+      if (state.type === 'error') {
+        statusText.textContent = state.message;
+      }
+      if (state.type === 'end' || state.type === 'error') {
+        stop();
+      }
+      return;
+    }
+
+    // uint32 metadata length, JSON metadata padded to 4 bytes, float32 points
+    const length = new DataView(event.data).getUint32(0, true);
+    const metadata = JSON.parse(new TextDecoder().decode(new Uint8Array(event.data, 4, length)));
+    const position = frames.findIndex((f) => f.index === metadata.index);
+    if (position >= 0) {
+      frameSlider.value = position;
+    }
+    showPoints(new Float32Array(event.data, 4 + length), metadata.index, metadata.time);
+  };
+  socket.onclose = stop;
+
+  playButton.textContent = 'Pause';
+}
+
+function stop() {
+  if (socket) {
+    socket.onclose = null;
+    socket.close();
+    socket = null;
+  }
+  playButton.textContent = 'Play';
+}
+
+sourceSelect.addEventListener('change', () => {
+  stop();
+  selectSource(sourceSelect.value);
+});
+frameSlider.addEventListener('input', () => {
+  if (socket) {
+    const frame = frames[Number(frameSlider.value)];
+    socket.send(JSON.stringify({ type: 'seek', time: frame.time }));
+  } else if (!loading) {
+    loadFrame(Number(frameSlider.value));
+  }
+});
+speedSelect.addEventListener('change', () => {
+  if (socket) {
+    socket.send(JSON.stringify({ type: 'speed', speed: Number(speedSelect.value) }));
+  }
+});
+colorSelect.addEventListener('change', draw);
+window.addEventListener('resize', draw);
+
+playButton.addEventListener('click', () => {
+  if (socket) {
+    stop();
+  } else if (source) {
+    play();
+  }
+});
+
+let dragging = null;
+canvas.addEventListener('mousedown', (e) => { dragging = { x: e.clientX, y: e.clientY, pan: e.button !== 0 || e.shiftKey }; });
+canvas.addEventListener('contextmenu', (e) => e.preventDefault());
+window.addEventListener('mouseup', () => { dragging = null; });
+window.addEventListener('mousemove', (e) => {
+  if (!dragging) {
+    return;
+  }
+  const dx = e.clientX - dragging.x;
+  const dy = e.clientY - dragging.y;
+  dragging.x = e.clientX;
+  dragging.y = e.clientY;
+
+  if (dragging.pan) {
+    const scale = camera.distance / 500;
+    camera.target[0] += (dx * Math.sin(camera.yaw) - dy * Math.cos(camera.yaw)) * scale;
+    camera.target[1] += (-dx * Math.cos(camera.yaw) - dy * Math.sin(camera.yaw)) * scale;
+  } else {
+    camera.yaw -= dx * 0.005;
+    camera.pitch = Math.min(Math.PI / 2 - 0.01, Math.max(-Math.PI / 2 + 0.01, camera.pitch + dy * 0.005));
+  }
+  draw();
+});
+canvas.addEventListener('wheel', (e) => {
+  e.preventDefault();
+  camera.distance = Math.min(500, Math.max(1, camera.distance * Math.exp(e.deltaY * 0.001)));
+  draw();
+}, { passive: false });
+
+// loadCapture lists the sources of the capture, a live capture is polled for new sources
+function loadCapture() {
+  fetch('/api/capture')
+    .then((response) => response.json())
+    .then((capture) => {
+      live = Boolean(capture.live);
+      frameSlider.disabled = live;
+      speedSelect.disabled = live;
+
+      const known = new Set(Array.from(sourceSelect.options, (option) => option.value));
+      for (const s of capture.sources || []) {
+        if (known.has(s.id)) {
+          continue;
+        }
+        const option = document.createElement('option');
+        option.value = s.id;
+        option.textContent = live ? `${s.name} (${s.model})` : `${s.name} (${s.model}, ${s.frameCount} frames)`;
+        sourceSelect.appendChild(option);
+      }
+
+      if (live) {
+        setTimeout(loadCapture, 2000);
+      }
+      if (source) {
+        return;
+      }
+      if (sourceSelect.options.length > 0) {
+        selectSource(sourceSelect.value);
+      } else if (live) {
+        statusText.textContent = 'waiting for lidar packets';
+      } else {
+        statusText.textContent = 'no lidar sources in ' + capture.pcapFiles.join(', ');
+      }
+    });
+}
+
+loadCapture();